@@ -0,0 +1,88 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/task"
+	"math"
+)
+
+const (
+	LogarithmicIterations AutoIterationsMode = iota
+	PowerIterations
+	AdaptiveIterations
+)
+
+type AutoIterationsMode int
+
+func (m AutoIterationsMode) String() string {
+	return []string{
+		"Logarithmic", "Power", "Adaptive",
+	}[m]
+}
+
+// autoIterationsSettings
+// Derives the iteration limit of each frame from its magnification:
+//
+//	Logarithmic: Base + Scale * log10(magnification)^Exponent
+//	Power:       Base + Scale * magnification^Exponent
+//	Adaptive:    highest escaped iteration count of the latest saved frame * Headroom, at most the logarithmic formula
+//	             * Headroom, falling back to the logarithmic formula until a frame has been saved
+//
+// The result is kept between MinIterations and MaxIterations. Frames are saved in order while the next frames are
+// already being calculated, so the adaptive limit comes from a frame up to MemorySettings.MaxOpenImages frames back, or
+// as many frames as the scheduler queue holds when that is not set.
+// Points that escape near the limit push the next limit up by Headroom, the cap keeps that from compounding frame
+// after frame.
+type autoIterationsSettings struct {
+	Base          float64
+	Enabled       bool
+	Exponent      float64
+	Headroom      float64
+	MaxIterations uint
+	MinIterations uint
+	Mode          AutoIterationsMode
+	Scale         float64
+}
+
+func (ais *autoIterationsSettings) Verify(defaultBase uint) error {
+	if ais.Base <= 0 {
+		ais.Base = float64(defaultBase)
+	}
+	if ais.Exponent <= 0 {
+		ais.Exponent = 1
+	}
+	if ais.Headroom <= 1 {
+		ais.Headroom = 2
+	}
+	if ais.MinIterations == 0 {
+		ais.MinIterations = 100
+	}
+	if ais.MaxIterations < ais.MinIterations {
+		ais.MaxIterations = 100000
+	}
+	if ais.Mode < LogarithmicIterations || ais.Mode > AdaptiveIterations {
+		ais.Mode = LogarithmicIterations
+	}
+	if ais.Scale <= 0 {
+		ais.Scale = 250
+	}
+	return nil
+}
+
+// Iterations
+// Returns the iteration limit for a frame at the given magnification. latest holds the statistics of the most recently
+// saved frame and is nil when no frame has been saved yet.
+func (ais *autoIterationsSettings) Iterations(magnification float64, latest *task.Statistics) uint {
+	logarithmic := ais.Base + ais.Scale*math.Pow(math.Log10(math.Max(magnification, 1)), ais.Exponent)
+	var iterations float64
+	switch {
+	case ais.Mode == AdaptiveIterations && latest != nil && latest.EscapedSamples > 0:
+		iterations = math.Min(latest.EscapedMax, logarithmic) * ais.Headroom
+	case ais.Mode == PowerIterations:
+		iterations = ais.Base + ais.Scale*math.Pow(magnification, ais.Exponent)
+	default:
+		iterations = logarithmic
+	}
+
+	iterations = math.Max(float64(ais.MinIterations), math.Min(float64(ais.MaxIterations), iterations))
+	return uint(math.Round(iterations))
+}
@@ -0,0 +1,21 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/task"
+	"testing"
+)
+
+func TestAdaptiveIterationsCapped(t *testing.T) {
+	ais := autoIterationsSettings{Mode: AdaptiveIterations}
+	ais.Verify(100)
+
+	// Every frame escapes right at its limit, which without the cap doubles the limit every frame
+	latest := &task.Statistics{EscapedSamples: 1, EscapedMax: 100}
+	capped := ais.Iterations(1000, nil) * 2
+	for frame := 0; frame < 20; frame++ {
+		latest.EscapedMax = float64(ais.Iterations(1000, latest))
+	}
+	if uint(latest.EscapedMax) != capped {
+		t.Errorf("limit grew to %d, want at most %d", uint(latest.EscapedMax), capped)
+	}
+}
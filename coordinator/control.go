@@ -0,0 +1,77 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/misc"
+	"DistributedMandelbrot/transport"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ControlWorkers
+// Applies the action of the request to the workers it names, or to every worker when it names none, and replies with
+// their stats. Workers that could not be reached are listed with the reason, HTTP workers cannot be called back so
+// they are never reached
+func (c *Coordinator) ControlWorkers(request misc.ControlRequest, reply *[]misc.WorkerStats) error {
+	if request.Action < misc.StatsAction || request.Action > misc.ConcurrencyAction {
+		return fmt.Errorf("unknown action %d", request.Action)
+	}
+	if request.Action == misc.ConcurrencyAction && request.Concurrency == 0 {
+		return errors.New("a worker calculates at least one task at once, use pause to stop it")
+	}
+
+	c.mutex.Lock()
+	names := request.Workers
+	if len(names) == 0 {
+		for name := range c.workers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	clients := make(map[string]transport.Worker, len(names))
+	registered := make(map[string]bool, len(names))
+	for _, name := range names {
+		_, registered[name] = c.workers[name]
+		if client, ok := c.clients[name]; ok {
+			clients[name] = client
+		}
+	}
+	c.mutex.Unlock()
+
+	*reply = make([]misc.WorkerStats, 0, len(names))
+	for _, name := range names {
+		var stats misc.WorkerStats
+		var err error
+		client, callBack := clients[name]
+		switch {
+		case !registered[name]:
+			err = fmt.Errorf("worker %s is not registered", name)
+		case !callBack:
+			err = errors.New("the worker cannot be called back")
+		default:
+			stats, err = controlWorker(client, request)
+		}
+		if err != nil {
+			stats = misc.WorkerStats{Address: name, Error: err.Error()}
+		} else if request.Action != misc.StatsAction {
+			c.logger.Infof("Worker %s: %s", name, request.Action)
+		}
+		*reply = append(*reply, stats)
+	}
+	return nil
+}
+
+func controlWorker(client transport.Worker, request misc.ControlRequest) (misc.WorkerStats, error) {
+	switch request.Action {
+	case misc.PauseAction:
+		return client.Pause()
+	case misc.ResumeAction:
+		return client.Resume()
+	case misc.DrainAction:
+		return client.Drain()
+	case misc.ConcurrencyAction:
+		return client.SetConcurrency(request.Concurrency)
+	default:
+		return client.Stats()
+	}
+}
@@ -4,53 +4,100 @@ import (
 	"DistributedMandelbrot/mandelbrot"
 	"DistributedMandelbrot/misc"
 	"DistributedMandelbrot/task"
+	"DistributedMandelbrot/transport"
 	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/BrugadaSyndrome/bslogger"
-	"github.com/BrugadaSyndrome/multirpc"
 	gimage "image"
-	"image/jpeg"
 	"math"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 )
 
 type Coordinator struct {
-	clients             map[string]*multirpc.TcpClient
-	digitCount          uint // Used to format name of images for ffmpeg
+	advertiser          *misc.Advertiser // Announces the coordinator on the local network
+	checkpointFolder    string           // Folder of the checkpoint the run resumed from, it is kept until the next checkpoint
+	checkpointImages    map[int]bool     // Partial images of that checkpoint that have not received pixels since
+	clients             map[string]transport.Worker
+	connectors          map[string]*misc.Connector // Carry calls to workers when the connections are secured
+	digitCount          uint                       // Used to format name of images for ffmpeg
+	drained             chan struct{}              // Closed once the workers had their chance to return their tasks on shutdown
+	finishing           bool                       // Set once every task is in or on shutdown, new workers are turned away from then on
+	frames              map[uint]frameMetadata
+	guard               *misc.Guard                   // Lets in workers that authenticate when the connections are secured
+	handOutTimes        map[string]map[uint]time.Time // When each task a worker has was handed to it, for the journal
+	httpServer          *http.Server                  // Serves the worker protocol as JSON when HTTPSettings.Address is set
+	imageProgress       map[uint]*checkpointImage     // What each image has received, written to the checkpoint on shutdown
 	images              map[int]imageTask
+	imageUpdated        map[int]uint64 // Value of imageUpdates when each image in memory last received pixels
+	imageUpdates        uint64
 	imageCompletedCount uint
 	imageCount          uint
+	imagePlans          []imagePlan   // Images the workers calculate, in the order they are generated
+	journal             *misc.Journal // Records what happens in the run as JSON lines, nil when it cannot be written
+	keyframes           map[uint]*keyframe
+	latestStatistics    *task.Statistics // Escape statistics of the most recently saved image
 	logger              bslogger.Logger
+	mandelbrot          mandelbrot.Mandelbrot // Used to recolor images of color only transitions
 	mutex               sync.Mutex
 	name                string
-	pixelCount          uint
+	openImages          chan struct{}          // Holds a value for each image with tasks handed out when their number is limited
+	plannedTaskCount    uint                   // Tasks the settings make for the run, taskCount also counts tasks calculated again
+	posterOpaque        bool                   // Cleared when a poster tile has a transparent pixel
+	recolorTasks        map[uint][]recolorTask // frames to color from the iterations of the keyed image number
 	rectangle           gimage.Rectangle
+	redoPending         map[uint]int             // Tasks calculating pixels again that each image is waiting on
+	redoTasks           map[uint]task.Statistics // Tasks calculating pixels again, with the statistics of the task they replace
+	resumedImages       map[uint]checkpointImage // Images the checkpoint of the run being resumed has progress on
+	resumedTasks        map[uint]bool            // Tasks of partial images the run being resumed has in already
+	scheduler           *scheduler
 	settings            settings
+	shutdown            chan struct{} // Closed when the coordinator is asked to shut down
+	spilledImages       map[int]bool  // Images written to disk to stay under the limit of images in memory
+	stopped             bool          // Set once ingestion stopped on shutdown, returned tasks are refused from then on
 	taskCount           uint
 	taskGeneratedCount  uint
 	taskIngestedCount   uint
 	tasksHandedOut      map[string]map[uint]task.Task // keep track of all tasks workers have
 	tasksDone           chan task.Task
-	tasksTodo           chan task.Task
+	tileRequests        map[uint]chan task.Task // explorer tile requests waiting on a worker, keyed by task id
+	transport           transport.Transport
 	workerWait          *sync.WaitGroup
+	workers             map[string]*workerState
+	workPerTask         float64 // Average benchmark iterations a task takes, used to size tasks for new workers
 
-	Server multirpc.TcpServer
+	Server transport.Server
 }
 
-func NewCoordinator(settingsFile string) Coordinator {
+func NewCoordinator(settingsFile string) *Coordinator {
+	return NewCoordinatorWithTransport(settingsFile, transport.TCP{})
+}
+
+// NewCoordinatorWithTransport
+// Starts a coordinator that talks to its workers over the transport, e.g. transport.Memory to run the workers in the
+// same process
+func NewCoordinatorWithTransport(settingsFile string, t transport.Transport) *Coordinator {
 	settings := NewSettings(settingsFile)
 
-	coordinator := Coordinator{
-		clients:    make(map[string]*multirpc.TcpClient),
-		images:     make(map[int]imageTask),
-		logger:     bslogger.NewLogger("Coordinator", bslogger.Normal, nil),
-		pixelCount: settings.MandelbrotSettings.Height * settings.MandelbrotSettings.Width,
+	coordinator := &Coordinator{
+		checkpointImages: make(map[int]bool),
+		clients:          make(map[string]transport.Worker),
+		connectors:       make(map[string]*misc.Connector),
+		drained:          make(chan struct{}),
+		frames:           make(map[uint]frameMetadata),
+		handOutTimes:     make(map[string]map[uint]time.Time),
+		imageProgress:    make(map[uint]*checkpointImage),
+		images:           make(map[int]imageTask),
+		imageUpdated:     make(map[int]uint64),
+		keyframes:        make(map[uint]*keyframe),
+		logger:           bslogger.NewLogger("Coordinator", bslogger.Normal, nil),
 		rectangle: gimage.Rectangle{
 			Min: gimage.Point{
 				X: 0,
@@ -61,13 +108,23 @@ func NewCoordinator(settingsFile string) Coordinator {
 				Y: int(settings.MandelbrotSettings.Height),
 			},
 		},
+		recolorTasks:   make(map[uint][]recolorTask),
+		redoPending:    make(map[uint]int),
+		redoTasks:      make(map[uint]task.Statistics),
+		resumedImages:  make(map[uint]checkpointImage),
+		resumedTasks:   make(map[uint]bool),
+		scheduler:      newScheduler(settings.SchedulerSettings),
 		settings:       settings,
+		shutdown:       make(chan struct{}),
+		spilledImages:  make(map[int]bool),
 		tasksHandedOut: make(map[string]map[uint]task.Task),
 		tasksDone:      make(chan task.Task, 1000),
-		tasksTodo:      make(chan task.Task, 1000),
+		transport:      t,
 		workerWait:     &sync.WaitGroup{},
+		workers:        make(map[string]*workerState),
 	}
 	misc.CheckError(settings.Verify(), coordinator.logger, misc.Fatal)
+	coordinator.mandelbrot = mandelbrot.NewMandelbrot(settings.MandelbrotSettings)
 
 	/*
 	 * Use logarithms to determine the number of images that will be generated
@@ -79,7 +136,12 @@ func NewCoordinator(settingsFile string) Coordinator {
 	 */
 	for i := 0; i < len(settings.TransitionSettings); i++ {
 		var transitionCount uint = 1
-		if settings.TransitionSettings[i].MagnificationStart < settings.TransitionSettings[i].MagnificationEnd {
+		if settings.TransitionSettings[i].MagnificationStart == settings.TransitionSettings[i].MagnificationEnd {
+			// not zooming so use the frame count given
+			if settings.TransitionSettings[i].FrameCount > 0 {
+				transitionCount = settings.TransitionSettings[i].FrameCount
+			}
+		} else if settings.TransitionSettings[i].MagnificationStart < settings.TransitionSettings[i].MagnificationEnd {
 			// zooming in
 			transitionCount = uint(math.Ceil((math.Log(settings.TransitionSettings[i].MagnificationEnd) / math.Log(settings.TransitionSettings[i].MagnificationStep)) - math.Log(settings.TransitionSettings[i].MagnificationStart)))
 		} else {
@@ -90,27 +152,34 @@ func NewCoordinator(settingsFile string) Coordinator {
 		settings.TransitionSettings[i].FrameCount = transitionCount
 	}
 
+	// A poster is a single image no matter what the transitions say
+	if settings.PosterSettings.Enabled {
+		coordinator.imageCount = 1
+	}
+
 	// ffmpeg needs the images named in a certain way
 	coordinator.digitCount = (uint)(math.Log10((float64)(coordinator.imageCount)) + 1)
 
-	// Determine the number of tasks that will be generated so the coordinator knows when to shut down
-	switch settings.TaskGeneration {
-	case task.Row:
-		coordinator.taskCount = settings.MandelbrotSettings.Height * coordinator.imageCount
-	case task.Column:
-		coordinator.taskCount = settings.MandelbrotSettings.Width * coordinator.imageCount
-	case task.Image:
-		coordinator.taskCount = coordinator.imageCount
-	case task.Grid:
-		coordinator.taskCount = (settings.MandelbrotSettings.Height / 10) * (settings.MandelbrotSettings.Width / 10) * coordinator.imageCount
-	default:
-		coordinator.logger.Fatalf("Unknown generation type: %d", coordinator.settings.TaskGeneration)
-		break
+	// Work out the images the workers need to calculate and the number of tasks that will be generated so the
+	// coordinator knows when to shut down
+	if settings.PosterSettings.Enabled {
+		coordinator.taskCount = coordinator.planPoster()
+	} else {
+		coordinator.planImages()
+		for _, plan := range coordinator.imagePlans {
+			coordinator.taskCount += coordinator.taskCountForImage(plan)
+		}
+	}
+	coordinator.plannedTaskCount = coordinator.taskCount
+
+	if settings.MemorySettings.MaxOpenImages > 0 {
+		coordinator.openImages = make(chan struct{}, settings.MemorySettings.MaxOpenImages)
 	}
 
 	// Start up the rpc tcp server to allow workers to communicate with the coordinator
-	coordinator.Server = multirpc.NewTcpServer(&coordinator, settings.ServerAddress, "CoordinatorServer")
-	misc.CheckError(coordinator.Server.Run(), coordinator.logger, misc.Fatal)
+	coordinator.listen()
+	coordinator.listenHTTP()
+	coordinator.advertise()
 
 	// Create directory to store files for this run
 	if _, err := os.Stat(filepath.Join(settings.SavePath, settings.RunName)); os.IsNotExist(err) {
@@ -123,15 +192,27 @@ func NewCoordinator(settingsFile string) Coordinator {
 
 	// Copy the settings to the directory so the run can be duplicated in the future
 	marshaledSettings, err := json.Marshal(settings)
-	bytesWritten, err := misc.WriteFile(filepath.Join(settings.SavePath, settings.RunName, settingsFile), marshaledSettings)
+	bytesWritten, err := misc.WriteFile(filepath.Join(settings.SavePath, settings.RunName, filepath.Base(settingsFile)), marshaledSettings)
 	if err != nil || bytesWritten == 0 {
 		coordinator.logger.Fatalf("Unable to make a backup copy of settingsFile: %s", settingsFile)
 	}
 
-	// Create a log file to record the run
-	logFile, err := os.Create(filepath.Join(settings.SavePath, settings.RunName, "coordinator.log"))
+	// Create a log file to record the run, a resumed run carries on with the log it has
+	_, err = os.Stat(coordinator.checkpointPath())
+	resuming := err == nil
+	logFlags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resuming {
+		logFlags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	logFile, err := os.OpenFile(filepath.Join(settings.SavePath, settings.RunName, "coordinator.log"), logFlags, 0666)
 	misc.CheckError(err, coordinator.logger, misc.Warning)
 	coordinator.logger = bslogger.NewLogger("Coordinator", bslogger.Normal, logFile)
+	coordinator.openJournal(resuming && !settings.PosterSettings.Enabled)
+
+	// Carry on from where the run was shut down, posters are always started over
+	if !settings.PosterSettings.Enabled {
+		misc.CheckError(coordinator.resume(), coordinator.logger, misc.Warning)
+	}
 
 	go coordinator.tickers()
 	go coordinator.generateTasks()
@@ -140,6 +221,12 @@ func NewCoordinator(settingsFile string) Coordinator {
 	return coordinator
 }
 
+// Address
+// Returns the address workers reach the coordinator on
+func (c *Coordinator) Address() string {
+	return c.settings.ServerAddress
+}
+
 func (c *Coordinator) tickers() {
 	rollCall := time.NewTicker(time.Minute)
 	heartBeat := time.NewTicker(30 * time.Second)
@@ -148,13 +235,11 @@ func (c *Coordinator) tickers() {
 		select {
 		case _ = <-rollCall.C:
 			c.logger.Debug("Roll call ticker")
-			var junk misc.Nothing
 			for _, v := range c.clients {
-				var reply bool
-				err := v.Call("Worker.RollCall", junk, &reply)
+				err := v.RollCall()
 				if err != nil {
 					// Cannot communicate with the worker
-					c.logger.Warningf("Worker %s missed roll call: %s", v.Name, err)
+					c.logger.Warningf("Worker %s missed roll call: %s", v.Name(), err)
 					misc.CheckError(v.Disconnect(), c.logger, misc.Warning)
 
 					// Remove worker from pool
@@ -162,158 +247,213 @@ func (c *Coordinator) tickers() {
 					misc.CheckError(c.DeRegisterWorker(v.Name(), &nothing), c.logger, misc.Warning)
 				}
 			}
+			c.dropSilentHTTPWorkers()
 
 		case _ = <-heartBeat.C:
 			c.logger.Debug("Heart beat ticker")
-			c.logger.Infof("Tasks [Generated: %d] [Ingested: %d] | Images [Completed: %d] [WIP: %d] [Todo: %d]", c.taskGeneratedCount, c.taskIngestedCount, c.imageCompletedCount, len(c.images), c.imageCount-c.imageCompletedCount)
+			c.logger.Infof("Tasks [Generated: %d] [Ingested: %d] | Images [Completed: %d] [WIP: %d] [Todo: %d]", c.taskGeneratedCount, c.taskIngestedCount, c.imageCompletedCount, len(c.images)+len(c.spilledImages)+len(c.checkpointImages), c.imageCount-c.imageCompletedCount)
 		}
 	}
 }
 
 func (c *Coordinator) generateTasks() {
+	if c.settings.PosterSettings.Enabled {
+		c.generatePosterTasks()
+		return
+	}
 	c.logger.Info("Generating tasks")
 
-	// Generate tasks for this image
-	var imageNumber uint = 1
 	var elapsedTime time.Duration
 	var startTime = time.Now()
 
-	for transitionStep := 0; transitionStep < len(c.settings.TransitionSettings); transitionStep++ {
-		// generate each image for this transition while zooming in exponentially
-		transition := c.settings.TransitionSettings[transitionStep]
-		magnification := transition.MagnificationStart
-		currentX := transition.StartX
-		currentY := transition.StartY
-
-		var currentFrame uint
-		for currentFrame = 1; currentFrame <= transition.FrameCount; currentFrame++ {
-			// Linear interpolation through the coordinates in the transition
-			t := float64(currentFrame) / float64(transition.FrameCount)
+	for _, plan := range c.imagePlans {
+		// Images a resumed run completed already only keep their task ids
+		resumed, isResumed := c.resumedImages[plan.ImageNumber]
+		if isResumed && resumed.Completed {
+			c.taskGeneratedCount += c.taskCountForImage(plan)
+			continue
+		}
 
-			// zooming out
-			if transition.MagnificationStart > transition.MagnificationEnd {
-				currentX = misc.LerpFloat64(transition.StartX, transition.EndX, misc.EaseInExpo(t))
-				currentY = misc.LerpFloat64(transition.StartY, transition.EndY, misc.EaseInExpo(t))
-				magnification /= transition.MagnificationStep
+		// Wait for an earlier image to be saved when too many are open
+		if c.openImages != nil {
+			select {
+			case c.openImages <- struct{}{}:
+			case <-c.shutdown:
+				return
 			}
+		}
+		if c.shuttingDown() {
+			return
+		}
 
-			switch c.settings.TaskGeneration {
-			case task.Row:
-				var row uint
-				for row = 0; row < c.settings.MandelbrotSettings.Height; row++ {
-					taskTodo := task.NewTask(c.taskGeneratedCount, imageNumber)
-					taskTodo.AddTasksForRow(currentX, currentY, magnification, row, c.settings.MandelbrotSettings.Width)
-					c.tasksTodo <- taskTodo
-					c.taskGeneratedCount++
-				}
-			case task.Column:
-				var column uint
-				for column = 0; column < c.settings.MandelbrotSettings.Width; column++ {
-					taskTodo := task.NewTask(c.taskGeneratedCount, imageNumber)
-					taskTodo.AddTasksForColumn(currentX, currentY, magnification, c.settings.MandelbrotSettings.Height, column)
-					c.tasksTodo <- taskTodo
-					c.taskGeneratedCount++
-				}
-			case task.Image:
-				taskTodo := task.NewTask(c.taskGeneratedCount, imageNumber)
-				taskTodo.AddTasksForImage(currentX, currentY, magnification, c.settings.MandelbrotSettings.Height, c.settings.MandelbrotSettings.Width)
-				c.tasksTodo <- taskTodo
-				c.taskGeneratedCount++
-			case task.Grid:
-				var percentage, gridRow, gridColumn uint
-				percentage = 10
-				for gridRow = 1; gridRow <= percentage; gridRow++ {
-					for gridColumn = 1; gridColumn <= percentage; gridColumn++ {
-						taskTodo := task.NewTask(c.taskGeneratedCount, imageNumber)
-						taskTodo.AddTasksForImageByGrid(currentX, currentY, magnification, c.settings.MandelbrotSettings.Height, c.settings.MandelbrotSettings.Width, percentage, gridRow, gridColumn)
-						c.tasksTodo <- taskTodo
-						c.taskGeneratedCount++
-					}
-				}
-			default:
-				c.logger.Fatalf("Unknown generation type: %d", c.settings.TaskGeneration)
-				break
-			}
+		// Deeper images need more iterations to resolve. A partial image of a resumed run keeps the limit it has
+		maxIterations := c.settings.MandelbrotSettings.MaxIterations
+		c.mutex.Lock()
+		if isResumed {
+			maxIterations = resumed.MaxIterations
+		} else if c.settings.AutoIterations.Enabled {
+			maxIterations = c.settings.AutoIterations.Iterations(plan.DetailMagnification, c.latestStatistics)
+		}
+		c.setFrameMaxIterations(plan.ImageNumber, maxIterations)
+		c.mutex.Unlock()
+
+		newTask := func() task.Task {
+			taskTodo := task.NewTask(c.taskGeneratedCount, plan.ImageNumber)
+			taskTodo.Coloring = plan.Coloring
+			taskTodo.Height = plan.Height
+			taskTodo.KeepIterations = plan.KeepIterations
+			taskTodo.MaxIterations = maxIterations
+			taskTodo.MaxSamples = uint(c.settings.MandelbrotSettings.SuperSampling * c.settings.MandelbrotSettings.SuperSampling)
+			taskTodo.Width = plan.Width
+			return taskTodo
+		}
 
-			// zooming in
-			if transition.MagnificationStart < transition.MagnificationEnd {
-				currentX = misc.LerpFloat64(transition.StartX, transition.EndX, misc.EaseOutExpo(t))
-				currentY = misc.LerpFloat64(transition.StartY, transition.EndY, misc.EaseOutExpo(t))
-				magnification *= transition.MagnificationStep
+		switch c.settings.TaskGeneration {
+		case task.Row:
+			var row uint
+			for row = 0; row < plan.Height; row++ {
+				taskTodo := newTask()
+				taskTodo.AddTasksForRow(plan.CenterX, plan.CenterY, plan.Magnification, row, plan.Width)
+				c.addTask(taskTodo)
 			}
-
-			imageNumber++
+		case task.Column:
+			var column uint
+			for column = 0; column < plan.Width; column++ {
+				taskTodo := newTask()
+				taskTodo.AddTasksForColumn(plan.CenterX, plan.CenterY, plan.Magnification, plan.Height, column)
+				c.addTask(taskTodo)
+			}
+		case task.Image:
+			taskTodo := newTask()
+			taskTodo.AddTasksForImage(plan.CenterX, plan.CenterY, plan.Magnification, plan.Height, plan.Width)
+			c.addTask(taskTodo)
+		case task.Grid:
+			var gridRow, gridColumn uint
+			for gridRow = 0; gridRow < task.GridSize; gridRow++ {
+				for gridColumn = 0; gridColumn < task.GridSize; gridColumn++ {
+					taskTodo := newTask()
+					taskTodo.AddTasksForImageByGrid(plan.CenterX, plan.CenterY, plan.Magnification, plan.Height, plan.Width, task.GridSize, gridRow, gridColumn)
+					c.addTask(taskTodo)
+				}
+			}
+		default:
+			c.logger.Fatalf("Unknown generation type: %d", c.settings.TaskGeneration)
+			break
 		}
 	}
 
 	elapsedTime = time.Since(startTime)
-	close(c.tasksTodo)
+	c.scheduler.Close()
 
 	c.logger.Infof("Done generating %d tasks in %s", c.taskGeneratedCount, elapsedTime.Round(time.Second).String())
 }
 
+// addTask
+// Queues a generated task unless a resumed run has its pixels already
+func (c *Coordinator) addTask(t task.Task) {
+	if !c.resumedTasks[t.ID] {
+		c.scheduler.Add(t)
+	}
+	c.taskGeneratedCount++
+}
+
+// setFrameMaxIterations
+// Records the iteration limit of the frames made from the image. The caller must hold the mutex
+func (c *Coordinator) setFrameMaxIterations(imageNumber uint, maxIterations uint) {
+	imageNumbers := []uint{imageNumber}
+	if k, ok := c.keyframes[imageNumber]; ok {
+		imageNumbers = imageNumbers[:0]
+		for _, frame := range k.Frames {
+			imageNumbers = append(imageNumbers, frame.ImageNumber)
+		}
+	}
+	for _, n := range imageNumbers {
+		frame := c.frames[n]
+		frame.MaxIterations = maxIterations
+		c.frames[n] = frame
+	}
+}
+
 func (c *Coordinator) ingestTasks() {
 	c.logger.Info("Ingesting tasks")
 
 	var elapsedTime time.Duration
 	var startTime = time.Now()
 
+	stopped := false
 	for {
-		if c.taskIngestedCount == c.taskCount {
+		if c.ingestDone() {
 			// There are no more tasks to ingest
 			break
 		}
 
 		// Get the next task to work on
-		taskReceived, _ := <-c.tasksDone
-		c.taskIngestedCount++
-
-		for r := 0; r < len(taskReceived.Results); r++ {
-			image, ok := c.images[int(taskReceived.ImageNumber)]
-			if !ok {
-				// Need to create an image save the incoming pixels
-				image = imageTask{
-					Image:      gimage.NewRGBA(c.rectangle),
-					PixelsLeft: c.pixelCount,
-				}
-			}
+		taskReceived, ok := c.nextDoneTask()
+		if !ok {
+			stopped = true
+			break
+		}
+		c.taskIngestedCount += uint(len(taskReceived.IDs()))
 
-			// Record the pixel on the image and decrement the amount of pixels left to be recorded
-			result := taskReceived.Results[r]
-			image.Image.SetRGBA(int(result.Column), int(result.Row), result.Color)
-			image.PixelsLeft--
-			c.mutex.Lock()
-			c.images[int(taskReceived.ImageNumber)] = image
-			delete(c.tasksHandedOut[taskReceived.WorkerAddress], taskReceived.ID)
-			c.mutex.Unlock()
-
-			// All pixels have been recorded so save the image
-			if image.PixelsLeft == 0 {
-				path := filepath.Join(c.settings.SavePath, c.settings.RunName, fmt.Sprintf("%0[1]*[2]d.jpg", c.digitCount, taskReceived.ImageNumber))
-				f, err := os.Create(path)
-				if err != nil {
-					c.logger.Fatalf("ERROR - Unable to create image: %s", err)
-				}
-				err = jpeg.Encode(f, image.Image, nil)
-				if err != nil {
-					c.logger.Fatalf("ERROR - Unable to save image: %s", err)
-				}
-				c.logger.Infof("Saved image to %s", path)
+		// Poster tiles go straight to disk
+		if c.settings.PosterSettings.Enabled {
+			c.ingestPosterTile(taskReceived)
+			continue
+		}
 
-				// Remove the image to conserve memory
-				c.mutex.Lock()
-				delete(c.images, int(taskReceived.ImageNumber))
-				c.mutex.Unlock()
-				c.imageCompletedCount++
+		image, err := c.openImage(taskReceived)
+		if err != nil {
+			c.logger.Fatalf("Unable to open image %d: %s", taskReceived.ImageNumber, err)
+		}
+
+		// Record the pixels on the image. acceptResults decoded the results and made sure there is one for each pixel
+		for _, result := range taskReceived.Results {
+			image.Image.SetRGBA(int(result.Column), int(result.Row), result.Color)
+			if image.Iterations != nil {
+				image.Iterations[int(result.Row)*image.Image.Rect.Dx()+int(result.Column)] = result.Iterations
 			}
 		}
+
+		// Gather the escape statistics of the image once per task. Pixels calculated again after a worker was
+		// quarantined replace the statistics of the task they were first calculated by and were counted already
+		replaced, redo := c.ingestRedo(taskReceived)
+		image.Statistics.Remove(replaced)
+		image.Statistics.Merge(taskReceived.Statistics)
+		if !redo {
+			image.PixelsLeft -= uint(len(taskReceived.Results))
+			c.recordProgress(taskReceived)
+		}
+		c.mutex.Lock()
+		delete(c.tasksHandedOut[taskReceived.WorkerAddress], taskReceived.ID)
+		c.mutex.Unlock()
+
+		// All pixels have been recorded so save the image and remove it to conserve memory
+		if image.PixelsLeft == 0 && c.finishImage(taskReceived.ImageNumber) {
+			c.completeImage(taskReceived.ImageNumber, image)
+			c.closeImage(int(taskReceived.ImageNumber))
+		} else {
+			c.storeImage(int(taskReceived.ImageNumber), image)
+		}
 	}
 
 	elapsedTime = time.Since(startTime)
+	if stopped {
+		c.stopRun()
+		return
+	}
+	c.mutex.Lock()
+	c.finishing = true
+	c.mutex.Unlock()
 	close(c.tasksDone)
 	c.logger.Infof("Done ingesting %d tasks in %s", c.taskIngestedCount, elapsedTime.Round(time.Second).String())
+	if c.settings.PosterSettings.Enabled {
+		misc.CheckError(c.assemblePoster(), c.logger, misc.Error)
+	}
+	c.saveFrames()
+	misc.CheckError(os.RemoveAll(filepath.Join(c.settings.SavePath, c.settings.RunName, "spill")), c.logger, misc.Warning)
+	c.removeCheckpoint()
 
-	c.logger.Infof("Waiting for %d workers to disconnect", len(c.clients))
+	c.logger.Infof("Waiting for %d workers to disconnect", len(c.workers))
 	c.workerWait.Wait()
 
 	if c.settings.GenerateMovie {
@@ -321,50 +461,243 @@ func (c *Coordinator) ingestTasks() {
 	}
 
 	c.logger.Info("Shutting Down")
-	misc.CheckError(c.Server.Stop(), c.logger, misc.Warning)
+	c.closeJournal("finished")
+	c.stopListening()
+}
+
+// retryTask
+// Puts a task that came back but could not be ingested back in the queue
+func (c *Coordinator) retryTask(t task.Task) {
+	c.mutex.Lock()
+	c.taskIngestedCount -= uint(len(t.IDs()))
+	delete(c.tasksHandedOut[t.WorkerAddress], t.ID)
+	c.mutex.Unlock()
+	t.Duration = 0
+	t.Encoded = nil
+	t.Encoding = task.RawEncoding
+	t.Results = nil
+	t.Statistics = task.Statistics{}
+	t.WorkerAddress = ""
+	c.scheduler.Retry(t)
+}
+
+// completeImage
+// Saves a finished image along with any frames made from it
+func (c *Coordinator) completeImage(imageNumber uint, image imageTask) {
+	if progress, ok := c.imageProgress[imageNumber]; ok {
+		progress.Completed = true
+		progress.Tasks = nil
+	}
+	c.mutex.Lock()
+	statistics := image.Statistics
+	c.latestStatistics = &statistics
+	k, isKeyframe := c.keyframes[imageNumber]
+	c.mutex.Unlock()
+
+	// Keyframes are not part of the movie, their frames are resampled from them
+	if isKeyframe {
+		c.ingestKeyframe(k, image)
+		return
+	}
+
+	c.saveImage(imageNumber, image.Image)
+	c.imageCompletedCount++
+
+	c.mutex.Lock()
+	frame := c.frames[imageNumber]
+	frame.Statistics = image.Statistics
+	c.frames[imageNumber] = frame
+
+	// Color the frames of a color only transition from the iterations of this image
+	recolors := c.recolorTasks[imageNumber]
+	delete(c.recolorTasks, imageNumber)
+	for _, recolor := range recolors {
+		recolorFrame := frame
+		recolorFrame.Coloring = recolor.Coloring
+		recolorFrame.ImageNumber = recolor.ImageNumber
+		c.frames[recolor.ImageNumber] = recolorFrame
+	}
+	c.mutex.Unlock()
+	for _, recolor := range recolors {
+		c.saveImage(recolor.ImageNumber, c.recolorImage(image.Iterations, recolor.Coloring, image.MaxIterations, c.rectangle))
+		c.imageCompletedCount++
+	}
+}
+
+func (c *Coordinator) saveImage(imageNumber uint, image *gimage.RGBA) {
+	path := filepath.Join(c.settings.SavePath, c.settings.RunName, fmt.Sprintf("%0[1]*[2]d.%[3]s", c.digitCount, imageNumber, c.settings.ImageFormat.Extension()))
+	f, err := os.Create(path)
+	if err != nil {
+		c.logger.Fatalf("ERROR - Unable to create image: %s", err)
+	}
+	err = c.settings.ImageFormat.Encode(f, image)
+	if err != nil {
+		c.logger.Fatalf("ERROR - Unable to save image: %s", err)
+	}
+	misc.CheckError(f.Close(), c.logger, misc.Warning)
+	c.logger.Infof("Saved image to %s", path)
+	c.journal.Record(misc.Event{Image: imageNumber, Kind: misc.FrameSaved})
+}
+
+// recolorImage
+// Colors an image from iterations that were already calculated by the workers
+func (c *Coordinator) recolorImage(iterations [][]float64, coloring task.Coloring, maxIterations uint, rectangle gimage.Rectangle) *gimage.RGBA {
+	image := gimage.NewRGBA(rectangle)
+	width := rectangle.Dx()
+	m := c.mandelbrot.WithMaxIterations(maxIterations)
+	for i, samples := range iterations {
+		image.SetRGBA(i%width, i/width, m.GetColorMultiple(samples, coloring))
+	}
+	return image
+}
+
+// saveFrames
+// Records the center, magnification, iteration limit and coloring of every image in the run folder
+func (c *Coordinator) saveFrames() {
+	c.mutex.Lock()
+	frames := make([]frameMetadata, 0, len(c.frames))
+	for _, frame := range c.frames {
+		frames = append(frames, frame)
+	}
+	c.mutex.Unlock()
+	sort.Slice(frames, func(i, j int) bool { return frames[i].ImageNumber < frames[j].ImageNumber })
+
+	marshaledFrames, err := json.MarshalIndent(frames, "", "    ")
+	misc.CheckError(err, c.logger, misc.Warning)
+	_, err = misc.WriteFile(filepath.Join(c.settings.SavePath, c.settings.RunName, "frames.json"), marshaledFrames)
+	misc.CheckError(err, c.logger, misc.Warning)
 }
 
 func (c *Coordinator) generateMovie() {
 	c.logger.Info("Making movie")
-	args := []string{"-r", "60", "-i", filepath.Join(c.settings.SavePath, c.settings.RunName, fmt.Sprintf("%%%dd.jpg", c.digitCount)), "-c:v", "libx264", "-pix_fmt", "yuvj420p", filepath.Join(c.settings.SavePath, c.settings.RunName, "movie.mp4")}
+	args := []string{"-r", "60", "-i", filepath.Join(c.settings.SavePath, c.settings.RunName, fmt.Sprintf("%%0%dd.%s", c.digitCount, c.settings.ImageFormat.Extension())), "-c:v", "libx264", "-pix_fmt", "yuvj420p", filepath.Join(c.settings.SavePath, c.settings.RunName, "movie.mp4")}
 	cmd := exec.Command("ffmpeg", args...)
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
-	misc.CheckError(cmd.Run(), c.logger, misc.Error)
+	startTime := time.Now()
+	err := cmd.Run()
+	misc.CheckError(err, c.logger, misc.Error)
+	event := misc.Event{Elapsed: time.Since(startTime), Kind: misc.MovieEncoded}
+	if err != nil {
+		event.Reason = err.Error()
+	}
+	c.journal.Record(event)
 	c.logger.Info("Done making movie")
 }
 
-func (c *Coordinator) RegisterWorker(workerServerAddress string, reply *misc.Nothing) error {
+func (c *Coordinator) RegisterWorker(registration misc.Registration, reply *misc.RegistrationReply) error {
+	return c.registerWorker(registration, reply, true)
+}
+
+// registerWorker
+// Adds a worker to the pool. Workers that run an rpc server are called back for roll call, the others have to keep
+// making requests to stay in the pool
+func (c *Coordinator) registerWorker(registration misc.Registration, reply *misc.RegistrationReply, callBack bool) error {
+	workerServerAddress := registration.Address
+	reply.ProtocolVersion = misc.ProtocolVersion
+
+	// Workers that would misread the tasks of this run are turned away before they get any
+	features, err := c.checkRegistration(registration)
+	if err != nil {
+		c.logger.Warningf("Rejected worker: %s", err)
+		return err
+	}
+	encoding := chooseEncoding(registration.Encodings)
+	reply.Encoding = encoding
+
+	// Workers that wait for the next job must not hold up a coordinator that is finishing
+	c.mutex.Lock()
+	finishing := c.finishing
+	state, rejoined := c.workers[workerServerAddress]
+	c.mutex.Unlock()
+	if c.shuttingDown() {
+		return errShuttingDown
+	}
+	if finishing {
+		return errors.New("all tasks handed out")
+	}
+	// A worker that lost its connection joins again. It starts over, the tasks it had out go to other workers
+	if rejoined {
+		if state.Quarantined {
+			return errQuarantined
+		}
+		var nothing misc.Nothing
+		misc.CheckError(c.DeRegisterWorker(workerServerAddress, &nothing), c.logger, misc.Warning)
+	}
+
 	// Create a client to communicate with this worker
-	client := multirpc.NewTcpClient(workerServerAddress, workerServerAddress)
+	var client transport.Worker
+	if callBack {
+		client, err = c.newWorkerClient(workerServerAddress)
+		if err != nil {
+			return err
+		}
+	}
 	c.mutex.Lock()
-	c.clients[workerServerAddress] = &client
+	if client != nil {
+		c.clients[workerServerAddress] = client
+	}
 	// Track all tasks this worker checks out
 	c.tasksHandedOut[workerServerAddress] = make(map[uint]task.Task)
+	c.handOutTimes[workerServerAddress] = make(map[uint]time.Time)
+	c.workers[workerServerAddress] = &workerState{Encoding: encoding, Features: features, LastSeen: time.Now()}
+	c.workerWait.Add(1)
 	c.mutex.Unlock()
-	misc.CheckError(client.Connect(), c.logger, misc.Warning)
+	if client != nil {
+		misc.CheckError(client.Connect(), c.logger, misc.Warning)
+	}
 
-	c.logger.Infof("Worker joined: %s", workerServerAddress)
-	c.workerWait.Add(1)
+	c.logger.Infof("Worker joined: %s [Protocol: %d, Encoding: %s]", workerServerAddress, registration.ProtocolVersion, encoding)
+	c.journal.Record(misc.Event{Kind: misc.WorkerJoined, Worker: workerServerAddress})
 
 	return nil
 }
 
+// ReportBenchmark
+// Records how fast a registered worker is
+func (c *Coordinator) ReportBenchmark(report misc.BenchmarkReport, reply *misc.Nothing) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	state, ok := c.workers[report.Address]
+	if !ok {
+		return fmt.Errorf("worker %s is not registered", report.Address)
+	}
+	state.Benchmark = report.Benchmark
+	c.logger.Infof("Worker %s benchmark: %.0f iterations/s", report.Address, report.Benchmark)
+	return nil
+}
+
 func (c *Coordinator) DeRegisterWorker(workerServerAddress string, reply *misc.Nothing) error {
+	// A worker can be dropped for missing roll call while it leaves on its own
+	c.mutex.Lock()
+	if _, ok := c.workers[workerServerAddress]; !ok {
+		c.mutex.Unlock()
+		return fmt.Errorf("worker %s is not registered", workerServerAddress)
+	}
+	delete(c.workers, workerServerAddress)
+	client, callBack := c.clients[workerServerAddress]
+	c.mutex.Unlock()
+
 	// Disconnect from worker
-	misc.CheckError(c.clients[workerServerAddress].Disconnect(), c.logger, misc.Warning)
+	if callBack {
+		misc.CheckError(client.Disconnect(), c.logger, misc.Warning)
+	}
 
 	c.mutex.Lock()
-	// Put tasks this worker has not returned yet back into the tasksTodo pool
+	// Put tasks this worker has not returned yet back at the front of the queue
 	for _, task := range c.tasksHandedOut[workerServerAddress] {
-		c.tasksTodo <- task
+		c.scheduler.Requeue(task, workerServerAddress)
+		c.journalRequeue(workerServerAddress, task, "worker left")
 	}
 	// Remove stored values associated with this worker
 	delete(c.tasksHandedOut, workerServerAddress)
+	delete(c.handOutTimes, workerServerAddress)
 	delete(c.clients, workerServerAddress)
+	c.closeWorkerClient(workerServerAddress)
 	c.mutex.Unlock()
 
 	c.logger.Infof("Worker left: %s", workerServerAddress)
+	c.journal.Record(misc.Event{Kind: misc.WorkerLeft, Worker: workerServerAddress})
 	c.workerWait.Done()
 
 	return nil
@@ -376,25 +709,172 @@ func (c *Coordinator) RollCall(nothing misc.Nothing, present *bool) error {
 }
 
 func (c *Coordinator) GetTask(workerAddress string, task *task.Task) error {
-	todo, more := <-c.tasksTodo
+	todo, more := c.scheduler.Next(workerAddress, c.batchSize(workerAddress))
+	if !more && c.shuttingDown() {
+		return errShuttingDown
+	}
 	if !more {
 		task = nil
 		c.logger.Infof("Telling worker %s that all tasks are handed out", workerAddress)
 		return errors.New("all tasks handed out")
 	}
+	if err := c.recordHandOut(workerAddress, &todo); err != nil {
+		return err
+	}
+	*task = todo
+	return nil
+}
+
+// GetTasks
+// Hands out up to request.Count tasks in one call. Waits for the first task like GetTask, the rest are only added when
+// they are ready to go
+func (c *Coordinator) GetTasks(request misc.TaskRequest, tasks *[]task.Task) error {
+	batch := c.batchSize(request.Address)
+	todo, more := c.scheduler.Next(request.Address, batch)
+	if !more && c.shuttingDown() {
+		return errShuttingDown
+	}
+	if !more {
+		c.logger.Infof("Telling worker %s that all tasks are handed out", request.Address)
+		return errors.New("all tasks handed out")
+	}
+	if err := c.recordHandOut(request.Address, &todo); err != nil {
+		return err
+	}
+	*tasks = append((*tasks)[:0], todo)
+
+	for uint(len(*tasks)) < request.Count {
+		todo, more = c.scheduler.TryNext(request.Address, batch)
+		if !more {
+			break
+		}
+		if err := c.recordHandOut(request.Address, &todo); err != nil {
+			return err
+		}
+		*tasks = append(*tasks, todo)
+	}
+	return nil
+}
+
+// recordHandOut
+// Keeps track of the task handed to the worker. A worker that is quarantined or not registered, e.g. because the
+// coordinator restarted, does not get the task. It goes back in the queue and the reason is returned
+func (c *Coordinator) recordHandOut(workerAddress string, todo *task.Task) error {
 	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	state, ok := c.workers[workerAddress]
+	if !ok || state.Quarantined {
+		c.scheduler.Requeue(*todo, workerAddress)
+		if !ok {
+			return fmt.Errorf("worker %s is not registered", workerAddress)
+		}
+		return errQuarantined
+	}
 	todo.WorkerAddress = workerAddress
-	c.tasksHandedOut[workerAddress][todo.ID] = todo
-	c.mutex.Unlock()
-	*task = todo
+	c.tasksHandedOut[workerAddress][todo.ID] = *todo
+	c.journalHandOut(workerAddress, *todo)
 	return nil
 }
 
 func (c *Coordinator) ReturnTask(done task.Task, nothing *misc.Nothing) error {
+	c.mutex.Lock()
+	stopped := c.stopped
+	c.mutex.Unlock()
+	if stopped {
+		return errShuttingDown
+	}
+	done, err := c.acceptResults(done)
+	if err != nil {
+		return err
+	}
+	c.recordTaskDuration(done)
+
+	// Tasks of quarantined workers were handed to other workers already
+	if !c.checkReturnedTask(done) {
+		return nil
+	}
+
+	// Only the first copy of a speculatively duplicated task is used
+	first := c.scheduler.Complete(done)
+	c.journalReturn(done, !first)
+	if !first {
+		c.mutex.Lock()
+		delete(c.tasksHandedOut[done.WorkerAddress], done.ID)
+		c.mutex.Unlock()
+		c.logger.Debugf("Ignoring duplicate of task %d from %s", done.ID, done.WorkerAddress)
+		return nil
+	}
 	c.tasksDone <- done
 	return nil
 }
 
+// acceptResults
+// Returns the task handed out to the worker with the results it sent back. Only the results come from the worker, and
+// they must hold exactly one pixel for each pixel of the task. The results are decoded once here, without holding the
+// lock, so everything after works on the checked Results. A task with bad results goes back in the queue
+func (c *Coordinator) acceptResults(done task.Task) (task.Task, error) {
+	c.mutex.Lock()
+	handedOut, ok := c.tasksHandedOut[done.WorkerAddress][done.ID]
+	c.mutex.Unlock()
+	if !ok {
+		return c.notHandedOut(done)
+	}
+
+	accepted := handedOut
+	accepted.Duration = done.Duration
+	accepted.Encoded = done.Encoded
+	accepted.Encoding = done.Encoding
+	accepted.Results = done.Results
+	accepted.Statistics = done.Statistics
+	err := accepted.DecodeResults()
+	if err == nil {
+		err = accepted.CheckResults()
+	}
+
+	// The worker may have been quarantined or dropped while the results were checked
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok = c.tasksHandedOut[done.WorkerAddress][done.ID]; !ok {
+		return c.notHandedOutLocked(done)
+	}
+	if err != nil {
+		delete(c.tasksHandedOut[done.WorkerAddress], done.ID)
+		c.scheduler.Requeue(handedOut, done.WorkerAddress)
+		c.journalRequeue(done.WorkerAddress, handedOut, "bad results")
+		return task.Task{}, fmt.Errorf("task %d from %s has bad results, handing it out again: %s", done.ID, done.WorkerAddress, err)
+	}
+	return accepted, nil
+}
+
+// notHandedOut
+// Returns the task as it came back when its worker is quarantined, checkReturnedTask ignores it since the task was
+// handed to another worker already. Any other task that is not handed out to the worker is refused
+func (c *Coordinator) notHandedOut(done task.Task) (task.Task, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.notHandedOutLocked(done)
+}
+
+func (c *Coordinator) notHandedOutLocked(done task.Task) (task.Task, error) {
+	if state, registered := c.workers[done.WorkerAddress]; registered && state.Quarantined {
+		return done, nil
+	}
+	return task.Task{}, fmt.Errorf("task %d is not handed out to %s", done.ID, done.WorkerAddress)
+}
+
+// ReturnTasks
+// Returns several finished tasks in one call
+func (c *Coordinator) ReturnTasks(done []task.Task, nothing *misc.Nothing) error {
+	for _, t := range done {
+		err := c.ReturnTask(t, nothing)
+		if errors.Is(err, errShuttingDown) {
+			return err
+		}
+		misc.CheckError(err, c.logger, misc.Warning)
+	}
+	return nil
+}
+
 func (c *Coordinator) GetMandelbrotSettings(nothing misc.Nothing, settings *mandelbrot.Settings) error {
 	*settings = c.settings.MandelbrotSettings
 	return nil
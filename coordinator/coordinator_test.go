@@ -0,0 +1,256 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/task"
+	"DistributedMandelbrot/transport"
+	"DistributedMandelbrot/worker"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testSettings
+// A run small enough to finish in a moment, saved as PNG so the images can be compared byte for byte
+func testSettings(savePath string, runName string, generation task.Generation, frames uint) map[string]interface{} {
+	return map[string]interface{}{
+		"DiscoverySettings": map[string]interface{}{"Disabled": true},
+		"ImageFormat":       PNG,
+		"MandelbrotSettings": map[string]interface{}{
+			"GeneratePaletteSettings": []map[string]interface{}{{
+				"StartColor":   map[string]int{"R": 255, "A": 255},
+				"EndColor":     map[string]int{"B": 255, "A": 255},
+				"NumberColors": 16,
+			}},
+			"Height":         24,
+			"MaxIterations":  200,
+			"SmoothColoring": true,
+			"Width":          40,
+		},
+		"MemorySettings": map[string]interface{}{"MaxOpenImages": 1},
+		"RunName":        runName,
+		"SavePath":       savePath,
+		"ServerAddress":  "coordinator",
+		"TaskGeneration": generation,
+		"TransitionSettings": []map[string]interface{}{{
+			"StartX":             -0.5,
+			"EndX":               -0.7,
+			"MagnificationStart": 2,
+			"MagnificationEnd":   2,
+			"FrameCount":         frames,
+		}},
+	}
+}
+
+// startRun
+// Starts a coordinator with the settings and workers reaching it over in-memory connections. The settings file is
+// written to the save path next to the run folder
+func startRun(t *testing.T, s map[string]interface{}, workerCount int) (*Coordinator, []*worker.Worker) {
+	t.Helper()
+	marshaled, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settingsFile := filepath.Join(s["SavePath"].(string), fmt.Sprintf("%s.json", s["RunName"]))
+	if err = os.WriteFile(settingsFile, marshaled, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	network := transport.NewMemory()
+	c := NewCoordinatorWithTransport(settingsFile, network)
+	workers := make([]*worker.Worker, workerCount)
+	for i := range workers {
+		workers[i] = worker.NewWorkerWithTransport(c.Address(), network)
+	}
+	return c, workers
+}
+
+// waitForRun
+// Waits for the coordinator to stop and its workers to leave
+func waitForRun(t *testing.T, c *Coordinator, workers []*worker.Worker) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		c.Server.Wait()
+		for _, w := range workers {
+			w.Shutdown()
+			w.Wait()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Minute):
+		t.Fatal("the run did not finish")
+	}
+}
+
+// readImages
+// Returns the images a run saved, keyed by file name
+func readImages(t *testing.T, runPath string) map[string][]byte {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(runPath, "*.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		if images[filepath.Base(path)], err = os.ReadFile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return images
+}
+
+func compareImages(t *testing.T, got map[string][]byte, want map[string][]byte) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("saved %d images, want %d", len(got), len(want))
+	}
+	for name, image := range want {
+		if !bytes.Equal(got[name], image) {
+			t.Errorf("image %s differs", name)
+		}
+	}
+}
+
+func TestLocalRun(t *testing.T) {
+	dir := t.TempDir()
+	const frames = 3
+
+	// A whole image in one task is what the other ways of cutting up the images must come out the same as
+	c, workers := startRun(t, testSettings(dir, "image", task.Image, frames), 1)
+	waitForRun(t, c, workers)
+	want := readImages(t, filepath.Join(dir, "image"))
+	if len(want) != frames {
+		t.Fatalf("saved %d images, want %d", len(want), frames)
+	}
+
+	tests := []struct {
+		name       string
+		generation task.Generation
+		workers    int
+	}{
+		{name: "rows", generation: task.Row, workers: 2},
+		{name: "columns", generation: task.Column, workers: 3},
+		{name: "grid", generation: task.Grid, workers: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, workers := startRun(t, testSettings(dir, test.name, test.generation, frames), test.workers)
+			waitForRun(t, c, workers)
+			compareImages(t, readImages(t, filepath.Join(dir, test.name)), want)
+			if c.taskIngestedCount != c.taskCount {
+				t.Errorf("ingested %d of %d tasks", c.taskIngestedCount, c.taskCount)
+			}
+		})
+	}
+}
+
+// stopAfterFirstImage
+// Shuts the run down once its first image is saved, part way through the run, and returns the checkpoint it wrote
+func stopAfterFirstImage(t *testing.T, c *Coordinator, workers []*worker.Worker, runPath string) checkpoint {
+	t.Helper()
+	first := filepath.Join(runPath, "01.png")
+	for start := time.Now(); time.Since(start) < time.Minute; time.Sleep(time.Millisecond) {
+		if _, err := os.Stat(first); err == nil {
+			break
+		}
+	}
+	c.Shutdown()
+	waitForRun(t, c, workers)
+	return readCheckpoint(t, runPath)
+}
+
+func readCheckpoint(t *testing.T, runPath string) checkpoint {
+	t.Helper()
+	marshaled, err := os.ReadFile(filepath.Join(runPath, "checkpoint.json"))
+	if err != nil {
+		t.Fatalf("no checkpoint was written: %s", err)
+	}
+	var cp checkpoint
+	if err = json.Unmarshal(marshaled, &cp); err != nil {
+		t.Fatalf("the checkpoint does not read back: %s", err)
+	}
+	return cp
+}
+
+func readLog(t *testing.T, runPath string) []byte {
+	t.Helper()
+	log, err := os.ReadFile(filepath.Join(runPath, "coordinator.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return log
+}
+
+func TestCheckpointResume(t *testing.T) {
+	dir := t.TempDir()
+	const frames = 12
+
+	c, workers := startRun(t, testSettings(dir, "whole", task.Row, frames), 1)
+	waitForRun(t, c, workers)
+	want := readImages(t, filepath.Join(dir, "whole"))
+
+	s := testSettings(dir, "resumed", task.Row, frames)
+	runPath := filepath.Join(dir, "resumed")
+	c, workers = startRun(t, s, 1)
+	cp := stopAfterFirstImage(t, c, workers, runPath)
+	if cp.ImageCompletedCount == 0 || cp.ImageCompletedCount == frames || cp.ImageCount != frames {
+		t.Fatalf("the checkpoint has %d of %d images completed, want part of %d", cp.ImageCompletedCount, cp.ImageCount, frames)
+	}
+
+	// Stopping the resumed run straight away writes a new checkpoint, the one it resumed from is kept until then
+	c, workers = startRun(t, s, 1)
+	if _, err := os.Stat(filepath.Join(runPath, "checkpoint.json")); err != nil {
+		t.Errorf("the checkpoint was removed when the run resumed: %s", err)
+	}
+	c.Shutdown()
+	waitForRun(t, c, workers)
+	next := readCheckpoint(t, runPath)
+	if next.Folder == cp.Folder || next.ImageCompletedCount < cp.ImageCompletedCount {
+		t.Errorf("the second checkpoint has folder %s and %d images completed, the first %s and %d", next.Folder, next.ImageCompletedCount, cp.Folder, cp.ImageCompletedCount)
+	}
+	if _, err := os.Stat(filepath.Join(runPath, cp.Folder)); !os.IsNotExist(err) {
+		t.Errorf("the images of the first checkpoint were left behind: %v", err)
+	}
+
+	c, workers = startRun(t, s, 2)
+	waitForRun(t, c, workers)
+	compareImages(t, readImages(t, runPath), want)
+	if !bytes.Contains(readLog(t, runPath), []byte("Resuming the run")) {
+		t.Error("the run started over instead of resuming")
+	}
+	for _, left := range []string{"checkpoint.json", next.Folder} {
+		if _, err := os.Stat(filepath.Join(runPath, left)); !os.IsNotExist(err) {
+			t.Errorf("%s was left behind: %v", left, err)
+		}
+	}
+}
+
+func TestCheckpointOtherSettings(t *testing.T) {
+	dir := t.TempDir()
+	const frames = 12
+	deeper := func(s map[string]interface{}) map[string]interface{} {
+		s["MandelbrotSettings"].(map[string]interface{})["MaxIterations"] = 300
+		return s
+	}
+
+	c, workers := startRun(t, deeper(testSettings(dir, "whole", task.Row, frames)), 1)
+	waitForRun(t, c, workers)
+	want := readImages(t, filepath.Join(dir, "whole"))
+
+	// The image and task counts stay the same, the pixels do not
+	runPath := filepath.Join(dir, "changed")
+	c, workers = startRun(t, testSettings(dir, "changed", task.Row, frames), 1)
+	stopAfterFirstImage(t, c, workers, runPath)
+	c, workers = startRun(t, deeper(testSettings(dir, "changed", task.Row, frames)), 1)
+	waitForRun(t, c, workers)
+	compareImages(t, readImages(t, runPath), want)
+	if !bytes.Contains(readLog(t, runPath), []byte("different settings, starting over")) {
+		t.Error("the run resumed a checkpoint of other settings")
+	}
+}
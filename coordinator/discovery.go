@@ -0,0 +1,46 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/misc"
+	"DistributedMandelbrot/transport"
+	"time"
+)
+
+// discoverySettings
+// The coordinator announces its address and run name on the multicast Group every Interval seconds so workers without
+// a CoordinatorAddress can find it on the local network. Disabled turns the announcements off
+type discoverySettings struct {
+	Disabled bool
+	Group    string
+	Interval uint
+}
+
+func (ds *discoverySettings) Verify() error {
+	if ds.Group == "" {
+		ds.Group = misc.DefaultDiscoveryGroup
+	}
+	if ds.Interval == 0 {
+		ds.Interval = 2
+	}
+	return nil
+}
+
+// advertise
+// Starts announcing the coordinator. Workers in the same process do not need it
+func (c *Coordinator) advertise() {
+	ds := c.settings.DiscoverySettings
+	if _, tcp := c.transport.(transport.TCP); ds.Disabled || !tcp {
+		return
+	}
+	beacon := misc.Beacon{
+		Address: c.settings.ServerAddress,
+		RunName: c.settings.RunName,
+	}
+	advertiser, err := misc.NewAdvertiser(beacon, ds.Group, time.Duration(ds.Interval)*time.Second, c.logger)
+	if err != nil {
+		c.logger.Warningf("Unable to announce the coordinator on %s, workers need its address: %s", ds.Group, err)
+		return
+	}
+	c.advertiser = advertiser
+	c.logger.Infof("Announcing run %s on %s", c.settings.RunName, ds.Group)
+}
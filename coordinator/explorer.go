@@ -0,0 +1,298 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/mandelbrot"
+	"DistributedMandelbrot/misc"
+	"DistributedMandelbrot/task"
+	"DistributedMandelbrot/transport"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/BrugadaSyndrome/bslogger"
+	gimage "image"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed explorer.html
+var explorerPage []byte
+
+// The tile at zoom 0 covers this square of the complex plane. Each zoom level splits every tile into four
+const (
+	explorerLeft = -2.5
+	explorerSide = 4.0
+	explorerTop  = -2.0
+)
+
+// Largest list of locations the export takes, a few thousand locations fit easily
+const maxExportBody = 1 << 20
+
+// explorerSettings
+// The explorer serves a pan and zoom map of the set on Address. Its tiles are calculated by the connected workers
+type explorerSettings struct {
+	Address     string
+	TileSize    uint
+	TileTimeout uint // Seconds to wait for a worker to calculate a tile
+}
+
+func (es *explorerSettings) Verify() error {
+	if es.Address == "" {
+		es.Address = "127.0.0.1:8080"
+	}
+	if es.TileSize == 0 {
+		es.TileSize = 256
+	}
+	if es.TileTimeout == 0 {
+		es.TileTimeout = 60
+	}
+	return nil
+}
+
+// explorerLocation
+// A spot picked in the explorer. Magnification is that of a frame showing the same area the explorer showed
+type explorerLocation struct {
+	Magnification float64
+	X             float64
+	Y             float64
+}
+
+type explorerExport struct {
+	Keyframes bool
+	Locations []explorerLocation
+}
+
+// NewExplorer
+// Starts a coordinator that never runs out of tasks. Instead of rendering a run it hands out the tiles the explorer
+// page asks for, so zoom targets can be found by browsing and exported as a settings file for a coordinator.
+func NewExplorer(settingsFile string) *Coordinator {
+	settings := NewSettings(settingsFile)
+
+	explorer := &Coordinator{
+		clients:        make(map[string]transport.Worker),
+		connectors:     make(map[string]*misc.Connector),
+		drained:        make(chan struct{}),
+		handOutTimes:   make(map[string]map[uint]time.Time),
+		logger:         bslogger.NewLogger("Explorer", bslogger.Normal, nil),
+		mandelbrot:     mandelbrot.NewMandelbrot(settings.MandelbrotSettings),
+		scheduler:      newScheduler(settings.SchedulerSettings),
+		settings:       settings,
+		shutdown:       make(chan struct{}),
+		tasksHandedOut: make(map[string]map[uint]task.Task),
+		tasksDone:      make(chan task.Task, 1000),
+		tileRequests:   make(map[uint]chan task.Task),
+		transport:      transport.TCP{},
+		workerWait:     &sync.WaitGroup{},
+		workers:        make(map[string]*workerState),
+	}
+
+	// Start up the rpc tcp server to allow workers to communicate with the explorer
+	explorer.listen()
+	explorer.listenHTTP()
+	explorer.advertise()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", explorer.serveExplorerPage)
+	mux.HandleFunc("/info", explorer.serveExplorerInfo)
+	mux.HandleFunc("/tile/", explorer.serveExplorerTile)
+	mux.HandleFunc("/export", explorer.serveExplorerExport)
+	go func() {
+		misc.CheckError(http.ListenAndServe(settings.ExplorerSettings.Address, mux), explorer.logger, misc.Fatal)
+	}()
+	explorer.logger.Infof("Explorer is running on http://%s", settings.ExplorerSettings.Address)
+
+	go explorer.tickers()
+	go explorer.deliverTiles()
+
+	return explorer
+}
+
+// deliverTiles
+// Hands each returned tile task to the request waiting for it
+func (c *Coordinator) deliverTiles() {
+	for taskReceived := range c.tasksDone {
+		c.mutex.Lock()
+		c.taskIngestedCount++
+		delete(c.tasksHandedOut[taskReceived.WorkerAddress], taskReceived.ID)
+		request, ok := c.tileRequests[taskReceived.ID]
+		delete(c.tileRequests, taskReceived.ID)
+		c.mutex.Unlock()
+
+		// Nobody is waiting when the browser gave up on the tile
+		if ok {
+			request <- taskReceived
+		}
+	}
+}
+
+func (c *Coordinator) serveExplorerPage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err := w.Write(explorerPage)
+	misc.CheckError(err, c.logger, misc.Debug)
+}
+
+// serveExplorerInfo
+// Tells the page the tile size and the shape of the frames it is picking locations for
+func (c *Coordinator) serveExplorerInfo(w http.ResponseWriter, r *http.Request) {
+	info := map[string]interface{}{
+		"Height":   c.settings.MandelbrotSettings.Height,
+		"Left":     explorerLeft,
+		"Side":     explorerSide,
+		"TileSize": c.settings.ExplorerSettings.TileSize,
+		"Top":      explorerTop,
+		"Width":    c.settings.MandelbrotSettings.Width,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	misc.CheckError(json.NewEncoder(w).Encode(info), c.logger, misc.Debug)
+}
+
+// serveExplorerTile
+// Calculates the tile at /tile/zoom/x/y on a worker and returns it as a PNG
+func (c *Coordinator) serveExplorerTile(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/tile/"), ".png"), "/")
+	if len(parts) != 3 {
+		http.Error(w, "tiles are requested as /tile/zoom/x/y", http.StatusBadRequest)
+		return
+	}
+	zoom, zoomErr := strconv.ParseUint(parts[0], 10, 8)
+	x, xErr := strconv.ParseInt(parts[1], 10, 64)
+	y, yErr := strconv.ParseInt(parts[2], 10, 64)
+	if zoomErr != nil || xErr != nil || yErr != nil || zoom > 52 {
+		http.Error(w, "invalid tile coordinates", http.StatusBadRequest)
+		return
+	}
+
+	tile, err := c.renderExplorerTile(r, uint(zoom), x, y)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Cache-Control", "max-age=86400")
+	w.Header().Set("Content-Type", "image/png")
+	misc.CheckError(PNG.Encode(w, tile), c.logger, misc.Debug)
+}
+
+func (c *Coordinator) renderExplorerTile(r *http.Request, zoom uint, x int64, y int64) (*gimage.RGBA, error) {
+	tileSize := c.settings.ExplorerSettings.TileSize
+	side := explorerSide / math.Pow(2, float64(zoom))
+	pixelSize := side / float64(tileSize)
+	magnification := 1 / (pixelSize * float64(tileSize-1))
+
+	maxIterations := c.settings.MandelbrotSettings.MaxIterations
+	if c.settings.AutoIterations.Enabled {
+		maxIterations = c.settings.AutoIterations.Iterations(1/side, nil)
+	}
+
+	request := make(chan task.Task, 1)
+	c.mutex.Lock()
+	tileTask := task.NewTask(c.taskGeneratedCount, 0)
+	c.taskGeneratedCount++
+	c.tileRequests[tileTask.ID] = request
+	c.mutex.Unlock()
+	tileTask.Coloring = task.Coloring{PaletteDensity: 1}
+	tileTask.Height = tileSize
+	tileTask.MaxIterations = maxIterations
+	tileTask.Width = tileSize
+	centerX := explorerLeft + float64(x)*side + float64(tileSize)/2*pixelSize
+	centerY := explorerTop + float64(y)*side + float64(tileSize)/2*pixelSize
+	tileTask.AddTasksForTile(centerX, centerY, magnification, 0, 0, tileSize, tileSize)
+
+	// Tiles the browser gave up on are not calculated
+	forget := func() {
+		c.scheduler.Cancel(tileTask.ID)
+		c.mutex.Lock()
+		delete(c.tileRequests, tileTask.ID)
+		c.mutex.Unlock()
+	}
+	timeout := time.After(time.Duration(c.settings.ExplorerSettings.TileTimeout) * time.Second)
+	c.scheduler.Add(tileTask)
+
+	select {
+	case done := <-request:
+		tile := gimage.NewRGBA(gimage.Rect(0, 0, int(tileSize), int(tileSize)))
+		err := done.EachResult(func(result task.Pixel) {
+			tile.SetRGBA(int(result.Column), int(result.Row), result.Color)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return tile, nil
+	case <-r.Context().Done():
+		forget()
+		return nil, r.Context().Err()
+	case <-timeout:
+		forget()
+		c.logger.Warningf("No worker calculated tile %d/%d/%d in time", zoom, x, y)
+		return nil, errors.New("no worker calculated the tile in time")
+	}
+}
+
+// serveExplorerExport
+// Turns the picked locations into transitions, one from each location to the next, and returns a copy of the explorer
+// settings using them. The file is also saved to SavePath. Anyone who can reach the explorer can export, so the copy
+// leaves out the security settings and the addresses the explorer serves on
+func (c *Coordinator) serveExplorerExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "locations are exported with a POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var export explorerExport
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxExportBody)).Decode(&export); err != nil || len(export.Locations) == 0 {
+		http.Error(w, "expected a list of locations", http.StatusBadRequest)
+		return
+	}
+
+	exported := c.settings
+	exported.DiscoverySettings = discoverySettings{}
+	exported.ExplorerSettings.Address = ""
+	exported.HTTPSettings.Address = ""
+	exported.RunName = ""
+	exported.SecuritySettings = misc.SecuritySettings{}
+	exported.KeyframeSettings.Enabled = export.Keyframes
+	exported.TransitionSettings = make([]transitionSettings, 0, len(export.Locations))
+	for i, start := range export.Locations {
+		end := start
+		if i+1 < len(export.Locations) {
+			end = export.Locations[i+1]
+		} else if len(export.Locations) > 1 {
+			break
+		}
+		transition := transitionSettings{
+			EndX:               end.X,
+			EndY:               end.Y,
+			FrameCount:         1,
+			MagnificationEnd:   end.Magnification,
+			MagnificationStart: start.Magnification,
+			StartX:             start.X,
+			StartY:             start.Y,
+		}
+		misc.CheckError(transition.Verify(), c.logger, misc.Warning)
+		exported.TransitionSettings = append(exported.TransitionSettings, transition)
+	}
+
+	marshaledSettings, err := json.MarshalIndent(exported, "", "    ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	path := filepath.Join(c.settings.SavePath, fmt.Sprintf("explorer_%s.json", time.Now().Format("2006_01_02-03_04_05")))
+	if _, err = misc.WriteFile(path, marshaledSettings); err != nil {
+		c.logger.Warningf("Unable to save exported settings: %s", err)
+	} else {
+		c.logger.Infof("Exported %d locations to %s", len(export.Locations), path)
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(path)))
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(marshaledSettings)
+	misc.CheckError(err, c.logger, misc.Debug)
+}
@@ -0,0 +1,60 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/misc"
+	"encoding/json"
+	"github.com/BrugadaSyndrome/bslogger"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeExplorerExport(t *testing.T) {
+	c := &Coordinator{
+		logger: bslogger.NewLogger("Explorer", bslogger.Normal, nil),
+		settings: settings{
+			DiscoverySettings: discoverySettings{Group: "239.0.0.1:9999"},
+			ExplorerSettings:  explorerSettings{Address: "0.0.0.0:8080"},
+			HTTPSettings:      httpSettings{Address: "0.0.0.0:52000"},
+			RunName:           "explorer",
+			SavePath:          t.TempDir(),
+			SecuritySettings:  misc.SecuritySettings{CAFile: "ca.pem", CertFile: "cert.pem", KeyFile: "key.pem", Secret: "hunter2"},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "two locations", body: `{"Locations": [{"X": -0.5, "Magnification": 1}, {"X": -0.7, "Magnification": 8}]}`, status: http.StatusOK},
+		{name: "no locations", body: `{"Locations": []}`, status: http.StatusBadRequest},
+		{name: "body too large", body: `{"Locations": [` + strings.Repeat(`{"X": 0},`, maxExportBody/8) + `{}]}`, status: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c.serveExplorerExport(recorder, httptest.NewRequest(http.MethodPost, "/export", strings.NewReader(test.body)))
+			if recorder.Code != test.status {
+				t.Fatalf("answered %d, want %d", recorder.Code, test.status)
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+			if strings.Contains(recorder.Body.String(), "hunter2") || strings.Contains(recorder.Body.String(), "cert.pem") {
+				t.Error("the export holds the security settings")
+			}
+			var exported settings
+			if err := json.Unmarshal(recorder.Body.Bytes(), &exported); err != nil {
+				t.Fatal(err)
+			}
+			if exported.HTTPSettings.Address != "" || exported.ExplorerSettings.Address != "" || exported.DiscoverySettings.Group != "" {
+				t.Error("the export holds the addresses the explorer serves on")
+			}
+			if len(exported.TransitionSettings) != 1 || exported.TransitionSettings[0].MagnificationEnd != 8 {
+				t.Errorf("exported transitions %+v, want one zooming to 8", exported.TransitionSettings)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/misc"
+	"DistributedMandelbrot/task"
+)
+
+// frameMetadata
+// Describes how an image of the run was made. The metadata of every image is saved to frames.json in the run folder
+type frameMetadata struct {
+	CenterX       float64
+	CenterY       float64
+	Coloring      task.Coloring
+	ImageNumber   uint
+	Magnification float64
+	MaxIterations uint
+	Statistics    task.Statistics
+}
+
+// imagePlan
+// An image the workers are asked to calculate. This is usually a frame of the movie, but it can also be a keyframe that
+// frames are resampled from, in which case it has its own size.
+type imagePlan struct {
+	CenterX             float64
+	CenterY             float64
+	Coloring            task.Coloring
+	DetailMagnification float64 // Magnification the iteration limit is derived from
+	Height              uint
+	ImageNumber         uint
+	KeepIterations      bool
+	Magnification       float64
+	Width               uint
+}
+
+func newImagePlan(frame frameMetadata, width uint, height uint) imagePlan {
+	return imagePlan{
+		CenterX:             frame.CenterX,
+		CenterY:             frame.CenterY,
+		Coloring:            frame.Coloring,
+		DetailMagnification: frame.Magnification,
+		Height:              height,
+		ImageNumber:         frame.ImageNumber,
+		Magnification:       frame.Magnification,
+		Width:               width,
+	}
+}
+
+// planImages
+// Walks every transition to work out the center, magnification and coloring of each frame of the run, and decides
+// which images the workers need to calculate to make those frames
+func (c *Coordinator) planImages() {
+	width := c.settings.MandelbrotSettings.Width
+	height := c.settings.MandelbrotSettings.Height
+
+	var imageNumber uint = 1
+	keyframeNumber := c.imageCount + 1
+	for transitionStep := 0; transitionStep < len(c.settings.TransitionSettings); transitionStep++ {
+		// generate each image for this transition while zooming in exponentially
+		transition := c.settings.TransitionSettings[transitionStep]
+		magnification := transition.MagnificationStart
+		currentX := transition.StartX
+		currentY := transition.StartY
+
+		frames := make([]frameMetadata, 0, transition.FrameCount)
+		var currentFrame uint
+		for currentFrame = 1; currentFrame <= transition.FrameCount; currentFrame++ {
+			// Linear interpolation through the coordinates in the transition
+			t := float64(currentFrame) / float64(transition.FrameCount)
+
+			// zooming out
+			if transition.MagnificationStart > transition.MagnificationEnd {
+				currentX = misc.LerpFloat64(transition.StartX, transition.EndX, misc.EaseInExpo(t))
+				currentY = misc.LerpFloat64(transition.StartY, transition.EndY, misc.EaseInExpo(t))
+				magnification /= transition.MagnificationStep
+			}
+
+			frame := frameMetadata{
+				CenterX:       currentX,
+				CenterY:       currentY,
+				Coloring:      transition.Coloring(currentFrame),
+				ImageNumber:   imageNumber,
+				Magnification: magnification,
+			}
+			c.frames[imageNumber] = frame
+			frames = append(frames, frame)
+
+			// zooming in
+			if transition.MagnificationStart < transition.MagnificationEnd {
+				currentX = misc.LerpFloat64(transition.StartX, transition.EndX, misc.EaseOutExpo(t))
+				currentY = misc.LerpFloat64(transition.StartY, transition.EndY, misc.EaseOutExpo(t))
+				magnification *= transition.MagnificationStep
+			}
+
+			imageNumber++
+		}
+
+		switch {
+		case transition.IsColorOnly() && len(frames) > 1:
+			// Color only transitions calculate the first frame and recolor its iterations for the rest of the frames
+			plan := newImagePlan(frames[0], width, height)
+			plan.KeepIterations = true
+			c.imagePlans = append(c.imagePlans, plan)
+			recolors := make([]recolorTask, 0, len(frames)-1)
+			for _, frame := range frames[1:] {
+				recolors = append(recolors, recolorTask{
+					Coloring:    frame.Coloring,
+					ImageNumber: frame.ImageNumber,
+				})
+			}
+			c.recolorTasks[frames[0].ImageNumber] = recolors
+		case c.settings.KeyframeSettings.Enabled && transition.MagnificationStart != transition.MagnificationEnd:
+			// Zooming transitions can be resampled from a few larger keyframes instead of calculating every frame
+			for _, k := range c.settings.KeyframeSettings.planKeyframes(frames, width, height, keyframeNumber) {
+				c.keyframes[k.ImageNumber] = k
+				c.imagePlans = append(c.imagePlans, k.imagePlan())
+				keyframeNumber++
+			}
+		default:
+			for _, frame := range frames {
+				c.imagePlans = append(c.imagePlans, newImagePlan(frame, width, height))
+			}
+		}
+	}
+}
+
+// taskCountForImage
+// Returns the number of tasks generateTasks splits the image into
+func (c *Coordinator) taskCountForImage(plan imagePlan) uint {
+	switch c.settings.TaskGeneration {
+	case task.Row:
+		return plan.Height
+	case task.Column:
+		return plan.Width
+	case task.Image:
+		return 1
+	case task.Grid:
+		return task.GridSize * task.GridSize
+	default:
+		c.logger.Fatalf("Unknown generation type: %d", c.settings.TaskGeneration)
+	}
+	return 0
+}
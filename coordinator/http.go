@@ -0,0 +1,333 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/mandelbrot"
+	"DistributedMandelbrot/misc"
+	"DistributedMandelbrot/task"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Largest request body the HTTP server reads, enough for the results of a whole image with its iterations
+const maxHTTPBody = 256 << 20
+
+// httpSettings
+// Serves the worker protocol as JSON over HTTP on Address so workers can be written without Go's rpc encoding. The
+// schema is described in the README. HTTP workers cannot be called back for roll call, so one that has not made a
+// request for WorkerTimeout seconds is dropped and its tasks are handed to other workers. BrowserWorkerPath is a folder
+// served on / so browsers can load the browser worker from the coordinator, AllowOrigin lets a page on another origin
+// make requests ("*" allows any)
+type httpSettings struct {
+	Address           string // Empty turns the HTTP server off
+	AllowOrigin       string
+	BrowserWorkerPath string
+	WorkerTimeout     uint
+}
+
+func (hs *httpSettings) Verify(security misc.SecuritySettings) error {
+	if hs.WorkerTimeout == 0 {
+		hs.WorkerTimeout = 120
+	}
+	// The secret keys the handshake of the rpc connections, a bearer token read off plain HTTP would let anyone in
+	if hs.Address != "" && security.Secret != "" && security.CertFile == "" {
+		return errors.New("serving HTTP workers with a Secret needs certificates, the secret would be sent in the clear")
+	}
+	return nil
+}
+
+// listenHTTP
+// Starts the HTTP server for workers when an address is set. It uses the same certificates and secret as the rpc
+// server, the secret is sent as a bearer token and so is only accepted over HTTPS
+func (c *Coordinator) listenHTTP() {
+	address := c.settings.HTTPSettings.Address
+	if address == "" {
+		return
+	}
+	config, err := c.settings.SecuritySettings.TLSConfig()
+	misc.CheckError(err, c.logger, misc.Fatal)
+	listener, err := net.Listen("tcp", address)
+	misc.CheckError(err, c.logger, misc.Fatal)
+	if config != nil {
+		listener = tls.NewListener(listener, config)
+	}
+
+	api := http.NewServeMux()
+	api.HandleFunc("/v1/register", c.serveHTTPRegister)
+	api.HandleFunc("/v1/mandelbrot", c.serveHTTPMandelbrot)
+	api.HandleFunc("/v1/benchmark", c.serveHTTPBenchmark)
+	api.HandleFunc("/v1/tasks", c.serveHTTPTasks)
+	api.HandleFunc("/v1/results", c.serveHTTPResults)
+	api.HandleFunc("/v1/rollcall", c.serveHTTPRollCall)
+	api.HandleFunc("/v1/deregister", c.serveHTTPDeRegister)
+	// A bearer token over plain HTTP can be read off the network, so workers are only controlled over HTTPS with a
+	// client certificate. Control mode works either way, it goes through the rpc server
+	if config != nil {
+		api.HandleFunc("/v1/control", c.serveHTTPControl)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/v1/", c.authorizeHTTP(api))
+	if c.settings.HTTPSettings.BrowserWorkerPath != "" {
+		mux.Handle("/", http.FileServer(http.Dir(c.settings.HTTPSettings.BrowserWorkerPath)))
+	}
+	c.httpServer = &http.Server{Handler: mux}
+	go func() {
+		err := c.httpServer.Serve(listener)
+		if !errors.Is(err, http.ErrServerClosed) {
+			misc.CheckError(err, c.logger, misc.Error)
+		}
+	}()
+	c.logger.Infof("Serving HTTP workers on %s", address)
+}
+
+// authorizeHTTP
+// Turns away requests without the secret when one is set and answers the browser's preflight requests for an allowed
+// origin
+func (c *Coordinator) authorizeHTTP(next http.Handler) http.Handler {
+	expected := []byte("Bearer " + c.settings.SecuritySettings.Secret)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if origin := c.settings.HTTPSettings.AllowOrigin; origin != "" {
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		if c.settings.SecuritySettings.Secret != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "wrong or missing secret", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decodeHTTP
+// Reads the JSON body of a POST into v. Answers the request with an error and returns false when it cannot
+func decodeHTTP(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "requests are made with a POST", http.StatusMethodNotAllowed)
+		return false
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxHTTPBody)).Decode(v); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body - %s", err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (c *Coordinator) encodeHTTP(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	misc.CheckError(json.NewEncoder(w).Encode(v), c.logger, misc.Debug)
+}
+
+// beginHTTPCall
+// Marks a request of an HTTP worker as in progress so the worker is not dropped while it waits for a task. Answers the
+// request with an error and returns false when the address is not a registered HTTP worker
+func (c *Coordinator) beginHTTPCall(w http.ResponseWriter, workerAddress string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	state, ok := c.workers[workerAddress]
+	if _, callBack := c.clients[workerAddress]; !ok || callBack {
+		http.Error(w, fmt.Sprintf("worker %s is not registered", workerAddress), http.StatusNotFound)
+		return false
+	}
+	state.Calls++
+	state.LastSeen = time.Now()
+	return true
+}
+
+func (c *Coordinator) endHTTPCall(workerAddress string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if state, ok := c.workers[workerAddress]; ok {
+		state.Calls--
+		state.LastSeen = time.Now()
+	}
+}
+
+// dropSilentHTTPWorkers
+// Deregisters the HTTP workers that have not made a request for WorkerTimeout seconds
+func (c *Coordinator) dropSilentHTTPWorkers() {
+	timeout := time.Duration(c.settings.HTTPSettings.WorkerTimeout) * time.Second
+	var silent []string
+	c.mutex.Lock()
+	for workerAddress, state := range c.workers {
+		if _, callBack := c.clients[workerAddress]; !callBack && state.Calls == 0 && time.Since(state.LastSeen) > timeout {
+			silent = append(silent, workerAddress)
+		}
+	}
+	c.mutex.Unlock()
+
+	for _, workerAddress := range silent {
+		c.logger.Warningf("HTTP worker %s has not made a request in %s", workerAddress, timeout)
+		var nothing misc.Nothing
+		misc.CheckError(c.DeRegisterWorker(workerAddress, &nothing), c.logger, misc.Warning)
+	}
+}
+
+func (c *Coordinator) serveHTTPRegister(w http.ResponseWriter, r *http.Request) {
+	var registration misc.Registration
+	if !decodeHTTP(w, r, &registration) {
+		return
+	}
+	// IDs are the only thing telling HTTP workers apart, so they must not be guessed to act for another worker
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	registration.Address = fmt.Sprintf("http-%x", id)
+
+	reply := misc.HTTPRegistrationReply{WorkerID: registration.Address}
+	err := c.registerWorker(registration, &reply.RegistrationReply, false)
+	if errors.Is(err, errShuttingDown) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	c.encodeHTTP(w, reply)
+}
+
+func (c *Coordinator) serveHTTPMandelbrot(w http.ResponseWriter, r *http.Request) {
+	var settings mandelbrot.Settings
+	misc.CheckError(c.GetMandelbrotSettings(misc.Nothing{}, &settings), c.logger, misc.Warning)
+	c.encodeHTTP(w, settings)
+}
+
+func (c *Coordinator) serveHTTPBenchmark(w http.ResponseWriter, r *http.Request) {
+	var report misc.BenchmarkReport
+	if !decodeHTTP(w, r, &report) || !c.beginHTTPCall(w, report.Address) {
+		return
+	}
+	defer c.endHTTPCall(report.Address)
+
+	var nothing misc.Nothing
+	if err := c.ReportBenchmark(report, &nothing); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveHTTPTasks
+// Waits for the first task like GetTasks. Answers 410 Gone once every task is handed out and 403 Forbidden when the
+// worker is quarantined, the worker should deregister either way
+func (c *Coordinator) serveHTTPTasks(w http.ResponseWriter, r *http.Request) {
+	var request misc.TaskRequest
+	if !decodeHTTP(w, r, &request) || !c.beginHTTPCall(w, request.Address) {
+		return
+	}
+	defer c.endHTTPCall(request.Address)
+	if request.Count == 0 {
+		request.Count = 1
+	}
+
+	var tasks []task.Task
+	err := c.GetTasks(request, &tasks)
+	if errors.Is(err, errQuarantined) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, errShuttingDown) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	c.encodeHTTP(w, tasks)
+}
+
+// serveHTTPResults
+// Takes finished tasks back. Only tasks handed to the worker and still expected from it are accepted
+func (c *Coordinator) serveHTTPResults(w http.ResponseWriter, r *http.Request) {
+	var results misc.HTTPResults
+	if !decodeHTTP(w, r, &results) || !c.beginHTTPCall(w, results.Address) {
+		return
+	}
+	defer c.endHTTPCall(results.Address)
+
+	c.mutex.Lock()
+	for i := range results.Tasks {
+		done := &results.Tasks[i]
+		handedOut, ok := c.tasksHandedOut[results.Address][done.ID]
+		if !ok {
+			c.mutex.Unlock()
+			http.Error(w, fmt.Sprintf("task %d is not handed out to %s", done.ID, results.Address), http.StatusConflict)
+			return
+		}
+		if done.Encoding == task.RawEncoding && len(done.Results) != len(handedOut.Tasks) {
+			c.mutex.Unlock()
+			http.Error(w, fmt.Sprintf("task %d has %d results for %d pixels", done.ID, len(done.Results), len(handedOut.Tasks)), http.StatusBadRequest)
+			return
+		}
+		// Only the results come from the worker, the rest of the task is the one handed out
+		handedOut.Duration = done.Duration
+		handedOut.Encoded = done.Encoded
+		handedOut.Encoding = done.Encoding
+		handedOut.Results = done.Results
+		handedOut.Statistics = done.Statistics
+		*done = handedOut
+	}
+	c.mutex.Unlock()
+
+	var nothing misc.Nothing
+	if err := c.ReturnTasks(results.Tasks, &nothing); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveHTTPRollCall
+// Keeps a worker that is busy calculating from being dropped
+func (c *Coordinator) serveHTTPRollCall(w http.ResponseWriter, r *http.Request) {
+	var worker misc.HTTPWorker
+	if !decodeHTTP(w, r, &worker) || !c.beginHTTPCall(w, worker.Address) {
+		return
+	}
+	c.endHTTPCall(worker.Address)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Coordinator) serveHTTPDeRegister(w http.ResponseWriter, r *http.Request) {
+	var worker misc.HTTPWorker
+	if !decodeHTTP(w, r, &worker) || !c.beginHTTPCall(w, worker.Address) {
+		return
+	}
+	c.endHTTPCall(worker.Address)
+
+	var nothing misc.Nothing
+	if err := c.DeRegisterWorker(worker.Address, &nothing); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveHTTPControl
+// Lets an operator control the workers, it is not a call HTTP workers make
+func (c *Coordinator) serveHTTPControl(w http.ResponseWriter, r *http.Request) {
+	var request misc.ControlRequest
+	if !decodeHTTP(w, r, &request) {
+		return
+	}
+	var stats []misc.WorkerStats
+	if err := c.ControlWorkers(request, &stats); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.encodeHTTP(w, stats)
+}
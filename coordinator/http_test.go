@@ -0,0 +1,36 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/misc"
+	"testing"
+)
+
+func TestHTTPSettingsVerify(t *testing.T) {
+	withCertificates := misc.SecuritySettings{CAFile: "ca.pem", CertFile: "cert.pem", KeyFile: "key.pem", Secret: "s"}
+	tests := []struct {
+		name     string
+		address  string
+		security misc.SecuritySettings
+		valid    bool
+	}{
+		{name: "off", security: misc.SecuritySettings{Secret: "s"}, valid: true},
+		{name: "open", address: "127.0.0.1:52000", valid: true},
+		{name: "secret over HTTPS", address: "127.0.0.1:52000", security: withCertificates, valid: true},
+		{name: "secret over plain HTTP", address: "127.0.0.1:52000", security: misc.SecuritySettings{Secret: "s"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hs := httpSettings{Address: test.address}
+			err := hs.Verify(test.security)
+			if test.valid && err != nil {
+				t.Errorf("Verify: %s", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("a secret sent in the clear was accepted")
+			}
+			if hs.WorkerTimeout == 0 {
+				t.Error("WorkerTimeout has no default")
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package coordinator
+
+import (
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+const (
+	JPEG ImageFormat = iota
+	PNG
+)
+
+type ImageFormat int
+
+func (f ImageFormat) String() string {
+	return []string{
+		"JPEG", "PNG",
+	}[f]
+}
+
+func (f ImageFormat) Extension() string {
+	return []string{
+		"jpg", "png",
+	}[f]
+}
+
+// Encode
+// JPEG images are always opaque, use PNG to keep the alpha channel
+func (f ImageFormat) Encode(w io.Writer, img image.Image) error {
+	switch f {
+	case PNG:
+		return png.Encode(w, img)
+	default:
+		return jpeg.Encode(w, img, nil)
+	}
+}
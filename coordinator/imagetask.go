@@ -1,8 +1,22 @@
 package coordinator
 
-import "image"
+import (
+	"DistributedMandelbrot/task"
+	"image"
+)
 
 type imageTask struct {
-	Image      *image.RGBA
-	PixelsLeft uint
+	Image         *image.RGBA
+	Iterations    [][]float64 // Escape time samples per pixel, only kept when the image will be recolored
+	MaxIterations uint
+	PixelsLeft    uint
+	Statistics    task.Statistics
+}
+
+// recolorTask
+// A frame of a color only transition. It is colored by the coordinator from the iterations of an image that was already
+// calculated instead of being sent to the workers.
+type recolorTask struct {
+	Coloring    task.Coloring
+	ImageNumber uint
 }
@@ -0,0 +1,84 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/misc"
+	"DistributedMandelbrot/task"
+	"path/filepath"
+	"time"
+)
+
+// journalFile
+// Name of the journal in the run folder, the report reads every other .jsonl file there as the journal of a worker
+const journalFile = "journal.jsonl"
+
+// openJournal
+// Starts the journal of the run. A resumed run carries on with the journal it has
+func (c *Coordinator) openJournal(resumed bool) {
+	journal, err := misc.NewJournal(filepath.Join(c.settings.SavePath, c.settings.RunName, journalFile), misc.CoordinatorSource, resumed, c.logger)
+	if err != nil {
+		c.logger.Warningf("Unable to open the journal, the run is not journaled: %s", err)
+		return
+	}
+	c.journal = journal
+	event := misc.Event{Kind: misc.RunStarted}
+	if resumed {
+		event.Reason = "resumed from checkpoint"
+	}
+	c.journal.Record(event)
+}
+
+func (c *Coordinator) closeJournal(reason string) {
+	c.journal.Record(misc.Event{Kind: misc.RunStopped, Reason: reason})
+	misc.CheckError(c.journal.Close(), c.logger, misc.Warning)
+}
+
+// journalHandOut
+// Records the task handed to the worker and when, so the time until it comes back can be recorded. Call with the mutex
+// held
+func (c *Coordinator) journalHandOut(workerAddress string, t task.Task) {
+	if times, ok := c.handOutTimes[workerAddress]; ok {
+		times[t.ID] = time.Now()
+	}
+	c.journal.Record(misc.Event{Image: t.ImageNumber, Kind: misc.TaskIssued, Task: t.ID, Worker: workerAddress})
+}
+
+// journalReturn
+// Records the task the worker sent back. A duplicate is a copy of a task another worker returned first
+func (c *Coordinator) journalReturn(t task.Task, duplicate bool) {
+	event := misc.Event{
+		Duration: t.Duration,
+		Image:    t.ImageNumber,
+		Kind:     misc.TaskReturned,
+		Task:     t.ID,
+		Worker:   t.WorkerAddress,
+	}
+	if duplicate {
+		event.Reason = "duplicate"
+	}
+	c.mutex.Lock()
+	if handedOut, ok := c.handOutTimes[t.WorkerAddress][t.ID]; ok {
+		event.Elapsed = time.Since(handedOut)
+		delete(c.handOutTimes[t.WorkerAddress], t.ID)
+	}
+	c.mutex.Unlock()
+	c.journal.Record(event)
+}
+
+// journalRequeue
+// Records the task taken back from the worker. Tasks the worker returned that are still being ingested are not
+// requeued, they have no hand out time any more. Call with the mutex held
+func (c *Coordinator) journalRequeue(workerAddress string, t task.Task, reason string) {
+	handedOut, ok := c.handOutTimes[workerAddress][t.ID]
+	if !ok {
+		return
+	}
+	delete(c.handOutTimes[workerAddress], t.ID)
+	c.journal.Record(misc.Event{
+		Elapsed: time.Since(handedOut),
+		Image:   t.ImageNumber,
+		Kind:    misc.TaskRequeued,
+		Reason:  reason,
+		Task:    t.ID,
+		Worker:  workerAddress,
+	})
+}
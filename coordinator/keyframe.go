@@ -0,0 +1,269 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/misc"
+	"DistributedMandelbrot/task"
+	gimage "image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// keyframeSettings
+// Instead of calculating every frame of a zoom, the workers calculate keyframes ZoomFactor times larger than a frame
+// every ZoomFactor steps of magnification. Each frame is then resampled from the keyframe that has at least as much
+// detail as the frame needs and blended with the next keyframe, in the style of Kalles Fraktaler and zoomasm. A
+// log-polar (exponential map) strip is not offered: keyframes are ordinary images, so they go through the same tasks,
+// spot checks, spilling and checkpoints as every other image.
+type keyframeSettings struct {
+	Enabled    bool
+	ZoomFactor float64
+}
+
+func (ks *keyframeSettings) Verify() error {
+	if ks.ZoomFactor <= 1 {
+		ks.ZoomFactor = 2
+	}
+	return nil
+}
+
+// keyframe
+// A keyframe covers the same area as its least magnified frame, but has the pixel density of a frame at Detail
+// magnification so every frame in its span is resampled down rather than up.
+type keyframe struct {
+	CenterX       float64
+	CenterY       float64
+	Coloring      task.Coloring
+	Detail        float64
+	Frames        []frameMetadata // Frames resampled from this keyframe
+	Height        uint
+	Image         *gimage.RGBA // Set once the keyframe has been calculated, released when no longer needed
+	ImageNumber   uint
+	Iterations    [][]float64 // Kept when the frames need to be recolored
+	Magnification float64
+	MaxIterations uint
+	Next          uint // Image number of the next more magnified keyframe, zero for the last one
+	Previous      uint // Image number of the next less magnified keyframe, zero for the first one
+	Resampled     bool
+	Width         uint
+}
+
+// planKeyframes
+// Groups the frames of a transition by magnification. Each keyframe is used for the frames with a magnification in
+// [Detail / ZoomFactor, Detail).
+func (ks *keyframeSettings) planKeyframes(frames []frameMetadata, width uint, height uint, firstImageNumber uint) []*keyframe {
+	sorted := make([]frameMetadata, len(frames))
+	copy(sorted, frames)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Magnification < sorted[j].Magnification })
+
+	// Frames that change colors need the keyframe iterations to be recolored
+	keepIterations := false
+	for _, frame := range frames {
+		if frame.Coloring != frames[0].Coloring {
+			keepIterations = true
+		}
+	}
+
+	keyframeWidth := uint(math.Ceil(float64(width) * ks.ZoomFactor))
+	keyframeHeight := uint(math.Ceil(float64(height) * ks.ZoomFactor))
+	scale := float64(shorterSide(width, height)-1) / float64(shorterSide(keyframeWidth, keyframeHeight)-1)
+
+	keyframes := make([]*keyframe, 0)
+	detail := sorted[0].Magnification * ks.ZoomFactor
+	for i := 0; i < len(sorted); detail *= ks.ZoomFactor {
+		span := make([]frameMetadata, 0)
+		for ; i < len(sorted) && sorted[i].Magnification < detail; i++ {
+			span = append(span, sorted[i])
+		}
+		if len(span) == 0 {
+			continue
+		}
+
+		// Center on the least magnified frame of the span since it covers the largest area
+		k := &keyframe{
+			CenterX:       span[0].CenterX,
+			CenterY:       span[0].CenterY,
+			Coloring:      span[0].Coloring,
+			Detail:        detail,
+			Frames:        span,
+			Height:        keyframeHeight,
+			ImageNumber:   firstImageNumber + uint(len(keyframes)),
+			Magnification: detail * scale,
+			Width:         keyframeWidth,
+		}
+		if keepIterations {
+			k.Iterations = make([][]float64, 0)
+		}
+		if len(keyframes) > 0 {
+			k.Previous = keyframes[len(keyframes)-1].ImageNumber
+			keyframes[len(keyframes)-1].Next = k.ImageNumber
+		}
+		keyframes = append(keyframes, k)
+	}
+	return keyframes
+}
+
+func (k *keyframe) imagePlan() imagePlan {
+	return imagePlan{
+		CenterX:             k.CenterX,
+		CenterY:             k.CenterY,
+		Coloring:            k.Coloring,
+		DetailMagnification: k.Detail,
+		Height:              k.Height,
+		ImageNumber:         k.ImageNumber,
+		KeepIterations:      k.Iterations != nil,
+		Magnification:       k.Magnification,
+		Width:               k.Width,
+	}
+}
+
+// sample
+// Returns the color of the keyframe at the complex point (x, y), averaged over the area a frame pixel of frameScale
+// covers. ok is false when the point is outside the keyframe, unless clamp is set.
+func (k *keyframe) sample(image *gimage.RGBA, x float64, y float64, frameScale float64, clamp bool) (color.RGBA, bool) {
+	scale := k.Magnification * float64(shorterSide(k.Width, k.Height)-1)
+	column := (x-k.CenterX)*scale + float64(k.Width)/2
+	row := (y-k.CenterY)*scale + float64(k.Height)/2
+	if !clamp && (column < 0 || row < 0 || column > float64(k.Width-1) || row > float64(k.Height-1)) {
+		return color.RGBA{}, false
+	}
+
+	// Bilinear samples on a 2x2 grid spread over the footprint of the frame pixel
+	footprint := scale / frameScale
+	colors := make([]color.RGBA, 0, 16)
+	weights := make([]float64, 0, 16)
+	for _, dx := range []float64{-0.25, 0.25} {
+		for _, dy := range []float64{-0.25, 0.25} {
+			c := math.Max(0, math.Min(float64(k.Width-1), column+dx*footprint))
+			r := math.Max(0, math.Min(float64(k.Height-1), row+dy*footprint))
+			c0, r0 := math.Floor(c), math.Floor(r)
+			fc, fr := c-c0, r-r0
+			c1, r1 := math.Min(c0+1, float64(k.Width-1)), math.Min(r0+1, float64(k.Height-1))
+			for _, neighbor := range []struct {
+				Column float64
+				Row    float64
+				Weight float64
+			}{
+				{Column: c0, Row: r0, Weight: (1 - fc) * (1 - fr)},
+				{Column: c1, Row: r0, Weight: fc * (1 - fr)},
+				{Column: c0, Row: r1, Weight: (1 - fc) * fr},
+				{Column: c1, Row: r1, Weight: fc * fr},
+			} {
+				colors = append(colors, misc.Unpremultiply(image.RGBAAt(int(neighbor.Column), int(neighbor.Row))))
+				weights = append(weights, neighbor.Weight)
+			}
+		}
+	}
+	return misc.WeightedAverageColors(colors, weights), true
+}
+
+// coloredImage
+// Returns the keyframe colored for the frame, recoloring from the kept iterations when the frame changes colors
+func (c *Coordinator) coloredImage(k *keyframe, coloring task.Coloring) *gimage.RGBA {
+	if coloring == k.Coloring || k.Iterations == nil {
+		return k.Image
+	}
+	return c.recolorImage(k.Iterations, coloring, k.MaxIterations, k.Image.Rect)
+}
+
+// resampleFrame
+// Makes a frame from its keyframe, cross-faded into the next keyframe by how far the frame is through the span of its
+// keyframe in log magnification so detail does not pop in at the start of each span. Points the keyframe does not cover,
+// because the center moved during the span, come from the previous keyframe which covers a larger area; points the next
+// keyframe does not cover only come from the keyframe.
+func (c *Coordinator) resampleFrame(frame frameMetadata, k *keyframe, previous *keyframe, next *keyframe) *gimage.RGBA {
+	width := c.rectangle.Dx()
+	height := c.rectangle.Dy()
+	frameScale := frame.Magnification * float64(shorterSide(uint(width), uint(height))-1)
+
+	source := c.coloredImage(k, frame.Coloring)
+	var previousSource, nextSource *gimage.RGBA
+	if previous != nil {
+		previousSource = c.coloredImage(previous, frame.Coloring)
+	}
+	blend := 0.0
+	if next != nil {
+		nextSource = c.coloredImage(next, frame.Coloring)
+		zoomFactor := next.Detail / k.Detail
+		blend = math.Log(frame.Magnification*zoomFactor/k.Detail) / math.Log(zoomFactor)
+		blend = math.Max(0, math.Min(1, blend))
+	}
+
+	image := gimage.NewRGBA(c.rectangle)
+	for row := 0; row < height; row++ {
+		for column := 0; column < width; column++ {
+			x := frame.CenterX + (float64(column)-float64(width)/2)/frameScale
+			y := frame.CenterY + (float64(row)-float64(height)/2)/frameScale
+			pixel, ok := k.sample(source, x, y, frameScale, false)
+			if !ok && previous != nil {
+				pixel, ok = previous.sample(previousSource, x, y, frameScale, false)
+			}
+			if !ok {
+				pixel, _ = k.sample(source, x, y, frameScale, true)
+			}
+			if blend > 0 {
+				if nextPixel, ok := next.sample(nextSource, x, y, frameScale, false); ok {
+					colors := []color.RGBA{misc.Unpremultiply(pixel), misc.Unpremultiply(nextPixel)}
+					pixel = misc.WeightedAverageColors(colors, []float64{1 - blend, blend})
+				}
+			}
+			image.SetRGBA(column, row, pixel)
+		}
+	}
+	return image
+}
+
+// ingestKeyframe
+// Stores a calculated keyframe and resamples the frames of every keyframe that has what it needs: itself, the previous
+// keyframe to fall back on and the next keyframe to blend into. A keyframe is released once the frames of its own span
+// and of the spans next to it have been made.
+func (c *Coordinator) ingestKeyframe(k *keyframe, image imageTask) {
+	c.mutex.Lock()
+	k.Image = image.Image
+	k.MaxIterations = image.MaxIterations
+	if k.Iterations != nil {
+		k.Iterations = image.Iterations
+	}
+	for _, f := range k.Frames {
+		frame := c.frames[f.ImageNumber]
+		frame.Statistics = image.Statistics
+		c.frames[f.ImageNumber] = frame
+	}
+	c.mutex.Unlock()
+
+	for _, candidate := range []*keyframe{c.keyframes[k.Previous], k, c.keyframes[k.Next]} {
+		if candidate == nil || candidate.Resampled || candidate.Image == nil {
+			continue
+		}
+		previous := c.keyframes[candidate.Previous]
+		next := c.keyframes[candidate.Next]
+		if (previous != nil && previous.Image == nil) || (next != nil && next.Image == nil) {
+			// Wait for the keyframes to fall back on and to blend into
+			continue
+		}
+		for _, frame := range candidate.Frames {
+			c.saveImage(frame.ImageNumber, c.resampleFrame(frame, candidate, previous, next))
+			c.imageCompletedCount++
+		}
+		candidate.Resampled = true
+	}
+
+	for _, candidate := range []*keyframe{c.keyframes[k.Previous], k, c.keyframes[k.Next]} {
+		if candidate == nil || !candidate.Resampled {
+			continue
+		}
+		previous := c.keyframes[candidate.Previous]
+		next := c.keyframes[candidate.Next]
+		if (previous == nil || previous.Resampled) && (next == nil || next.Resampled) {
+			candidate.Image = nil
+			candidate.Iterations = nil
+		}
+	}
+}
+
+func shorterSide(width uint, height uint) uint {
+	if height < width {
+		return height
+	}
+	return width
+}
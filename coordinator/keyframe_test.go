@@ -0,0 +1,87 @@
+package coordinator
+
+import (
+	gimage "image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// uniformImage
+// Returns an image of the size filled with one color
+func uniformImage(width uint, height uint, c color.RGBA) *gimage.RGBA {
+	image := gimage.NewRGBA(gimage.Rect(0, 0, int(width), int(height)))
+	for row := 0; row < int(height); row++ {
+		for column := 0; column < int(width); column++ {
+			image.SetRGBA(column, row, c)
+		}
+	}
+	return image
+}
+
+func TestPlanKeyframes(t *testing.T) {
+	var frames []frameMetadata
+	for i, magnification := range []float64{1, 1.5, 1.9, 2, 3.9, 4} {
+		frames = append(frames, frameMetadata{ImageNumber: uint(i + 1), Magnification: magnification})
+	}
+	ks := keyframeSettings{ZoomFactor: 2}
+	keyframes := ks.planKeyframes(frames, 40, 30, 10)
+
+	want := [][]uint{{1, 2, 3}, {4, 5}, {6}}
+	if len(keyframes) != len(want) {
+		t.Fatalf("planned %d keyframes, want %d", len(keyframes), len(want))
+	}
+	for i, k := range keyframes {
+		var got []uint
+		for _, frame := range k.Frames {
+			got = append(got, frame.ImageNumber)
+		}
+		if len(got) != len(want[i]) || got[0] != want[i][0] || got[len(got)-1] != want[i][len(want[i])-1] {
+			t.Errorf("keyframe %d has frames %v, want %v", i, got, want[i])
+		}
+		if k.Width != 80 || k.Height != 60 || k.ImageNumber != uint(10+i) {
+			t.Errorf("keyframe %d is image %d of %dx%d", i, k.ImageNumber, k.Width, k.Height)
+		}
+		if (i > 0 && k.Previous != keyframes[i-1].ImageNumber) || (i < len(keyframes)-1 && k.Next != keyframes[i+1].ImageNumber) {
+			t.Errorf("keyframe %d links to %d and %d", i, k.Previous, k.Next)
+		}
+	}
+}
+
+func TestResampleFrameBlends(t *testing.T) {
+	red := color.RGBA{R: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+	frames := []frameMetadata{{Magnification: 1}, {Magnification: math.Sqrt2}, {Magnification: 2}}
+	ks := keyframeSettings{ZoomFactor: 2}
+	keyframes := ks.planKeyframes(frames, 8, 6, 1)
+	if len(keyframes) != 2 {
+		t.Fatalf("planned %d keyframes, want 2", len(keyframes))
+	}
+	first, last := keyframes[0], keyframes[1]
+	first.Image = uniformImage(first.Width, first.Height, red)
+	last.Image = uniformImage(last.Width, last.Height, blue)
+	c := &Coordinator{rectangle: gimage.Rect(0, 0, 8, 6)}
+
+	tests := []struct {
+		name  string
+		frame frameMetadata
+		k     *keyframe
+		next  *keyframe
+		want  func(color.RGBA) bool
+	}{
+		{name: "start of a span", frame: frames[0], k: first, next: last, want: func(c color.RGBA) bool { return c == red }},
+		{name: "half way through a span", frame: frames[1], k: first, next: last, want: func(c color.RGBA) bool {
+			// Equal parts of red and blue in linear light
+			return c.G == 0 && c.R > 150 && math.Abs(float64(c.R)-float64(c.B)) <= 1
+		}},
+		{name: "last keyframe", frame: frames[2], k: last, want: func(c color.RGBA) bool { return c == blue }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			image := c.resampleFrame(test.frame, test.k, nil, test.next)
+			if got := image.RGBAAt(4, 3); !test.want(got) {
+				t.Errorf("the center of the frame is %v", got)
+			}
+		})
+	}
+}
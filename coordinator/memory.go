@@ -0,0 +1,188 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/misc"
+	"DistributedMandelbrot/task"
+	"encoding/gob"
+	"fmt"
+	gimage "image"
+	"os"
+	"path/filepath"
+)
+
+// memorySettings
+// Bounds the memory the coordinator spends on images that are still being calculated.
+//
+//	MaxOpenImages:     images with tasks handed out at once. Tasks for the next image are only generated once an
+//	                   earlier image has been saved. Zero does not limit generation
+//	MaxImagesInMemory: images kept in memory while their pixels come in. Once there are more, the image that was
+//	                   updated least recently is spilled to disk until its next pixels arrive. Zero keeps every image
+//	                   in memory
+type memorySettings struct {
+	MaxImagesInMemory uint
+	MaxOpenImages     uint
+}
+
+func (ms *memorySettings) Verify() error {
+	return nil
+}
+
+// openImage
+// Returns the image the pixels of the task belong to, reading it back from disk when it was spilled or creating it
+// when the task is the first of its image to come back
+func (c *Coordinator) openImage(taskReceived task.Task) (imageTask, error) {
+	imageNumber := int(taskReceived.ImageNumber)
+
+	c.mutex.Lock()
+	image, ok := c.images[imageNumber]
+	spilled := c.spilledImages[imageNumber]
+	checkpointed := c.checkpointImages[imageNumber]
+	c.mutex.Unlock()
+	if ok {
+		return image, nil
+	}
+	if spilled {
+		return c.readSpilledImage(imageNumber)
+	}
+	if checkpointed {
+		return c.readCheckpointImage(imageNumber)
+	}
+
+	// Keyframes are larger than the other images
+	rectangle := c.rectangle
+	if taskReceived.Width > 0 && taskReceived.Height > 0 {
+		rectangle = gimage.Rect(0, 0, int(taskReceived.Width), int(taskReceived.Height))
+	}
+	pixelCount := uint(rectangle.Dx() * rectangle.Dy())
+	image = imageTask{
+		Image:         gimage.NewRGBA(rectangle),
+		MaxIterations: taskReceived.MaxIterations,
+		PixelsLeft:    pixelCount,
+	}
+	if taskReceived.KeepIterations {
+		image.Iterations = make([][]float64, pixelCount)
+	}
+	return image, nil
+}
+
+// storeImage
+// Keeps an image that still has pixels left, spilling the least recently updated images when too many are in memory
+func (c *Coordinator) storeImage(imageNumber int, image imageTask) {
+	c.mutex.Lock()
+	c.images[imageNumber] = image
+	c.imageUpdates++
+	c.imageUpdated[imageNumber] = c.imageUpdates
+	c.mutex.Unlock()
+
+	limit := int(c.settings.MemorySettings.MaxImagesInMemory)
+	for limit > 0 {
+		c.mutex.Lock()
+		if len(c.images) <= limit {
+			c.mutex.Unlock()
+			return
+		}
+		oldest := imageNumber
+		for n := range c.images {
+			if c.imageUpdated[n] < c.imageUpdated[oldest] {
+				oldest = n
+			}
+		}
+		spill := c.images[oldest]
+		c.mutex.Unlock()
+
+		if oldest == imageNumber {
+			return
+		}
+		if err := c.spillImage(oldest, spill); err != nil {
+			// Keep the image in memory rather than lose its pixels
+			misc.CheckError(err, c.logger, misc.Error)
+			return
+		}
+	}
+}
+
+// closeImage
+// Forgets an image once it has been saved and lets the next image be generated
+func (c *Coordinator) closeImage(imageNumber int) {
+	c.mutex.Lock()
+	delete(c.images, imageNumber)
+	delete(c.imageUpdated, imageNumber)
+	c.mutex.Unlock()
+
+	if c.openImages != nil {
+		<-c.openImages
+	}
+}
+
+func (c *Coordinator) spillPath(imageNumber int) string {
+	return filepath.Join(c.settings.SavePath, c.settings.RunName, "spill", fmt.Sprintf("%d.gob", imageNumber))
+}
+
+func (c *Coordinator) spillImage(imageNumber int, image imageTask) error {
+	path := c.spillPath(imageNumber)
+	if err := encodeImageTask(path, image); err != nil {
+		return fmt.Errorf("unable to spill image %d - %s", imageNumber, err)
+	}
+
+	c.mutex.Lock()
+	delete(c.images, imageNumber)
+	c.spilledImages[imageNumber] = true
+	c.mutex.Unlock()
+	c.logger.Debugf("Spilled image %d to %s", imageNumber, path)
+	return nil
+}
+
+func (c *Coordinator) readSpilledImage(imageNumber int) (imageTask, error) {
+	path := c.spillPath(imageNumber)
+	image, err := decodeImageTask(path)
+	if err != nil {
+		return image, fmt.Errorf("unable to read spilled image %d - %s", imageNumber, err)
+	}
+	misc.CheckError(os.Remove(path), c.logger, misc.Warning)
+
+	c.mutex.Lock()
+	delete(c.spilledImages, imageNumber)
+	c.mutex.Unlock()
+	return image, nil
+}
+
+// readCheckpointImage
+// Reads a partial image of the checkpoint the run resumed from. The file is left alone, the checkpoint still points at
+// it until the next checkpoint is written
+func (c *Coordinator) readCheckpointImage(imageNumber int) (imageTask, error) {
+	image, err := decodeImageTask(c.checkpointImagePath(c.checkpointFolder, imageNumber))
+	if err != nil {
+		return image, fmt.Errorf("unable to read image %d of the checkpoint - %s", imageNumber, err)
+	}
+
+	c.mutex.Lock()
+	delete(c.checkpointImages, imageNumber)
+	c.mutex.Unlock()
+	return image, nil
+}
+
+func encodeImageTask(path string, image imageTask) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create folder %s - %s", filepath.Dir(path), err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create %s - %s", path, err)
+	}
+	err = gob.NewEncoder(f).Encode(image)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func decodeImageTask(path string) (imageTask, error) {
+	var image imageTask
+	f, err := os.Open(path)
+	if err != nil {
+		return image, err
+	}
+	defer f.Close()
+	err = gob.NewDecoder(f).Decode(&image)
+	return image, err
+}
@@ -0,0 +1,59 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/task"
+	"github.com/BrugadaSyndrome/bslogger"
+	gimage "image"
+	"image/color"
+	"os"
+	"testing"
+)
+
+func TestSpillImage(t *testing.T) {
+	c := &Coordinator{
+		imageUpdated:  make(map[int]uint64),
+		images:        make(map[int]imageTask),
+		logger:        bslogger.NewLogger("TestCoordinator", bslogger.Normal, nil),
+		rectangle:     gimage.Rect(0, 0, 4, 2),
+		spilledImages: make(map[int]bool),
+	}
+	c.settings.MemorySettings.MaxImagesInMemory = 1
+	c.settings.RunName = "spill"
+	c.settings.SavePath = t.TempDir()
+
+	first, err := c.openImage(task.NewTask(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Image.SetRGBA(1, 1, color.RGBA{R: 200, A: 255})
+	first.PixelsLeft--
+	c.storeImage(0, first)
+	second, _ := c.openImage(task.NewTask(1, 1))
+	c.storeImage(1, second)
+
+	// The image updated least recently goes to disk
+	if _, ok := c.images[0]; ok || !c.spilledImages[0] {
+		t.Fatal("image 0 was not spilled")
+	}
+	if _, err = os.Stat(c.spillPath(0)); err != nil {
+		t.Fatalf("image 0 is not on disk: %s", err)
+	}
+
+	if len(c.images) != 1 {
+		t.Errorf("%d images are in memory, want 1", len(c.images))
+	}
+
+	read, err := c.openImage(task.NewTask(2, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.PixelsLeft != first.PixelsLeft || read.Image.RGBAAt(1, 1) != first.Image.RGBAAt(1, 1) {
+		t.Error("image 0 did not come back from disk the way it was spilled")
+	}
+	if c.spilledImages[0] {
+		t.Error("image 0 is still marked as spilled")
+	}
+	if _, err = os.Stat(c.spillPath(0)); !os.IsNotExist(err) {
+		t.Error("the spilled file of image 0 was left behind")
+	}
+}
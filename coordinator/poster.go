@@ -0,0 +1,269 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/misc"
+	"DistributedMandelbrot/task"
+	"errors"
+	"fmt"
+	gimage "image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	NoPyramid PyramidFormat = iota
+	DeepZoomPyramid
+	XYZPyramid
+)
+
+type PyramidFormat int
+
+func (p PyramidFormat) String() string {
+	return []string{
+		"None", "DeepZoom", "XYZ",
+	}[p]
+}
+
+// posterSettings
+// Renders one image that can be far larger than the coordinator could hold in memory, e.g. a 50000x50000 print. The
+// image is split into TileSize tiles that are written to disk as they arrive and are stitched into poster.png once
+// every tile is done. Pyramid also cuts the poster into a Deep Zoom (.dzi) or XYZ (z/x/y) tile pyramid for web viewers.
+// The poster is only written as PNG: a poster that size needs BigTIFF, which not every viewer reads.
+type posterSettings struct {
+	CenterX       float64
+	CenterY       float64
+	Enabled       bool
+	Height        uint
+	Magnification float64
+	Pyramid       PyramidFormat
+	TileSize      uint
+	Width         uint
+}
+
+func (ps *posterSettings) Verify() error {
+	if ps.Magnification <= 0 {
+		ps.Magnification = 0.5
+	}
+	if ps.Pyramid < NoPyramid || ps.Pyramid > XYZPyramid {
+		ps.Pyramid = NoPyramid
+	}
+	if ps.TileSize == 0 {
+		ps.TileSize = 256
+	}
+	if ps.Enabled && (ps.Width == 0 || ps.Height == 0) {
+		return errors.New("a poster needs a Width and Height")
+	}
+	return nil
+}
+
+// tileCount
+// Returns the number of tile columns and rows of the full size poster
+func (ps *posterSettings) tileCount() (uint, uint) {
+	return (ps.Width + ps.TileSize - 1) / ps.TileSize, (ps.Height + ps.TileSize - 1) / ps.TileSize
+}
+
+// planPoster
+// Records the single frame of the poster and returns the number of tiles the workers will calculate
+func (c *Coordinator) planPoster() uint {
+	ps := c.settings.PosterSettings
+
+	maxIterations := c.settings.MandelbrotSettings.MaxIterations
+	if c.settings.AutoIterations.Enabled {
+		maxIterations = c.settings.AutoIterations.Iterations(ps.Magnification, nil)
+	}
+	c.frames[1] = frameMetadata{
+		CenterX:       ps.CenterX,
+		CenterY:       ps.CenterY,
+		Coloring:      task.Coloring{PaletteDensity: 1},
+		ImageNumber:   1,
+		Magnification: ps.Magnification,
+		MaxIterations: maxIterations,
+	}
+	c.posterOpaque = true
+
+	columns, rows := ps.tileCount()
+	return columns * rows
+}
+
+func (c *Coordinator) generatePosterTasks() {
+	c.logger.Info("Generating poster tasks")
+
+	var elapsedTime time.Duration
+	var startTime = time.Now()
+
+	ps := c.settings.PosterSettings
+	c.mutex.Lock()
+	frame := c.frames[1]
+	c.mutex.Unlock()
+
+	top, _ := ps.pyramidLevels()
+	misc.CheckError(os.MkdirAll(c.posterTileDirectory(top), os.ModePerm), c.logger, misc.Fatal)
+
+	var row, column uint
+	for row = 0; row < ps.Height; row += ps.TileSize {
+		for column = 0; column < ps.Width; column += ps.TileSize {
+			taskTodo := task.NewTask(c.taskGeneratedCount, frame.ImageNumber)
+			taskTodo.Coloring = frame.Coloring
+			taskTodo.Height = ps.Height
+			taskTodo.MaxIterations = frame.MaxIterations
+			taskTodo.Width = ps.Width
+			taskTodo.AddTasksForTile(ps.CenterX, ps.CenterY, ps.Magnification, row, column, minUint(ps.TileSize, ps.Height-row), minUint(ps.TileSize, ps.Width-column))
+			c.scheduler.Add(taskTodo)
+			c.taskGeneratedCount++
+		}
+	}
+
+	elapsedTime = time.Since(startTime)
+	c.scheduler.Close()
+
+	c.logger.Infof("Done generating %d tasks in %s", c.taskGeneratedCount, elapsedTime.Round(time.Second).String())
+}
+
+// ingestPosterTile
+// Writes the tile of a finished task straight to disk instead of keeping the whole poster in memory. A tile that
+// cannot be used is handed out again
+func (c *Coordinator) ingestPosterTile(taskReceived task.Task) {
+	if err := taskReceived.DecodeResults(); err != nil {
+		c.logger.Errorf("Unable to read the results of task %d from %s, handing it out again: %s", taskReceived.ID, taskReceived.WorkerAddress, err)
+		c.retryTask(taskReceived)
+		return
+	}
+	minRow, minColumn, rows, columns, ok := taskReceived.TileBounds()
+	if !ok || len(taskReceived.Results) != len(taskReceived.Tasks) {
+		c.logger.Errorf("Task %d from %s is not a complete poster tile, handing it out again", taskReceived.ID, taskReceived.WorkerAddress)
+		c.retryTask(taskReceived)
+		return
+	}
+	c.mutex.Lock()
+	delete(c.tasksHandedOut[taskReceived.WorkerAddress], taskReceived.ID)
+	c.mutex.Unlock()
+
+	tile := gimage.NewRGBA(gimage.Rect(0, 0, columns, rows))
+	for _, result := range taskReceived.Results {
+		tile.SetRGBA(int(result.Column-minColumn), int(result.Row-minRow), result.Color)
+	}
+	tileSize := c.settings.PosterSettings.TileSize
+	top, _ := c.settings.PosterSettings.pyramidLevels()
+	if err := writeImageFile(c.posterTilePath(top, minColumn/tileSize, minRow/tileSize), tile, PNG); err != nil {
+		c.logger.Errorf("Unable to write the tile of task %d, handing it out again: %s", taskReceived.ID, err)
+		c.retryTask(taskReceived)
+		return
+	}
+
+	c.mutex.Lock()
+	frame := c.frames[taskReceived.ImageNumber]
+	frame.Statistics.Merge(taskReceived.Statistics)
+	c.frames[taskReceived.ImageNumber] = frame
+	c.posterOpaque = c.posterOpaque && tile.Opaque()
+	c.mutex.Unlock()
+}
+
+// assemblePoster
+// Stitches the tiles into poster.png one row of tiles at a time, then builds the tile pyramid if one was asked for
+func (c *Coordinator) assemblePoster() error {
+	ps := c.settings.PosterSettings
+	path := filepath.Join(c.settings.SavePath, c.settings.RunName, "poster.png")
+	c.logger.Infof("Assembling poster %s", path)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create poster %s - %s", path, err)
+	}
+	writer, err := misc.NewPNGWriter(f, int(ps.Width), int(ps.Height), !c.posterOpaque)
+	if err != nil {
+		return err
+	}
+
+	top, _ := ps.pyramidLevels()
+	columns, rows := ps.tileCount()
+	row := make([]color.RGBA, ps.Width)
+	var tileRow, tileColumn uint
+	for tileRow = 0; tileRow < rows; tileRow++ {
+		tiles := make([]*gimage.RGBA, columns)
+		for tileColumn = 0; tileColumn < columns; tileColumn++ {
+			tiles[tileColumn], err = readTile(c.posterTilePath(top, tileColumn, tileRow))
+			if err != nil {
+				return err
+			}
+		}
+		for y := 0; y < tiles[0].Rect.Dy(); y++ {
+			for i, tile := range tiles {
+				for x := 0; x < tile.Rect.Dx(); x++ {
+					row[i*int(ps.TileSize)+x] = misc.Unpremultiply(tile.RGBAAt(x, y))
+				}
+			}
+			if err = writer.WriteRow(row); err != nil {
+				return err
+			}
+		}
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	c.imageCompletedCount++
+	c.logger.Infof("Saved poster to %s", path)
+
+	if ps.Pyramid != NoPyramid {
+		if err = c.buildPyramid(); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(filepath.Join(c.settings.SavePath, c.settings.RunName, "tiles"))
+}
+
+// posterTileDirectory
+// Tiles are kept in the run folder until the poster is assembled. level is the Deep Zoom level of the tiles
+func (c *Coordinator) posterTileDirectory(level uint) string {
+	return filepath.Join(c.settings.SavePath, c.settings.RunName, "tiles", fmt.Sprintf("%d", level))
+}
+
+func (c *Coordinator) posterTilePath(level uint, column uint, row uint) string {
+	return filepath.Join(c.posterTileDirectory(level), fmt.Sprintf("%d_%d.png", column, row))
+}
+
+func writeImageFile(path string, image gimage.Image, format ImageFormat) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create image %s - %s", path, err)
+	}
+	err = format.Encode(f, image)
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("unable to save image %s - %s", path, err)
+	}
+	return f.Close()
+}
+
+// readTile
+// Tiles are saved as PNG, which decodes transparent images as NRGBA, so they are converted back to RGBA
+func readTile(path string) (*gimage.RGBA, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open tile %s - %s", path, err)
+	}
+	decoded, err := png.Decode(f)
+	_ = f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read tile %s - %s", path, err)
+	}
+	if tile, ok := decoded.(*gimage.RGBA); ok {
+		return tile, nil
+	}
+	tile := gimage.NewRGBA(decoded.Bounds())
+	draw.Draw(tile, tile.Rect, decoded, decoded.Bounds().Min, draw.Src)
+	return tile, nil
+}
+
+func minUint(a uint, b uint) uint {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,62 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/misc"
+	"DistributedMandelbrot/task"
+	"fmt"
+	"strings"
+)
+
+// requiredFeatures
+// Returns the features a worker needs to calculate the tasks of this run correctly
+func (c *Coordinator) requiredFeatures() []misc.Feature {
+	var required []misc.Feature
+	if c.settings.MandelbrotSettings.AdaptiveSampling {
+		required = append(required, misc.AdaptiveSamplingFeature)
+	}
+	for _, plan := range c.imagePlans {
+		if plan.KeepIterations {
+			required = append(required, misc.KeepIterationsFeature)
+			break
+		}
+	}
+	if c.settings.MandelbrotSettings.Subdivision {
+		required = append(required, misc.SubdivisionFeature)
+	}
+	return required
+}
+
+// checkRegistration
+// Returns the features of a joining worker, or an error explaining why it cannot take part in this run
+func (c *Coordinator) checkRegistration(registration misc.Registration) (map[misc.Feature]bool, error) {
+	if registration.ProtocolVersion != misc.ProtocolVersion {
+		return nil, fmt.Errorf("worker %s speaks protocol version %d but the coordinator speaks version %d, run the same version of the program on both", registration.Address, registration.ProtocolVersion, misc.ProtocolVersion)
+	}
+
+	features := make(map[misc.Feature]bool, len(registration.Features))
+	for _, f := range registration.Features {
+		features[f] = true
+	}
+	var missing []string
+	for _, f := range c.requiredFeatures() {
+		if !features[f] {
+			missing = append(missing, f.String())
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("worker %s does not support %s which this run needs", registration.Address, strings.Join(missing, ", "))
+	}
+	return features, nil
+}
+
+// chooseEncoding
+// Uses the compressed encoding when the worker knows it
+func chooseEncoding(encodings []task.Encoding) task.Encoding {
+	encoding := task.RawEncoding
+	for _, e := range encodings {
+		if e == task.RunLengthEncoding {
+			encoding = e
+		}
+	}
+	return encoding
+}
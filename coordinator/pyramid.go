@@ -0,0 +1,168 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/misc"
+	"fmt"
+	gimage "image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+)
+
+// pyramidLevels
+// Returns the Deep Zoom level of the full size poster and the highest level where the whole poster fits in one tile.
+// Each level halves the size of the one above it and level 0 is a single pixel.
+// https://learn.microsoft.com/en-us/previous-versions/windows/silverlight/dotnet-windows-silverlight/cc645077(v=vs.95)
+func (ps *posterSettings) pyramidLevels() (uint, uint) {
+	var top uint
+	for uint(1)<<top < ps.Width || uint(1)<<top < ps.Height {
+		top++
+	}
+	var fit uint
+	for fit = top; fit > 0; fit-- {
+		width, height := ps.levelSize(fit, top)
+		if width <= ps.TileSize && height <= ps.TileSize {
+			break
+		}
+	}
+	return top, fit
+}
+
+// levelSize
+// Returns the size of the poster at a level of the pyramid
+func (ps *posterSettings) levelSize(level uint, top uint) (uint, uint) {
+	shift := top - level
+	return (ps.Width + 1<<shift - 1) >> shift, (ps.Height + 1<<shift - 1) >> shift
+}
+
+// buildPyramid
+// Works down from the full size tiles, making each tile of a level from the four tiles below it so only a handful of
+// tiles are in memory at once. Deep Zoom pyramids go down to a single pixel, XYZ pyramids stop at zoom 0 where the
+// whole poster fits in one tile.
+func (c *Coordinator) buildPyramid() error {
+	ps := c.settings.PosterSettings
+	runPath := filepath.Join(c.settings.SavePath, c.settings.RunName)
+	top, fit := ps.pyramidLevels()
+	c.logger.Infof("Building %s tile pyramid", ps.Pyramid)
+
+	bottom := uint(0)
+	if ps.Pyramid == XYZPyramid {
+		bottom = fit
+	}
+
+	level := top
+	for {
+		width, height := ps.levelSize(level, top)
+		columns := (width + ps.TileSize - 1) / ps.TileSize
+		rows := (height + ps.TileSize - 1) / ps.TileSize
+		if level < top {
+			if err := os.MkdirAll(c.posterTileDirectory(level), os.ModePerm); err != nil {
+				return err
+			}
+		}
+
+		var row, column uint
+		for row = 0; row < rows; row++ {
+			for column = 0; column < columns; column++ {
+				var tile *gimage.RGBA
+				var err error
+				if level == top {
+					tile, err = readTile(c.posterTilePath(level, column, row))
+				} else {
+					tile, err = c.downsampleTile(level, column, row, minUint(ps.TileSize, width-column*ps.TileSize), minUint(ps.TileSize, height-row*ps.TileSize))
+					if err == nil {
+						err = writeImageFile(c.posterTilePath(level, column, row), tile, PNG)
+					}
+				}
+				if err != nil {
+					return err
+				}
+
+				var path string
+				switch ps.Pyramid {
+				case DeepZoomPyramid:
+					path = filepath.Join(runPath, "poster_files", fmt.Sprintf("%d", level), fmt.Sprintf("%d_%d.%s", column, row, c.settings.ImageFormat.Extension()))
+				case XYZPyramid:
+					// Viewers expect every XYZ tile to be the full tile size
+					path = filepath.Join(runPath, "poster_tiles", fmt.Sprintf("%d", level-fit), fmt.Sprintf("%d", column), fmt.Sprintf("%d.%s", row, c.settings.ImageFormat.Extension()))
+					padded := gimage.NewRGBA(gimage.Rect(0, 0, int(ps.TileSize), int(ps.TileSize)))
+					draw.Draw(padded, tile.Rect, tile, gimage.Point{}, draw.Src)
+					tile = padded
+				}
+				if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+					return err
+				}
+				if err = writeImageFile(path, tile, c.settings.ImageFormat); err != nil {
+					return err
+				}
+			}
+		}
+
+		if level == bottom {
+			break
+		}
+		level--
+	}
+
+	if ps.Pyramid == DeepZoomPyramid {
+		descriptor := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<Image xmlns="http://schemas.microsoft.com/deepzoom/2008" Format="%s" Overlap="0" TileSize="%d">
+  <Size Width="%d" Height="%d"/>
+</Image>
+`, c.settings.ImageFormat.Extension(), ps.TileSize, ps.Width, ps.Height)
+		if _, err := misc.WriteFile(filepath.Join(runPath, "poster.dzi"), []byte(descriptor)); err != nil {
+			return err
+		}
+	}
+	c.logger.Infof("Done building %s tile pyramid", ps.Pyramid)
+	return nil
+}
+
+// downsampleTile
+// Makes a tile of a level by averaging each 2x2 block of pixels of the four tiles it covers on the level below
+func (c *Coordinator) downsampleTile(level uint, column uint, row uint, width uint, height uint) (*gimage.RGBA, error) {
+	tileSize := int(c.settings.PosterSettings.TileSize)
+	below, err := c.readTileBlock(level+1, column*2, row*2)
+	if err != nil {
+		return nil, err
+	}
+
+	tile := gimage.NewRGBA(gimage.Rect(0, 0, int(width), int(height)))
+	samples := make([]color.RGBA, 0, 4)
+	for y := 0; y < int(height); y++ {
+		for x := 0; x < int(width); x++ {
+			samples = samples[:0]
+			for _, offset := range []gimage.Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 0, Y: 1}, {X: 1, Y: 1}} {
+				belowX, belowY := 2*x+offset.X, 2*y+offset.Y
+				source := below[belowY/tileSize][belowX/tileSize]
+				point := gimage.Pt(belowX%tileSize, belowY%tileSize)
+				if source != nil && point.In(source.Rect) {
+					samples = append(samples, misc.Unpremultiply(source.RGBAAt(point.X, point.Y)))
+				}
+			}
+			tile.SetRGBA(x, y, misc.AverageColors(samples))
+		}
+	}
+	return tile, nil
+}
+
+// readTileBlock
+// Reads the 2x2 block of tiles with its top left tile at (column, row). Tiles past the edge of the level are nil
+func (c *Coordinator) readTileBlock(level uint, column uint, row uint) ([2][2]*gimage.RGBA, error) {
+	var block [2][2]*gimage.RGBA
+	for y := uint(0); y < 2; y++ {
+		for x := uint(0); x < 2; x++ {
+			path := c.posterTilePath(level, column+x, row+y)
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				continue
+			}
+			tile, err := readTile(path)
+			if err != nil {
+				return block, err
+			}
+			block[y][x] = tile
+		}
+	}
+	return block, nil
+}
@@ -0,0 +1,307 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/misc"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Widths the timeline of a report is cut into, the smallest that keeps it to timelineRows rows is used
+var timelineSteps = []time.Duration{
+	time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second, time.Minute, 2 * time.Minute,
+	5 * time.Minute, 10 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour, 6 * time.Hour, 12 * time.Hour,
+	24 * time.Hour,
+}
+
+const timelineRows = 20
+
+// workerReport
+// What the journals say about one worker. Calculating is the time the worker spent on the tasks it returned and
+// Turnaround the time from handing those tasks out until they came back
+type workerReport struct {
+	Calculating time.Duration
+	Issued      int
+	joinedAt    time.Time // Start of the session in progress, zero between sessions
+	Online      time.Duration
+	Paused      time.Duration
+	pausedAt    time.Time
+	Requeued    int
+	Returned    int
+	Sessions    int
+	Turnaround  time.Duration
+}
+
+func (r *workerReport) leave(at time.Time) {
+	if !r.joinedAt.IsZero() {
+		r.Online += at.Sub(r.joinedAt)
+		r.joinedAt = time.Time{}
+	}
+}
+
+func (r *workerReport) resume(at time.Time) {
+	if !r.pausedAt.IsZero() {
+		r.Paused += at.Sub(r.pausedAt)
+		r.pausedAt = time.Time{}
+	}
+}
+
+// timelineRow
+// The events of one stretch of the run. Workers is the number of workers in the run at the end of it
+type timelineRow struct {
+	Frames   int
+	Issued   int
+	Requeued int
+	Returned int
+	Workers  int
+}
+
+// WriteReport
+// Summarizes the journals in the run folder of the coordinator settings file: the journal of the coordinator and any
+// worker journals copied next to it. Writes the run, the utilization of each worker and a timeline to out
+func WriteReport(settingsFile string, out io.Writer) error {
+	s := NewSettings(settingsFile)
+	runPath := filepath.Join(s.SavePath, s.RunName)
+	events, err := misc.ReadJournal(filepath.Join(runPath, journalFile))
+	if err != nil {
+		return fmt.Errorf("unable to read the journal of run %s, is RunName set? %s", s.RunName, err)
+	}
+	if len(events) == 0 {
+		return fmt.Errorf("the journal of run %s is empty", s.RunName)
+	}
+	start := events[0].Time
+	end := events[len(events)-1].Time
+
+	// Worker journals cover every run the workers took part in, only the events of this run are kept
+	workerJournals, err := filepath.Glob(filepath.Join(runPath, "*.jsonl"))
+	if err != nil {
+		return err
+	}
+	for _, path := range workerJournals {
+		if filepath.Base(path) == journalFile {
+			continue
+		}
+		workerEvents, err := misc.ReadJournal(path)
+		if err != nil {
+			return err
+		}
+		for _, event := range workerEvents {
+			if !event.Time.Before(start) && !event.Time.After(end) {
+				events = append(events, event)
+			}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+
+	writeRunSummary(out, s.RunName, events)
+	_, _ = fmt.Fprintln(out)
+	if err = writeWorkerTable(out, events); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintln(out)
+	return writeTimeline(out, events, start, end)
+}
+
+func writeRunSummary(out io.Writer, runName string, events []misc.Event) {
+	var running time.Duration
+	var startedAt time.Time
+	counts := make(map[misc.EventKind]int)
+	stopped := "still running or interrupted"
+	var movie string
+	for _, event := range events {
+		if event.Source != misc.CoordinatorSource {
+			continue
+		}
+		counts[event.Kind]++
+		switch event.Kind {
+		case misc.RunStarted:
+			startedAt = event.Time
+		case misc.RunStopped:
+			if !startedAt.IsZero() {
+				running += event.Time.Sub(startedAt)
+				startedAt = time.Time{}
+			}
+			stopped = event.Reason
+		case misc.MovieEncoded:
+			movie = fmt.Sprintf(", movie encoded in %s", event.Elapsed.Round(time.Second))
+			if event.Reason != "" {
+				movie = fmt.Sprintf(", movie failed: %s", event.Reason)
+			}
+		}
+	}
+	if !startedAt.IsZero() {
+		running += events[len(events)-1].Time.Sub(startedAt)
+	}
+
+	_, _ = fmt.Fprintf(out, "Run %s: started %s, %s after %s", runName, events[0].Time.Format(time.DateTime), stopped, running.Round(time.Second))
+	if counts[misc.RunStarted] > 1 {
+		_, _ = fmt.Fprintf(out, " in %d sessions", counts[misc.RunStarted])
+	}
+	_, _ = fmt.Fprintln(out)
+	_, _ = fmt.Fprintf(out, "Tasks issued %d, returned %d, requeued %d. Frames saved %d%s\n", counts[misc.TaskIssued], counts[misc.TaskReturned], counts[misc.TaskRequeued], counts[misc.FrameSaved], movie)
+}
+
+// writeWorkerTable
+// Utilization is the share of the time a worker was in the run that it spent calculating, it goes over 100% for a
+// worker calculating several tasks at once. Paused time is only known from the journal of the worker
+func writeWorkerTable(out io.Writer, events []misc.Event) error {
+	workers := make(map[string]*workerReport)
+	journaled := make(map[string]bool) // Workers with a journal of their own
+	report := func(name string) *workerReport {
+		r, ok := workers[name]
+		if !ok {
+			r = &workerReport{}
+			workers[name] = r
+		}
+		return r
+	}
+
+	for _, event := range events {
+		if event.Source != misc.CoordinatorSource {
+			journaled[event.Worker] = true
+			switch event.Kind {
+			case misc.WorkerPaused:
+				report(event.Worker).pausedAt = event.Time
+			case misc.WorkerResumed, misc.WorkerLeft:
+				report(event.Worker).resume(event.Time)
+			}
+			continue
+		}
+		switch event.Kind {
+		case misc.WorkerJoined:
+			r := report(event.Worker)
+			r.Sessions++
+			r.joinedAt = event.Time
+		case misc.WorkerLeft:
+			report(event.Worker).leave(event.Time)
+		case misc.TaskIssued:
+			report(event.Worker).Issued++
+		case misc.TaskReturned:
+			r := report(event.Worker)
+			r.Calculating += event.Duration
+			r.Returned++
+			r.Turnaround += event.Elapsed
+		case misc.TaskRequeued:
+			report(event.Worker).Requeued++
+		case misc.RunStopped:
+			// Workers still in the run leave with it
+			for _, r := range workers {
+				r.leave(event.Time)
+			}
+		}
+	}
+	last := events[len(events)-1].Time
+	names := make([]string, 0, len(workers))
+	for name, r := range workers {
+		r.leave(last)
+		r.resume(last)
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(table, "WORKER\tSESSIONS\tONLINE\tISSUED\tRETURNED\tREQUEUED\tCALCULATING\tUTILIZATION\tTURNAROUND\tPAUSED")
+	for _, name := range names {
+		r := workers[name]
+		utilization := "-"
+		if r.Online > 0 {
+			utilization = fmt.Sprintf("%.0f%%", 100*r.Calculating.Seconds()/r.Online.Seconds())
+		}
+		turnaround := "-"
+		if r.Returned > 0 {
+			turnaround = (r.Turnaround / time.Duration(r.Returned)).Round(time.Millisecond).String()
+		}
+		paused := "-"
+		if journaled[name] {
+			paused = r.Paused.Round(time.Second).String()
+		}
+		_, _ = fmt.Fprintf(table, "%s\t%d\t%s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\n", name, r.Sessions, r.Online.Round(time.Second), r.Issued, r.Returned, r.Requeued, r.Calculating.Round(time.Second), utilization, turnaround, paused)
+	}
+	return table.Flush()
+}
+
+// writeTimeline
+// Counts the events of the coordinator in equal stretches of the run, followed by the events that change who takes
+// part in it
+func writeTimeline(out io.Writer, events []misc.Event, start time.Time, end time.Time) error {
+	step := timelineSteps[len(timelineSteps)-1]
+	for _, s := range timelineSteps {
+		if end.Sub(start) < s*timelineRows {
+			step = s
+			break
+		}
+	}
+	rows := make([]timelineRow, int(end.Sub(start)/step)+1)
+	online := make(map[string]bool)
+	counted := 0 // Rows before this one are over, their workers are counted
+	var notable []string
+	for _, event := range events {
+		offset := event.Time.Sub(start)
+		index := int(offset / step)
+		for ; counted < index; counted++ {
+			rows[counted].Workers = len(online)
+		}
+		row := &rows[index]
+		if event.Source != misc.CoordinatorSource {
+			if event.Kind == misc.WorkerPaused || event.Kind == misc.WorkerResumed {
+				notable = append(notable, fmt.Sprintf("%s\t%s\t%s", offset.Round(time.Second), event.Worker, event.Kind))
+			}
+			continue
+		}
+		switch event.Kind {
+		case misc.TaskIssued:
+			row.Issued++
+		case misc.TaskReturned:
+			row.Returned++
+		case misc.TaskRequeued:
+			row.Requeued++
+		case misc.FrameSaved:
+			row.Frames++
+		case misc.WorkerJoined:
+			online[event.Worker] = true
+		case misc.WorkerLeft:
+			delete(online, event.Worker)
+		case misc.RunStopped:
+			online = make(map[string]bool)
+		}
+		if event.Kind != misc.TaskIssued && event.Kind != misc.TaskReturned && event.Kind != misc.TaskRequeued && event.Kind != misc.FrameSaved {
+			notable = append(notable, fmt.Sprintf("%s\t%s\t%s", offset.Round(time.Second), event.Worker, describeEvent(event)))
+		}
+	}
+
+	for ; counted < len(rows); counted++ {
+		rows[counted].Workers = len(online)
+	}
+
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(table, "TIME\tWORKERS\tISSUED\tRETURNED\tREQUEUED\tFRAMES")
+	for i, row := range rows {
+		_, _ = fmt.Fprintf(table, "%s\t%d\t%d\t%d\t%d\t%d\n", time.Duration(i)*step, row.Workers, row.Issued, row.Returned, row.Requeued, row.Frames)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintln(out)
+	table = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(table, "TIME\tWORKER\tEVENT")
+	for _, line := range notable {
+		_, _ = fmt.Fprintln(table, line)
+	}
+	return table.Flush()
+}
+
+func describeEvent(event misc.Event) string {
+	description := event.Kind.String()
+	if event.Kind == misc.MovieEncoded {
+		description += fmt.Sprintf(" in %s", event.Elapsed.Round(time.Second))
+	}
+	if event.Reason != "" {
+		description += " (" + strings.TrimSpace(event.Reason) + ")"
+	}
+	return description
+}
@@ -0,0 +1,375 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/task"
+	"container/heap"
+	"math"
+	"sync"
+)
+
+// schedulerSettings
+// QueueSize is the number of generated tasks waiting for a worker before generation pauses. SpeculativeCopies is the
+// number of extra copies of an outstanding task that can be handed to workers with nothing else to do, the first copy
+// to come back wins. Copies of the last tasks of the oldest open image are handed out ahead of the queued tasks of
+// newer images, so one slow worker does not hold that image open. Zero turns speculation off.
+//
+// With TaskSeconds set, consecutive tasks of an image are merged so each worker gets about that many seconds of work
+// per task, up to MaxBatch tasks. The time a worker needs per task is estimated from its benchmark until its own tasks
+// have been timed.
+type schedulerSettings struct {
+	MaxBatch          uint
+	QueueSize         uint
+	SpeculativeCopies uint
+	TaskSeconds       float64
+}
+
+func (ss *schedulerSettings) Verify() error {
+	if ss.MaxBatch == 0 {
+		ss.MaxBatch = 16
+	}
+	if ss.QueueSize == 0 {
+		ss.QueueSize = 1000
+	}
+	if ss.TaskSeconds < 0 {
+		ss.TaskSeconds = 0
+	}
+	return nil
+}
+
+// scheduler
+// Hands out tasks from the oldest image first. Tasks are generated image by image so their ids already follow the
+// image order, and tasks taken back from a worker that left go ahead of everything else so a lost row does not hold
+// its image open for the rest of the run.
+type scheduler struct {
+	closed            bool // No more tasks will be added
+	cond              *sync.Cond
+	done              map[uint]bool // Tasks that came back or were cancelled
+	handedOut         map[uint]*scheduledTask
+	late              map[uint]map[string]bool // Workers still holding a copy of a task that came back or was cancelled
+	pruneAt           int                      // Size of done at which it is pruned next
+	queue             taskQueue
+	queueSize         int
+	speculativeCopies uint
+	stopped           bool // Nothing is handed out or added any more
+}
+
+type scheduledTask struct {
+	Task    task.Task
+	Workers map[string]bool // Workers that have a copy of the task
+}
+
+func newScheduler(s schedulerSettings) *scheduler {
+	return &scheduler{
+		cond:              sync.NewCond(&sync.Mutex{}),
+		done:              make(map[uint]bool),
+		handedOut:         make(map[uint]*scheduledTask),
+		late:              make(map[uint]map[string]bool),
+		pruneAt:           int(s.QueueSize),
+		queueSize:         int(s.QueueSize),
+		speculativeCopies: s.SpeculativeCopies,
+	}
+}
+
+// Add
+// Queues a new task, waiting while the queue is full
+func (s *scheduler) Add(t task.Task) {
+	s.cond.L.Lock()
+	defer s.cond.L.Unlock()
+	for s.queue.Len() >= s.queueSize && !s.closed && !s.stopped {
+		s.cond.Wait()
+	}
+	if s.stopped {
+		return
+	}
+	heap.Push(&s.queue, queuedTask{Task: t})
+	s.cond.Broadcast()
+}
+
+// Close
+// Marks that every task has been added. Workers are told there is no more work once every task has come back
+func (s *scheduler) Close() {
+	s.cond.L.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.cond.L.Unlock()
+}
+
+// Stop
+// Stops handing out tasks on shutdown. Workers waiting for a task are told there is no more work and new tasks are
+// dropped
+func (s *scheduler) Stop() {
+	s.cond.L.Lock()
+	s.stopped = true
+	s.cond.Broadcast()
+	s.cond.L.Unlock()
+}
+
+// Next
+// Returns the next task for the worker, waiting for one when there is nothing to hand out. Up to batch tasks of the
+// same image are merged into one. ok is false once every task has come back.
+func (s *scheduler) Next(workerAddress string, batch int) (task.Task, bool) {
+	return s.next(workerAddress, batch, true)
+}
+
+// TryNext
+// Same as Next but returns straight away, with ok false, when no task is queued
+func (s *scheduler) TryNext(workerAddress string, batch int) (task.Task, bool) {
+	return s.next(workerAddress, batch, false)
+}
+
+func (s *scheduler) next(workerAddress string, batch int, wait bool) (task.Task, bool) {
+	s.cond.L.Lock()
+	defer s.cond.L.Unlock()
+	for {
+		if s.stopped {
+			return task.Task{}, false
+		}
+		if wait && s.speculativeCopies > 0 {
+			if t, ok := s.speculateOldestImage(workerAddress); ok {
+				return t, true
+			}
+		}
+		for s.queue.Len() > 0 {
+			queued := heap.Pop(&s.queue).(queuedTask)
+			if s.done[queued.Task.ID] {
+				continue
+			}
+			for merged := 1; merged < batch && s.queue.Len() > 0; {
+				next := s.queue[0]
+				if !s.done[next.Task.ID] {
+					if next.Task.ImageNumber != queued.Task.ImageNumber {
+						break
+					}
+					queued.Task.Merge(next.Task)
+					merged++
+				}
+				heap.Pop(&s.queue)
+			}
+			s.handOut(queued.Task, workerAddress)
+			s.cond.Broadcast()
+			return queued.Task, true
+		}
+
+		if !wait {
+			return task.Task{}, false
+		}
+		if t, ok := s.speculate(workerAddress, func(task.Task) bool { return true }); ok {
+			return t, true
+		}
+		if s.closed && len(s.handedOut) == 0 {
+			return task.Task{}, false
+		}
+		s.cond.Wait()
+	}
+}
+
+// speculateOldestImage
+// Picks an outstanding task of the oldest open image once none of its tasks are left in the queue. The caller must hold
+// the lock
+func (s *scheduler) speculateOldestImage(workerAddress string) (task.Task, bool) {
+	var oldestImage uint
+	open := false
+	for _, scheduled := range s.handedOut {
+		if !open || scheduled.Task.ImageNumber < oldestImage {
+			oldestImage, open = scheduled.Task.ImageNumber, true
+		}
+	}
+	if !open {
+		return task.Task{}, false
+	}
+	for _, queued := range s.queue {
+		if !s.done[queued.Task.ID] && queued.Task.ImageNumber <= oldestImage {
+			return task.Task{}, false
+		}
+	}
+	return s.speculate(workerAddress, func(t task.Task) bool { return t.ImageNumber == oldestImage })
+}
+
+// speculate
+// Picks the oldest outstanding task accepted by include that the worker does not have yet and that has fewer than the
+// allowed copies out. The caller must hold the lock
+func (s *scheduler) speculate(workerAddress string, include func(task.Task) bool) (task.Task, bool) {
+	var oldest *scheduledTask
+	for _, scheduled := range s.handedOut {
+		if uint(len(scheduled.Workers)) > s.speculativeCopies || scheduled.Workers[workerAddress] || !include(scheduled.Task) {
+			continue
+		}
+		if oldest == nil || scheduled.Task.ID < oldest.Task.ID {
+			oldest = scheduled
+		}
+	}
+	if oldest == nil {
+		return task.Task{}, false
+	}
+	oldest.Workers[workerAddress] = true
+	return oldest.Task, true
+}
+
+func (s *scheduler) handOut(t task.Task, workerAddress string) {
+	scheduled, ok := s.handedOut[t.ID]
+	if !ok {
+		scheduled = &scheduledTask{Task: t, Workers: make(map[string]bool)}
+		s.handedOut[t.ID] = scheduled
+	}
+	scheduled.Workers[workerAddress] = true
+}
+
+// Complete
+// Records a returned task. Returns false when another copy of the task already came back
+func (s *scheduler) Complete(t task.Task) bool {
+	s.cond.L.Lock()
+	defer s.cond.L.Unlock()
+	if s.done[t.ID] {
+		s.returned(t.ID, t.WorkerAddress)
+		return false
+	}
+	for _, id := range t.IDs() {
+		s.done[id] = true
+	}
+	if scheduled, ok := s.handedOut[t.ID]; ok {
+		delete(scheduled.Workers, t.WorkerAddress)
+		s.finish(t.ID, scheduled)
+	}
+	s.pruneDone()
+	s.cond.Broadcast()
+	return true
+}
+
+// Cancel
+// Drops a task that is no longer needed, whether it is queued or handed out
+func (s *scheduler) Cancel(id uint) {
+	s.cond.L.Lock()
+	s.done[id] = true
+	if scheduled, ok := s.handedOut[id]; ok {
+		s.finish(id, scheduled)
+	}
+	s.pruneDone()
+	s.cond.Broadcast()
+	s.cond.L.Unlock()
+}
+
+// finish
+// Stops tracking a task as outstanding. The workers that still have a copy are remembered so the task stays done until
+// every copy is back. The caller must hold the lock
+func (s *scheduler) finish(id uint, scheduled *scheduledTask) {
+	delete(s.handedOut, id)
+	if len(scheduled.Workers) > 0 {
+		s.late[id] = scheduled.Workers
+	}
+}
+
+// returned
+// Records that the worker no longer has a copy of a task that is done. The caller must hold the lock
+func (s *scheduler) returned(id uint, workerAddress string) {
+	if workers, ok := s.late[id]; ok {
+		delete(workers, workerAddress)
+		if len(workers) == 0 {
+			delete(s.late, id)
+		}
+	}
+}
+
+// pruneDone
+// Forgets the done tasks below the lowest id that is still queued or held by a worker, since none of them can come
+// back. Waits until done has grown past pruneAt so the queue is not scanned for every task. The caller must hold the
+// lock
+func (s *scheduler) pruneDone() {
+	if len(s.done) < s.pruneAt {
+		return
+	}
+	lowest := uint(math.MaxUint)
+	for id := range s.handedOut {
+		if id < lowest {
+			lowest = id
+		}
+	}
+	for id := range s.late {
+		if id < lowest {
+			lowest = id
+		}
+	}
+	for _, queued := range s.queue {
+		if queued.Task.ID < lowest {
+			lowest = queued.Task.ID
+		}
+	}
+	for id := range s.done {
+		if id < lowest {
+			delete(s.done, id)
+		}
+	}
+	s.pruneAt = s.queueSize
+	if 2*len(s.done) > s.pruneAt {
+		s.pruneAt = 2 * len(s.done)
+	}
+}
+
+// Redo
+// Queues a task that calculates pixels again in front of the generated tasks, without waiting for room in the queue
+func (s *scheduler) Redo(t task.Task) {
+	s.cond.L.Lock()
+	heap.Push(&s.queue, queuedTask{Requeued: true, Task: t})
+	s.cond.Broadcast()
+	s.cond.L.Unlock()
+}
+
+// Retry
+// Queues a task that came back but has to be calculated again, in front of the generated tasks
+func (s *scheduler) Retry(t task.Task) {
+	s.cond.L.Lock()
+	for _, id := range t.IDs() {
+		delete(s.done, id)
+	}
+	heap.Push(&s.queue, queuedTask{Requeued: true, Task: t})
+	s.cond.Broadcast()
+	s.cond.L.Unlock()
+}
+
+// Requeue
+// Takes a task back from a worker that left. It goes to the front of the queue unless another copy is still out
+func (s *scheduler) Requeue(t task.Task, workerAddress string) {
+	s.cond.L.Lock()
+	defer s.cond.L.Unlock()
+	if s.done[t.ID] {
+		s.returned(t.ID, workerAddress)
+		return
+	}
+	if scheduled, ok := s.handedOut[t.ID]; ok {
+		delete(scheduled.Workers, workerAddress)
+		if len(scheduled.Workers) > 0 {
+			return
+		}
+		delete(s.handedOut, t.ID)
+	}
+	heap.Push(&s.queue, queuedTask{Requeued: true, Task: t})
+	s.cond.Broadcast()
+}
+
+type queuedTask struct {
+	Requeued bool
+	Task     task.Task
+}
+
+// taskQueue
+// A heap of tasks with requeued tasks first, then in order of id
+type taskQueue []queuedTask
+
+func (q taskQueue) Len() int { return len(q) }
+
+func (q taskQueue) Less(i, j int) bool {
+	if q[i].Requeued != q[j].Requeued {
+		return q[i].Requeued
+	}
+	return q[i].Task.ID < q[j].Task.ID
+}
+
+func (q taskQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *taskQueue) Push(x interface{}) { *q = append(*q, x.(queuedTask)) }
+
+func (q *taskQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
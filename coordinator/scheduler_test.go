@@ -0,0 +1,233 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/task"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSchedulerOrder(t *testing.T) {
+	tasks := func(imageNumbers ...uint) []task.Task {
+		generated := make([]task.Task, len(imageNumbers))
+		for i, imageNumber := range imageNumbers {
+			generated[i] = task.NewTask(uint(i), imageNumber)
+		}
+		return generated
+	}
+
+	tests := []struct {
+		name  string
+		tasks []task.Task
+		batch int
+		setup func(s *scheduler, tasks []task.Task) // Runs after the tasks were added
+		want  [][]uint                              // IDs of the tasks handed out to a worker until none are left
+	}{
+		{
+			name:  "oldest first",
+			tasks: tasks(1, 1, 2),
+			batch: 1,
+			setup: func(s *scheduler, tasks []task.Task) {},
+			want:  [][]uint{{0}, {1}, {2}},
+		},
+		{
+			name:  "merged within an image",
+			tasks: tasks(1, 1, 1, 2, 2),
+			batch: 2,
+			setup: func(s *scheduler, tasks []task.Task) {},
+			want:  [][]uint{{0, 1}, {2}, {3, 4}},
+		},
+		{
+			name:  "cancelled tasks are skipped",
+			tasks: tasks(1, 1, 1),
+			batch: 3,
+			setup: func(s *scheduler, tasks []task.Task) { s.Cancel(1) },
+			want:  [][]uint{{0, 2}},
+		},
+		{
+			name:  "requeued tasks go first",
+			tasks: tasks(1, 1, 1),
+			batch: 1,
+			setup: func(s *scheduler, tasks []task.Task) {
+				handedOut, _ := s.TryNext("a", 1)
+				s.TryNext("a", 1)
+				s.Requeue(handedOut, "a")
+			},
+			want: [][]uint{{0}, {2}},
+		},
+		{
+			name:  "returned tasks are not requeued",
+			tasks: tasks(1, 1),
+			batch: 1,
+			setup: func(s *scheduler, tasks []task.Task) {
+				handedOut, _ := s.TryNext("a", 1)
+				s.Complete(handedOut)
+				s.Requeue(handedOut, "a")
+			},
+			want: [][]uint{{1}},
+		},
+		{
+			name:  "retried tasks go first",
+			tasks: tasks(1, 1, 1),
+			batch: 1,
+			setup: func(s *scheduler, tasks []task.Task) {
+				handedOut, _ := s.TryNext("a", 2)
+				s.Complete(handedOut)
+				s.Retry(handedOut)
+			},
+			want: [][]uint{{0, 1}, {2}},
+		},
+		{
+			name:  "redone tasks go first",
+			tasks: tasks(1, 1),
+			batch: 1,
+			setup: func(s *scheduler, tasks []task.Task) { s.Redo(task.NewTask(5, 1)) },
+			want:  [][]uint{{5}, {0}, {1}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScheduler(schedulerSettings{QueueSize: 100})
+			for _, generated := range test.tasks {
+				s.Add(generated)
+			}
+			s.Close()
+			test.setup(s, test.tasks)
+
+			var got [][]uint
+			for {
+				handedOut, ok := s.TryNext("b", test.batch)
+				if !ok {
+					break
+				}
+				got = append(got, handedOut.IDs())
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("handed out %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSchedulerSpeculativeCopies(t *testing.T) {
+	s := newScheduler(schedulerSettings{QueueSize: 100, SpeculativeCopies: 1})
+	s.Add(task.NewTask(0, 1))
+	s.Close()
+
+	first, ok := s.Next("a", 1)
+	if !ok {
+		t.Fatal("no task was handed out")
+	}
+	// Nothing is queued, so the worker with nothing to do gets a copy of the task that is out
+	copied, ok := s.Next("b", 1)
+	if !ok || copied.ID != first.ID {
+		t.Fatalf("got task %d (%t), want a copy of task %d", copied.ID, ok, first.ID)
+	}
+	if !s.Complete(copied) {
+		t.Error("the first copy to come back was refused")
+	}
+	if s.Complete(first) {
+		t.Error("the second copy to come back was accepted")
+	}
+	s.Requeue(first, "a")
+	if requeued, ok := s.TryNext("c", 1); ok {
+		t.Errorf("task %d that came back was handed out again", requeued.ID)
+	}
+}
+
+func TestSchedulerNextDone(t *testing.T) {
+	s := newScheduler(schedulerSettings{QueueSize: 100})
+	s.Add(task.NewTask(0, 1))
+	s.Close()
+	handedOut, ok := s.Next("a", 1)
+	if !ok {
+		t.Fatal("no task was handed out")
+	}
+
+	// A worker asking for more waits until the task that is out comes back, then hears there is no more work
+	done := make(chan bool)
+	go func() {
+		_, ok := s.Next("b", 1)
+		done <- ok
+	}()
+	select {
+	case <-done:
+		t.Fatal("Next returned while a task was still out")
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.Complete(handedOut)
+	select {
+	case ok = <-done:
+		if ok {
+			t.Error("a task was handed out after every task came back")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Next did not return once every task came back")
+	}
+}
+
+func TestSchedulerSpeculateOldestImage(t *testing.T) {
+	s := newScheduler(schedulerSettings{QueueSize: 100, SpeculativeCopies: 1})
+	s.Add(task.NewTask(0, 1))
+	s.Add(task.NewTask(1, 1))
+	s.Add(task.NewTask(2, 2))
+	s.Close()
+
+	s.Next("a", 1)
+	last, _ := s.Next("b", 1)
+	// Both tasks of image 1 are out, so its oldest task is copied before image 2 is started
+	copied, ok := s.Next("c", 1)
+	if !ok || copied.ID != 0 {
+		t.Fatalf("got task %d (%t), want a copy of task 0", copied.ID, ok)
+	}
+	copied, ok = s.Next("a", 1)
+	if !ok || copied.ID != last.ID {
+		t.Fatalf("got task %d (%t), want a copy of task %d", copied.ID, ok, last.ID)
+	}
+	// Every task of image 1 has its copy out, so the queue goes on
+	next, ok := s.Next("d", 1)
+	if !ok || next.ID != 2 {
+		t.Fatalf("got task %d (%t), want task 2", next.ID, ok)
+	}
+}
+
+func TestSchedulerPruneDone(t *testing.T) {
+	s := newScheduler(schedulerSettings{QueueSize: 4, SpeculativeCopies: 1})
+	go func() {
+		for id := uint(0); id < 20; id++ {
+			s.Add(task.NewTask(id, id))
+		}
+		s.Close()
+	}()
+
+	// Task 0 gets a copy that stays out while every other task comes back
+	first, _ := s.Next("a", 1)
+	first.WorkerAddress = "a"
+	copied, _ := s.Next("b", 1)
+	if copied.ID != first.ID {
+		t.Fatalf("got task %d, want a copy of task %d", copied.ID, first.ID)
+	}
+	s.Complete(first)
+	for {
+		handedOut, ok := s.Next("a", 1)
+		if !ok {
+			break
+		}
+		handedOut.WorkerAddress = "a"
+		s.Complete(handedOut)
+	}
+	if !s.done[first.ID] {
+		t.Fatal("the task with a copy still out was forgotten")
+	}
+
+	// Once the copy is back nothing can come back any more
+	copied.WorkerAddress = "b"
+	if s.Complete(copied) {
+		t.Error("the second copy to come back was accepted")
+	}
+	s.pruneAt = 0
+	s.Cancel(20)
+	if len(s.done) > 1 {
+		t.Errorf("%d done tasks are still remembered", len(s.done))
+	}
+}
@@ -0,0 +1,69 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/misc"
+	"DistributedMandelbrot/transport"
+)
+
+// secured
+// Returns true when connections go through a guard and connectors. Connections within the process are not secured
+func (c *Coordinator) secured() bool {
+	_, tcp := c.transport.(transport.TCP)
+	return tcp && c.settings.SecuritySettings.Enabled()
+}
+
+// listen
+// Starts the rpc server. When the connections are secured it only listens on the loopback address and a guard on the
+// server address lets in the workers that authenticate
+func (c *Coordinator) listen() {
+	address := c.settings.ServerAddress
+	if c.secured() {
+		guard, err := misc.NewGuard(c.settings.SecuritySettings, address, c.logger)
+		misc.CheckError(err, c.logger, misc.Fatal)
+		c.guard = guard
+		address = guard.InternalAddress
+	}
+	c.Server = c.transport.NewServer(c, address, "CoordinatorServer")
+	misc.CheckError(c.Server.Run(), c.logger, misc.Fatal)
+}
+
+// stopListening
+// Stops the rpc server, its guard, the HTTP server and the announcements
+func (c *Coordinator) stopListening() {
+	if c.advertiser != nil {
+		misc.CheckError(c.advertiser.Close(), c.logger, misc.Warning)
+	}
+	misc.CheckError(c.Server.Stop(), c.logger, misc.Warning)
+	if c.guard != nil {
+		misc.CheckError(c.guard.Close(), c.logger, misc.Warning)
+	}
+	if c.httpServer != nil {
+		misc.CheckError(c.httpServer.Close(), c.logger, misc.Warning)
+	}
+}
+
+// newWorkerClient
+// Returns a client for calling back to a worker, going through a connector when the connections are secured. The
+// client is named after the worker's address either way
+func (c *Coordinator) newWorkerClient(workerAddress string) (transport.Worker, error) {
+	if !c.secured() {
+		return transport.NewWorker(c.transport.NewCaller(workerAddress, workerAddress)), nil
+	}
+	connector, err := misc.NewConnector(c.settings.SecuritySettings, workerAddress, c.logger)
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	c.connectors[workerAddress] = connector
+	c.mutex.Unlock()
+	return transport.NewWorker(c.transport.NewCaller(connector.Address, workerAddress)), nil
+}
+
+// closeWorkerClient
+// Closes the connector of a worker that left. The caller must hold the lock
+func (c *Coordinator) closeWorkerClient(workerAddress string) {
+	if connector, ok := c.connectors[workerAddress]; ok {
+		misc.CheckError(connector.Close(), c.logger, misc.Warning)
+		delete(c.connectors, workerAddress)
+	}
+}
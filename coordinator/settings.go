@@ -16,13 +16,25 @@ import (
 type settings struct {
 	logger bslogger.Logger
 
-	GenerateMovie      bool
-	MandelbrotSettings mandelbrot.Settings
-	RunName            string
-	SavePath           string
-	ServerAddress      string
-	TaskGeneration     task.Generation
-	TransitionSettings []transitionSettings
+	AutoIterations       autoIterationsSettings
+	DiscoverySettings    discoverySettings
+	DrainTimeout         uint // Seconds workers get to return their tasks on shutdown
+	ExplorerSettings     explorerSettings
+	GenerateMovie        bool
+	HTTPSettings         httpSettings
+	ImageFormat          ImageFormat
+	KeyframeSettings     keyframeSettings
+	MandelbrotSettings   mandelbrot.Settings
+	MemorySettings       memorySettings
+	PosterSettings       posterSettings
+	RunName              string
+	SavePath             string
+	SchedulerSettings    schedulerSettings
+	SecuritySettings     misc.SecuritySettings
+	ServerAddress        string
+	TaskGeneration       task.Generation
+	TransitionSettings   []transitionSettings
+	VerificationSettings verificationSettings
 }
 
 func NewSettings(settingsFile string) settings {
@@ -47,12 +59,35 @@ func (s *settings) String() string {
 func (s *settings) Verify() error {
 	// GenerateMovie defaults to false already
 	misc.CheckError(s.MandelbrotSettings.Verify(), s.logger, misc.Fatal)
+	misc.CheckError(s.AutoIterations.Verify(s.MandelbrotSettings.MaxIterations), s.logger, misc.Warning)
+	misc.CheckError(s.DiscoverySettings.Verify(), s.logger, misc.Warning)
+	if s.DrainTimeout == 0 {
+		s.DrainTimeout = 60
+	}
+	misc.CheckError(s.ExplorerSettings.Verify(), s.logger, misc.Warning)
+	misc.CheckError(s.HTTPSettings.Verify(s.SecuritySettings), s.logger, misc.Fatal)
+	if s.ImageFormat < JPEG || s.ImageFormat > PNG {
+		s.ImageFormat = JPEG
+	}
+	if s.ImageFormat == JPEG && s.MandelbrotSettings.HasTransparency() {
+		s.ImageFormat = PNG
+		s.logger.Info("JPEG images cannot be transparent. Saving images as PNG instead.")
+	}
+	misc.CheckError(s.KeyframeSettings.Verify(), s.logger, misc.Warning)
+	misc.CheckError(s.MemorySettings.Verify(), s.logger, misc.Warning)
+	misc.CheckError(s.PosterSettings.Verify(), s.logger, misc.Fatal)
+	if s.PosterSettings.Enabled && s.GenerateMovie {
+		s.GenerateMovie = false
+		s.logger.Info("A poster is a single image. Disabling GenerateMovie.")
+	}
 	if s.RunName == "" {
 		s.RunName = "run_" + time.Now().Format("2006_01_02-03_04_05")
 	}
 	if s.SavePath == "" {
 		s.SavePath, _ = os.Getwd()
 	}
+	misc.CheckError(s.SchedulerSettings.Verify(), s.logger, misc.Warning)
+	misc.CheckError(s.SecuritySettings.Verify(), s.logger, misc.Fatal)
 	if s.ServerAddress == "" {
 		s.ServerAddress = fmt.Sprintf("%s:%s", misc.GetLocalAddress(), "51000")
 	}
@@ -70,6 +105,8 @@ func (s *settings) Verify() error {
 		}
 	}
 
+	misc.CheckError(s.VerificationSettings.Verify(), s.logger, misc.Warning)
+
 	// Verify each of the transition settings objects
 	for i := 0; i < len(s.TransitionSettings); i++ {
 		misc.CheckError(s.TransitionSettings[i].Verify(), s.logger, misc.Warning)
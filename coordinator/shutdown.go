@@ -0,0 +1,364 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/mandelbrot"
+	"DistributedMandelbrot/misc"
+	"DistributedMandelbrot/task"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var errShuttingDown = errors.New("coordinator shutting down")
+
+// checkpoint
+// What a run that was shut down part way through had done. The partially calculated images are kept in Folder and the
+// run carries on from there when the coordinator is started again with the same settings. A resumed run keeps the
+// checkpoint until it writes the next one or finishes, so it can still be resumed after a crash
+type checkpoint struct {
+	Folder              string // Folder in the run folder holding the partial images
+	ImageCompletedCount uint
+	ImageCount          uint
+	Frames              []frameMetadata
+	Images              []checkpointImage
+	LatestStatistics    *task.Statistics
+	Resampled           []uint // Keyframes whose frames were saved
+	SettingsHash        string // Of the settings that decide what the pixels come out as
+	TaskCount           uint   // Tasks the settings make, without the tasks calculated again after a quarantine
+}
+
+// checkpointImage
+// An image the workers calculate. A completed image is not calculated again, the tasks of a partial image that are
+// listed are not handed out again
+type checkpointImage struct {
+	Completed     bool
+	ImageNumber   uint
+	MaxIterations uint
+	Tasks         []uint
+}
+
+func (c *Coordinator) checkpointPath() string {
+	return filepath.Join(c.settings.SavePath, c.settings.RunName, "checkpoint.json")
+}
+
+func (c *Coordinator) checkpointImagePath(folder string, imageNumber int) string {
+	return filepath.Join(c.settings.SavePath, c.settings.RunName, folder, fmt.Sprintf("%d.gob", imageNumber))
+}
+
+// settingsHash
+// Returns a hash of the settings that decide the pixels of the run, a checkpoint of other settings cannot be resumed
+func (c *Coordinator) settingsHash() (string, error) {
+	marshaled, err := json.Marshal(struct {
+		AutoIterations     autoIterationsSettings
+		KeyframeSettings   keyframeSettings
+		MandelbrotSettings mandelbrot.Settings
+		TaskGeneration     task.Generation
+		TransitionSettings []transitionSettings
+	}{
+		AutoIterations:     c.settings.AutoIterations,
+		KeyframeSettings:   c.settings.KeyframeSettings,
+		MandelbrotSettings: c.settings.MandelbrotSettings,
+		TaskGeneration:     c.settings.TaskGeneration,
+		TransitionSettings: c.settings.TransitionSettings,
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(marshaled)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// removeCheckpoint
+// Removes the checkpoint and the images it points at
+func (c *Coordinator) removeCheckpoint() {
+	if c.checkpointFolder != "" {
+		misc.CheckError(os.RemoveAll(filepath.Join(c.settings.SavePath, c.settings.RunName, c.checkpointFolder)), c.logger, misc.Warning)
+	}
+	if err := os.Remove(c.checkpointPath()); err != nil && !os.IsNotExist(err) {
+		misc.CheckError(err, c.logger, misc.Warning)
+	}
+}
+
+// Shutdown
+// Stops handing out tasks and gives the workers DrainTimeout seconds to return the tasks they have and leave. What
+// came back by then is written to a checkpoint. Returns straight away, the Server stops once the coordinator is done
+func (c *Coordinator) Shutdown() {
+	c.mutex.Lock()
+	if c.finishing {
+		c.mutex.Unlock()
+		c.logger.Info("Every task is in already, finishing the run")
+		return
+	}
+	c.finishing = true
+	c.mutex.Unlock()
+
+	c.logger.Info("Shutting down, no more tasks are handed out")
+	close(c.shutdown)
+	c.scheduler.Stop()
+
+	go func() {
+		left := make(chan struct{})
+		go func() {
+			c.workerWait.Wait()
+			close(left)
+		}()
+		select {
+		case <-left:
+		case <-time.After(time.Duration(c.settings.DrainTimeout) * time.Second):
+			c.logger.Warningf("Workers did not leave within %d seconds, their tasks are calculated again", c.settings.DrainTimeout)
+		}
+
+		// The explorer keeps nothing worth a checkpoint
+		if c.tileRequests != nil {
+			c.stopListening()
+			return
+		}
+		close(c.drained)
+	}()
+}
+
+func (c *Coordinator) shuttingDown() bool {
+	select {
+	case <-c.shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// nextDoneTask
+// Waits for the next returned task. Returns false on shutdown once the workers were drained and every task they
+// returned has been taken, returned tasks are refused from then on
+func (c *Coordinator) nextDoneTask() (task.Task, bool) {
+	select {
+	case t := <-c.tasksDone:
+		return t, true
+	case <-c.drained:
+	}
+	c.mutex.Lock()
+	c.stopped = true
+	c.mutex.Unlock()
+	select {
+	case t := <-c.tasksDone:
+		return t, true
+	default:
+		return task.Task{}, false
+	}
+}
+
+// stopRun
+// Writes the checkpoint once the workers were drained and stops the coordinator
+func (c *Coordinator) stopRun() {
+	c.logger.Infof("Stopped ingesting with %d of %d tasks in", c.taskIngestedCount, c.taskCount)
+	if c.settings.PosterSettings.Enabled {
+		c.logger.Warning("Posters cannot be resumed, the run starts over when it is started again")
+	} else {
+		misc.CheckError(c.writeCheckpoint(), c.logger, misc.Error)
+	}
+	c.saveFrames()
+
+	c.logger.Info("Shutting Down")
+	c.closeJournal("shut down")
+	c.stopListening()
+}
+
+// recordProgress
+// Notes the tasks that made it into an image so a checkpoint knows what is left to calculate
+func (c *Coordinator) recordProgress(t task.Task) {
+	progress, ok := c.imageProgress[t.ImageNumber]
+	if !ok {
+		progress = &checkpointImage{
+			ImageNumber:   t.ImageNumber,
+			MaxIterations: t.MaxIterations,
+		}
+		c.imageProgress[t.ImageNumber] = progress
+	}
+	progress.Tasks = append(progress.Tasks, t.IDs()...)
+}
+
+// writeCheckpoint
+// Writes the images in memory and the spilled images to a new checkpoint folder and records the progress of the run.
+// Images still waiting on pixels to be calculated again after a worker was quarantined are left out and calculated from
+// scratch. The checkpoint the run resumed from is only removed once the new one is in place
+func (c *Coordinator) writeCheckpoint() error {
+	hash, err := c.settingsHash()
+	if err != nil {
+		return err
+	}
+	cp := checkpoint{
+		Folder:              fmt.Sprintf("checkpoint-%d", time.Now().UnixNano()),
+		ImageCompletedCount: c.imageCompletedCount,
+		ImageCount:          c.imageCount,
+		SettingsHash:        hash,
+		TaskCount:           c.plannedTaskCount,
+	}
+
+	c.mutex.Lock()
+	cp.LatestStatistics = c.latestStatistics
+	redo := make(map[uint]bool, len(c.redoPending))
+	for imageNumber := range c.redoPending {
+		redo[imageNumber] = true
+	}
+	images := make(map[int]imageTask, len(c.images))
+	for imageNumber, image := range c.images {
+		images[imageNumber] = image
+	}
+	spilled := make([]int, 0, len(c.spilledImages))
+	for imageNumber := range c.spilledImages {
+		spilled = append(spilled, imageNumber)
+	}
+	checkpointed := make([]int, 0, len(c.checkpointImages))
+	for imageNumber := range c.checkpointImages {
+		checkpointed = append(checkpointed, imageNumber)
+	}
+	for _, frame := range c.frames {
+		cp.Frames = append(cp.Frames, frame)
+	}
+	for imageNumber, k := range c.keyframes {
+		if k.Resampled {
+			cp.Resampled = append(cp.Resampled, imageNumber)
+		}
+	}
+	c.mutex.Unlock()
+
+	// Every partial image goes into the new folder: the ones in memory are written, spilled ones are moved and the ones
+	// untouched since the run resumed are copied from the folder of the old checkpoint
+	folder := filepath.Join(c.settings.SavePath, c.settings.RunName, cp.Folder)
+	if err = os.MkdirAll(folder, os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create checkpoint folder %s - %s", folder, err)
+	}
+	for imageNumber, image := range images {
+		if redo[uint(imageNumber)] {
+			continue
+		}
+		if err = encodeImageTask(c.checkpointImagePath(cp.Folder, imageNumber), image); err != nil {
+			return fmt.Errorf("unable to write image %d to the checkpoint - %s", imageNumber, err)
+		}
+	}
+	for _, imageNumber := range spilled {
+		if redo[uint(imageNumber)] {
+			continue
+		}
+		if err = os.Rename(c.spillPath(imageNumber), c.checkpointImagePath(cp.Folder, imageNumber)); err != nil {
+			return fmt.Errorf("unable to move image %d to the checkpoint - %s", imageNumber, err)
+		}
+	}
+	for _, imageNumber := range checkpointed {
+		if redo[uint(imageNumber)] {
+			continue
+		}
+		if err = copyFile(c.checkpointImagePath(c.checkpointFolder, imageNumber), c.checkpointImagePath(cp.Folder, imageNumber)); err != nil {
+			return fmt.Errorf("unable to copy image %d to the checkpoint - %s", imageNumber, err)
+		}
+	}
+	for imageNumber, progress := range c.imageProgress {
+		// A keyframe held for its neighbours is calculated again, its frames that were saved are not saved again
+		k, isKeyframe := c.keyframes[imageNumber]
+		if redo[imageNumber] || (progress.Completed && isKeyframe && k.Image != nil) {
+			misc.CheckError(os.RemoveAll(c.checkpointImagePath(cp.Folder, int(imageNumber))), c.logger, misc.Warning)
+			continue
+		}
+		cp.Images = append(cp.Images, *progress)
+	}
+
+	// The new checkpoint replaces the old one in a single rename, so there always is one that matches its images
+	marshaled, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	written := c.checkpointPath() + ".new"
+	if _, err = misc.WriteFile(written, marshaled); err != nil {
+		return err
+	}
+	if err = os.Rename(written, c.checkpointPath()); err != nil {
+		return err
+	}
+	if c.checkpointFolder != "" {
+		misc.CheckError(os.RemoveAll(filepath.Join(c.settings.SavePath, c.settings.RunName, c.checkpointFolder)), c.logger, misc.Warning)
+	}
+	misc.CheckError(os.RemoveAll(filepath.Join(c.settings.SavePath, c.settings.RunName, "spill")), c.logger, misc.Warning)
+	c.logger.Infof("Wrote checkpoint to %s, start the run again to carry on", c.checkpointPath())
+	return nil
+}
+
+// resume
+// Picks up the checkpoint of an earlier run with the same name. A checkpoint of other settings is removed and the run
+// starts over, otherwise it is kept until the next checkpoint is written or the run finishes
+func (c *Coordinator) resume() error {
+	fileErr, bytes := misc.ReadFile(c.checkpointPath())
+	if fileErr != nil {
+		return nil
+	}
+
+	var cp checkpoint
+	if err := json.Unmarshal(bytes, &cp); err != nil {
+		misc.CheckError(os.Remove(c.checkpointPath()), c.logger, misc.Warning)
+		return fmt.Errorf("unable to read checkpoint, starting over - %s", err)
+	}
+	c.checkpointFolder = cp.Folder
+	hash, err := c.settingsHash()
+	if err != nil {
+		return err
+	}
+	if cp.ImageCount != c.imageCount || cp.TaskCount != c.plannedTaskCount || cp.SettingsHash != hash {
+		c.removeCheckpoint()
+		c.checkpointFolder = ""
+		return errors.New("the checkpoint is of different settings, starting over")
+	}
+
+	c.imageCompletedCount = cp.ImageCompletedCount
+	c.latestStatistics = cp.LatestStatistics
+	for _, frame := range cp.Frames {
+		c.frames[frame.ImageNumber] = frame
+	}
+	for _, imageNumber := range cp.Resampled {
+		if k, ok := c.keyframes[imageNumber]; ok {
+			k.Resampled = true
+		}
+	}
+	plans := make(map[uint]imagePlan, len(c.imagePlans))
+	for _, plan := range c.imagePlans {
+		plans[plan.ImageNumber] = plan
+	}
+	for _, image := range cp.Images {
+		progress := image
+		c.imageProgress[image.ImageNumber] = &progress
+		c.resumedImages[image.ImageNumber] = image
+		if image.Completed {
+			c.taskIngestedCount += c.taskCountForImage(plans[image.ImageNumber])
+			continue
+		}
+		c.checkpointImages[int(image.ImageNumber)] = true
+		c.taskIngestedCount += uint(len(image.Tasks))
+		for _, id := range image.Tasks {
+			c.resumedTasks[id] = true
+		}
+	}
+	c.logger.Infof("Resuming the run, %d of %d tasks are done", c.taskIngestedCount, c.taskCount)
+	return nil
+}
+
+// copyFile
+// Copies the file at from to a new file at to
+func copyFile(from string, to string) error {
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	destination, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(destination, source)
+	if closeErr := destination.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
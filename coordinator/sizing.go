@@ -0,0 +1,83 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/misc"
+	"DistributedMandelbrot/task"
+	"math"
+	"time"
+)
+
+// workerState
+// What the coordinator knows about how fast a worker is
+type workerState struct {
+	Benchmark      float64 // Iterations per second from the benchmark the worker ran when it joined
+	Calls          int     // HTTP requests of the worker in progress
+	Encoding       task.Encoding
+	Features       map[misc.Feature]bool // What the worker said it can do when it joined
+	LastSeen       time.Time             // When an HTTP worker last made a request
+	Quarantined    bool                  // A task of the worker failed verification
+	Returned       map[uint][]task.Task  // Tasks returned for images that are still open, kept while verifying
+	SecondsPerTask float64               // Measured seconds to calculate one generated task, zero until one of its tasks came back
+}
+
+// batchSize
+// Returns the number of tasks to merge for the worker so it gets about TaskSeconds of work. Poster and explorer tiles
+// are handled tile by tile so they are never merged
+func (c *Coordinator) batchSize(workerAddress string) int {
+	target := c.settings.SchedulerSettings.TaskSeconds
+	if target <= 0 || c.settings.PosterSettings.Enabled || c.tileRequests != nil {
+		return 1
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	state, ok := c.workers[workerAddress]
+	if !ok || !state.Features[misc.MergedTasksFeature] {
+		return 1
+	}
+	seconds := state.SecondsPerTask
+	if seconds == 0 && c.workPerTask > 0 && state.Benchmark > 0 {
+		// Not timed yet so scale the work other workers measured by this worker's benchmark
+		seconds = c.workPerTask / state.Benchmark
+	}
+	if seconds <= 0 {
+		return 1
+	}
+	batch := int(math.Round(target / seconds))
+	if batch < 1 {
+		return 1
+	}
+	if batch > int(c.settings.SchedulerSettings.MaxBatch) {
+		return int(c.settings.SchedulerSettings.MaxBatch)
+	}
+	return batch
+}
+
+// recordTaskDuration
+// Updates the estimates of how long the worker and, in benchmark iterations, the average task take
+func (c *Coordinator) recordTaskDuration(t task.Task) {
+	if t.Duration <= 0 {
+		return
+	}
+	seconds := t.Duration.Seconds() / float64(len(t.IDs()))
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	state, ok := c.workers[t.WorkerAddress]
+	if !ok {
+		return
+	}
+	state.SecondsPerTask = movingAverage(state.SecondsPerTask, seconds)
+	if state.Benchmark > 0 {
+		c.workPerTask = movingAverage(c.workPerTask, seconds*state.Benchmark)
+	}
+}
+
+// movingAverage
+// Exponential moving average that favors recent tasks since the cost of a task changes from image to image
+func movingAverage(average float64, value float64) float64 {
+	if average == 0 {
+		return value
+	}
+	return average + (value-average)*0.3
+}
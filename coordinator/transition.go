@@ -1,14 +1,24 @@
 package coordinator
 
+import (
+	"DistributedMandelbrot/misc"
+	"DistributedMandelbrot/task"
+)
+
 type transitionSettings struct {
-	EndX               float64
-	EndY               float64
-	FrameCount         uint
-	MagnificationStart float64
-	MagnificationEnd   float64
-	MagnificationStep  float64
-	StartX             float64
-	StartY             float64
+	EndX                float64
+	EndY                float64
+	FrameCount          uint
+	MagnificationStart  float64
+	MagnificationEnd    float64
+	MagnificationStep   float64
+	PaletteCycleSpeed   float64 // Palette colors the offset advances each frame
+	PaletteDensityEnd   float64
+	PaletteDensityStart float64 // Iterations per palette color
+	PaletteOffsetEnd    float64
+	PaletteOffsetStart  float64 // Palette colors to shift the palette by
+	StartX              float64
+	StartY              float64
 }
 
 func (ts *transitionSettings) Verify() error {
@@ -33,5 +43,31 @@ func (ts *transitionSettings) Verify() error {
 	if ts.MagnificationStep <= 1 {
 		ts.MagnificationStep = 1.1
 	}
+	if ts.PaletteDensityStart <= 0 {
+		ts.PaletteDensityStart = 1
+	}
+	if ts.PaletteDensityEnd <= 0 {
+		ts.PaletteDensityEnd = ts.PaletteDensityStart
+	}
 	return nil
 }
+
+// IsColorOnly
+// A color only transition keeps the same viewport for every frame and only moves the palette, so the iterations only
+// need to be calculated once
+func (ts *transitionSettings) IsColorOnly() bool {
+	return ts.StartX == ts.EndX && ts.StartY == ts.EndY && ts.MagnificationStart == ts.MagnificationEnd
+}
+
+// Coloring
+// Returns the palette offset and density for the given frame (1 based) of this transition
+func (ts *transitionSettings) Coloring(frame uint) task.Coloring {
+	t := 0.0
+	if ts.FrameCount > 1 {
+		t = float64(frame-1) / float64(ts.FrameCount-1)
+	}
+	return task.Coloring{
+		PaletteDensity: misc.LerpFloat64(ts.PaletteDensityStart, ts.PaletteDensityEnd, t),
+		PaletteOffset:  misc.LerpFloat64(ts.PaletteOffsetStart, ts.PaletteOffsetEnd, t) + ts.PaletteCycleSpeed*float64(frame-1),
+	}
+}
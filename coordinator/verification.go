@@ -0,0 +1,197 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/task"
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+// verificationSettings
+// Spot checks the results workers send back. SampleRate is the fraction of returned tasks that are checked, zero turns
+// checking off. SamplePixels pixels of a checked task are picked at random and recalculated by the coordinator, a pixel
+// agrees when no channel is more than Tolerance away. A task fails when more than a quarter of its checked pixels
+// disagree, which leaves room for the odd pixel subdivision filled in.
+//
+// A worker with a failed task is quarantined: it gets no more tasks, the tasks it has out are handed to other workers
+// and its earlier tasks of images that have not been saved yet are calculated again.
+type verificationSettings struct {
+	SamplePixels uint
+	SampleRate   float64
+	Tolerance    int
+}
+
+func (vs *verificationSettings) Verify() error {
+	if vs.SamplePixels == 0 {
+		vs.SamplePixels = 8
+	}
+	if vs.SampleRate < 0 || vs.SampleRate > 1 {
+		vs.SampleRate = 0
+		return errors.New("SampleRate must be between 0 and 1, turning verification off")
+	}
+	if vs.Tolerance <= 0 {
+		vs.Tolerance = 8
+	}
+	return nil
+}
+
+var errQuarantined = errors.New("worker quarantined")
+
+// verifyTask
+// Recalculates a random sample of the pixels of a returned task. Returns an error describing the disagreement when the
+// task fails
+func (c *Coordinator) verifyTask(done task.Task) error {
+	vs := c.settings.VerificationSettings
+	if len(done.Tasks) == 0 {
+		return nil
+	}
+
+	// acceptResults decoded the results and made sure there is one for each pixel, so any of them can be picked
+	samples := make([]task.Pixel, 0, vs.SamplePixels)
+	picked := make(map[int]bool, vs.SamplePixels)
+	for len(samples) < cap(samples) && len(samples) < len(done.Results) {
+		i := rand.Intn(len(done.Results))
+		if !picked[i] {
+			picked[i] = true
+			samples = append(samples, done.Results[i])
+		}
+	}
+
+	m := c.mandelbrot.ForTask(&done)
+	disagree := 0
+	for _, sample := range samples {
+		coordinate := done.Tasks[0]
+		coordinate.Column = sample.Column
+		coordinate.Row = sample.Row
+		if !m.CheckPixel(coordinate, done.Coloring, sample.Color, vs.Tolerance) {
+			disagree++
+		}
+	}
+	if disagree*4 > len(samples) {
+		return fmt.Errorf("%d of %d checked pixels disagree", disagree, len(samples))
+	}
+	return nil
+}
+
+// checkReturnedTask
+// Verifies a sample of the returned tasks and keeps a record of the tasks each worker returned for images that are
+// still open. Returns false when the task must not be used
+func (c *Coordinator) checkReturnedTask(done task.Task) bool {
+	vs := c.settings.VerificationSettings
+	if vs.SampleRate == 0 {
+		return true
+	}
+
+	c.mutex.Lock()
+	state, ok := c.workers[done.WorkerAddress]
+	quarantined := ok && state.Quarantined
+	c.mutex.Unlock()
+	if quarantined {
+		c.logger.Debugf("Ignoring task %d from quarantined worker %s", done.ID, done.WorkerAddress)
+		return false
+	}
+
+	if rand.Float64() < vs.SampleRate {
+		if err := c.verifyTask(done); err != nil {
+			c.logger.Warningf("Task %d from %s failed verification: %s", done.ID, done.WorkerAddress, err)
+			c.quarantineWorker(done.WorkerAddress)
+			return false
+		}
+	}
+
+	// Poster tiles and explorer tiles are written out as they arrive so there is nothing to calculate again
+	if ok && !c.settings.PosterSettings.Enabled && c.tileRequests == nil {
+		record := done
+		record.Encoded = nil
+		record.Encoding = task.RawEncoding
+		record.Results = nil
+		c.mutex.Lock()
+		if state.Returned == nil {
+			state.Returned = make(map[uint][]task.Task)
+		}
+		state.Returned[done.ImageNumber] = append(state.Returned[done.ImageNumber], record)
+		c.mutex.Unlock()
+	}
+	return true
+}
+
+// quarantineWorker
+// Stops handing tasks to a worker whose results cannot be trusted. The tasks it has out go back in the queue and its
+// earlier tasks of open images are calculated again as new tasks
+func (c *Coordinator) quarantineWorker(workerAddress string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	state, ok := c.workers[workerAddress]
+	if !ok || state.Quarantined {
+		return
+	}
+	state.Quarantined = true
+
+	for _, t := range c.tasksHandedOut[workerAddress] {
+		c.scheduler.Requeue(t, workerAddress)
+		c.journalRequeue(workerAddress, t, "worker quarantined")
+	}
+	c.tasksHandedOut[workerAddress] = make(map[uint]task.Task)
+
+	redone := 0
+	for imageNumber, tasks := range state.Returned {
+		for _, t := range tasks {
+			// Generated tasks use the ids below the original task count so the new ones follow on from the count
+			redo := task.NewTask(c.taskCount, imageNumber)
+			redo.Coloring = t.Coloring
+			redo.Height = t.Height
+			redo.KeepIterations = t.KeepIterations
+			redo.MaxIterations = t.MaxIterations
+			redo.Tasks = t.Tasks
+			redo.Width = t.Width
+			c.taskCount++
+			c.redoTasks[redo.ID] = t.Statistics
+			c.redoPending[imageNumber]++
+			c.scheduler.Redo(redo)
+			redone++
+		}
+	}
+	state.Returned = nil
+	c.logger.Warningf("Quarantined worker %s, calculating %d of its tasks again", workerAddress, redone)
+}
+
+// ingestRedo
+// Returns true when the task calculates pixels again that were already counted for its image, along with the
+// statistics of the task it replaces
+func (c *Coordinator) ingestRedo(taskReceived task.Task) (task.Statistics, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	replaced, ok := c.redoTasks[taskReceived.ID]
+	if !ok {
+		return task.Statistics{}, false
+	}
+	delete(c.redoTasks, taskReceived.ID)
+	c.redoPending[taskReceived.ImageNumber]--
+	if c.redoPending[taskReceived.ImageNumber] == 0 {
+		delete(c.redoPending, taskReceived.ImageNumber)
+	}
+	return replaced, true
+}
+
+// finishImage
+// Returns true when an image with every pixel in can be saved, i.e. it has no pixels waiting to be calculated again.
+// From then on its tasks are no longer calculated again when a worker is quarantined
+func (c *Coordinator) finishImage(imageNumber uint) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.redoPending[imageNumber] > 0 {
+		return false
+	}
+	for _, state := range c.workers {
+		delete(state.Returned, imageNumber)
+	}
+	return true
+}
+
+// ingestDone
+// Returns true once every task, including the ones calculated again, has been ingested
+func (c *Coordinator) ingestDone() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.taskIngestedCount == c.taskCount
+}
@@ -0,0 +1,102 @@
+package coordinator
+
+import (
+	"DistributedMandelbrot/mandelbrot"
+	"DistributedMandelbrot/task"
+	"github.com/BrugadaSyndrome/bslogger"
+	"image/color"
+	"testing"
+)
+
+// verifiedCoordinator
+// Returns a coordinator that checks every pixel of every returned task, along with a task of one row that was
+// calculated correctly
+func verifiedCoordinator(t *testing.T) (*Coordinator, task.Task) {
+	ms := mandelbrot.Settings{Width: 16, Height: 8, MaxIterations: 100}
+	if err := ms.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	c := &Coordinator{
+		logger:         bslogger.NewLogger("TestCoordinator", bslogger.Normal, nil),
+		mandelbrot:     mandelbrot.NewMandelbrot(ms),
+		redoPending:    make(map[uint]int),
+		redoTasks:      make(map[uint]task.Statistics),
+		scheduler:      newScheduler(schedulerSettings{QueueSize: 100}),
+		tasksHandedOut: make(map[string]map[uint]task.Task),
+		workers:        make(map[string]*workerState),
+	}
+	c.settings.MandelbrotSettings = ms
+	c.settings.VerificationSettings = verificationSettings{SamplePixels: 16, SampleRate: 1}
+	c.settings.VerificationSettings.Verify()
+
+	done := task.NewTask(0, 1)
+	done.MaxIterations = ms.MaxIterations
+	done.AddTasksForRow(ms.CenterX, ms.CenterY, ms.Magnification, 4, ms.Width)
+	m := c.mandelbrot.ForTask(&done)
+	for _, coordinate := range done.Tasks {
+		done.Results = append(done.Results, task.Pixel{
+			Color:  m.GetColorMultiple(m.EscapeTimeMultiple(m.GetPointsToCalculate(coordinate)), done.Coloring),
+			Column: coordinate.Column,
+			Row:    coordinate.Row,
+		})
+	}
+	return c, done
+}
+
+func TestVerifyTask(t *testing.T) {
+	c, done := verifiedCoordinator(t)
+	if err := c.verifyTask(done); err != nil {
+		t.Fatalf("a correct task failed verification: %s", err)
+	}
+
+	// A worker that skips the calculation and sends back one color for every pixel
+	for i := range done.Results {
+		done.Results[i].Color = color.RGBA{R: 255, G: 0, B: 255, A: 255}
+	}
+	if err := c.verifyTask(done); err == nil {
+		t.Error("a task with made up colors passed verification")
+	}
+}
+
+func TestQuarantineWorker(t *testing.T) {
+	c, returned := verifiedCoordinator(t)
+	c.taskCount = 10
+	c.workers["bad"] = &workerState{Returned: map[uint][]task.Task{1: {returned}}}
+
+	c.scheduler.Add(task.NewTask(1, 1))
+	handedOut, _ := c.scheduler.TryNext("bad", 1)
+	c.tasksHandedOut["bad"] = map[uint]task.Task{handedOut.ID: handedOut}
+
+	for i := range returned.Results {
+		returned.Results[i].Color = color.RGBA{R: 255, G: 0, B: 255, A: 255}
+	}
+	returned.WorkerAddress = "bad"
+	if c.checkReturnedTask(returned) {
+		t.Fatal("a task that failed verification was used")
+	}
+
+	if !c.workers["bad"].Quarantined {
+		t.Error("the worker was not quarantined")
+	}
+	if len(c.tasksHandedOut["bad"]) != 0 {
+		t.Errorf("the worker still has %d tasks out", len(c.tasksHandedOut["bad"]))
+	}
+	// The task the worker had out goes back in the queue, followed by its earlier task calculated again
+	var got []uint
+	for {
+		next, ok := c.scheduler.TryNext("good", 1)
+		if !ok {
+			break
+		}
+		got = append(got, next.ID)
+	}
+	if len(got) != 2 || got[0] != handedOut.ID || got[1] != 10 {
+		t.Errorf("handed out tasks %v, want [%d 10]", got, handedOut.ID)
+	}
+	if c.redoPending[1] != 1 || c.taskCount != 11 {
+		t.Errorf("%d tasks of image 1 are waiting to be calculated again and the task count is %d, want 1 and 11", c.redoPending[1], c.taskCount)
+	}
+	if c.checkReturnedTask(task.Task{ID: 1, WorkerAddress: "bad"}) {
+		t.Error("a task from the quarantined worker was used")
+	}
+}
@@ -2,57 +2,168 @@ package main
 
 import (
 	"DistributedMandelbrot/coordinator"
+	"DistributedMandelbrot/misc"
+	"DistributedMandelbrot/transport"
 	"DistributedMandelbrot/worker"
 	"flag"
+	"fmt"
 	"github.com/BrugadaSyndrome/bslogger"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 )
 
 var (
+	action       string
+	concurrency  uint
 	logger       bslogger.Logger
 	mode         string
 	settingsFile string
+	targets      string
 	workerCount  uint
 )
 
 func main() {
-	flag.StringVar(&mode, "mode", "", "Specify if this instance is a 'coordinator' or 'worker'")
+	flag.StringVar(&mode, "mode", "", "Specify if this instance is a 'control', 'coordinator', 'explorer', 'local', 'report' or 'worker'")
 	flag.StringVar(&settingsFile, "settings", "", "Specify the file with the settings for this run")
 	flag.UintVar(&workerCount, "workers", 2, "Specify the number of workers to create to process coordinator tasks")
+	flag.StringVar(&action, "action", "stats", "Specify what control mode asks of the workers: 'stats', 'pause', 'resume', 'drain' or 'concurrency'")
+	flag.UintVar(&concurrency, "concurrency", 1, "Specify the number of tasks each worker calculates at once for the 'concurrency' action")
+	flag.StringVar(&targets, "targets", "", "Specify the comma separated addresses of the workers control mode acts on, all workers when empty")
 	flag.Parse()
 
 	logger = bslogger.NewLogger("Main", bslogger.Normal, nil)
 
 	switch mode {
+	case "control":
+		startControlMode(settingsFile)
+		break
 	case "coordinator":
 		startCoordinatorMode(settingsFile)
 		break
+	case "explorer":
+		startExplorerMode(settingsFile)
+		break
+	case "report":
+		startReportMode(settingsFile)
+		break
+	case "local":
+		startLocalMode(settingsFile)
+		break
 	case "worker":
 		startWorkerMode(settingsFile)
 		break
 	default:
-		logger.Fatalf("Unknown mode '%s'. Please set the mode to 'coordinator' or 'worker'", mode)
+		logger.Fatalf("Unknown mode '%s'. Please set the mode to 'control', 'coordinator', 'explorer', 'local', 'report' or 'worker'", mode)
+	}
+}
+
+// startControlMode
+// Asks the coordinator named in a worker settings file to act on its workers and prints their stats
+func startControlMode(settingsFile string) {
+	controlAction, err := misc.ParseControlAction(action)
+	misc.CheckError(err, logger, misc.Fatal)
+	request := misc.ControlRequest{
+		Action:      controlAction,
+		Concurrency: concurrency,
 	}
+	if targets != "" {
+		request.Workers = strings.Split(targets, ",")
+	}
+
+	stats, err := worker.ControlWorkers(settingsFile, request)
+	misc.CheckError(err, logger, misc.Fatal)
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(table, "WORKER\tSTATE\tCONCURRENCY\tCURRENT TASKS\tCOMPLETED\tCPU\tUPTIME")
+	for _, s := range stats {
+		if s.Error != "" {
+			_, _ = fmt.Fprintf(table, "%s\t%s\n", s.Address, s.Error)
+			continue
+		}
+		state := "working"
+		if s.Draining {
+			state = "draining"
+		} else if s.Paused {
+			state = "paused"
+		}
+		_, _ = fmt.Fprintf(table, "%s\t%s\t%d\t%v\t%d\t%.1fs of %d CPUs\t%s\n", s.Address, state, s.Concurrency, s.CurrentTasks, s.TasksCompleted, s.CPUSeconds, s.CPUs, s.Uptime.Round(time.Second))
+	}
+	misc.CheckError(table.Flush(), logger, misc.Warning)
 }
 
 func startCoordinatorMode(settingsFile string) {
 	logger.Info("Started Coordinator Mode")
 
 	c := coordinator.NewCoordinator(settingsFile)
+	onSignal(c.Shutdown)
+
+	c.Server.Wait()
+}
+
+func startExplorerMode(settingsFile string) {
+	logger.Info("Started Explorer Mode")
+
+	c := coordinator.NewExplorer(settingsFile)
+	onSignal(c.Shutdown)
+
+	c.Server.Wait()
+}
+
+func startLocalMode(settingsFile string) {
+	logger.Info("Started Local Mode")
+
+	// The coordinator and its workers talk over in-memory connections instead of sockets
+	network := transport.NewMemory()
+	c := coordinator.NewCoordinatorWithTransport(settingsFile, network)
+	var i uint
+	for i = 0; i < workerCount; i++ {
+		worker.NewWorkerWithTransport(c.Address(), network)
+	}
+	onSignal(c.Shutdown)
 
 	c.Server.Wait()
 }
 
+// startReportMode
+// Summarizes the journals of the run in a coordinator settings file
+func startReportMode(settingsFile string) {
+	misc.CheckError(coordinator.WriteReport(settingsFile, os.Stdout), logger, misc.Fatal)
+}
+
 func startWorkerMode(settingsFile string) {
 	logger.Info("Started Worker Mode")
 
 	workers := make([]*worker.Worker, workerCount)
 	var i uint
 	for i = 0; i < workerCount; i++ {
-		w := worker.NewWorker(settingsFile)
-		workers[i] = &w
+		workers[i] = worker.NewWorker(settingsFile)
 	}
+	onSignal(func() {
+		for _, w := range workers {
+			w.Shutdown()
+		}
+	})
 
 	for i = 0; i < workerCount; i++ {
-		workers[i].ServerClient.Server.Wait()
+		workers[i].Wait()
 	}
 }
+
+// onSignal
+// Calls shutdown on the first interrupt or terminate signal. A second signal exits straight away
+func onSignal(shutdown func()) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-signals
+		logger.Infof("Received %s, shutting down. Send it again to exit straight away", s)
+		shutdown()
+		<-signals
+		logger.Warning("Exiting before the shutdown finished")
+		os.Exit(1)
+	}()
+}
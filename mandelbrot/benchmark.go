@@ -0,0 +1,23 @@
+package mandelbrot
+
+import "time"
+
+// Benchmark
+// Calculates the escape time of a fixed grid of points around the set for about the given duration and returns the
+// number of iterations calculated per second. Workers report it when they join so the coordinator can size their tasks.
+func (m *Mandelbrot) Benchmark(duration time.Duration) float64 {
+	const gridSize = 64
+
+	var iterations float64
+	startTime := time.Now()
+	for time.Since(startTime) < duration {
+		for row := 0; row < gridSize; row++ {
+			for column := 0; column < gridSize; column++ {
+				x := -2.0 + 2.5*float64(column)/gridSize
+				y := -1.25 + 2.5*float64(row)/gridSize
+				iterations += m.EscapeTime(x, y)
+			}
+		}
+	}
+	return iterations / time.Since(startTime).Seconds()
+}
@@ -8,41 +8,61 @@ import (
 )
 
 type Mandelbrot struct {
-	mathLog2 float64
-	settings Settings
+	mathLog2      float64
+	sampleOffsets []Point
+	settings      Settings
 }
 
 func NewMandelbrot(settings Settings) Mandelbrot {
 	mandelbrot := Mandelbrot{
-		mathLog2: math.Log(2),
-		settings: settings,
+		mathLog2:      math.Log(2),
+		sampleOffsets: newSampleOffsets(settings.SamplePattern, settings.SuperSampling),
+		settings:      settings,
 	}
 
 	return mandelbrot
 }
 
-// todo: add other methods of super sampling
-func (m *Mandelbrot) GetPointsToCalculate(coordinate task.Coordinate) []Point {
-	subPixels := make([]float64, m.settings.SuperSampling)
-	subPixels[0] = 0
+// WithMaxIterations
+// Returns a copy that stops iterating at maxIterations. Zero keeps the limit from the settings
+func (m *Mandelbrot) WithMaxIterations(maxIterations uint) Mandelbrot {
+	copied := *m
+	if maxIterations > 0 {
+		copied.settings.MaxIterations = maxIterations
+	}
+	return copied
+}
 
-	if m.settings.SuperSampling > 1 {
-		// Using grid super sampling
-		for i := 0; i < m.settings.SuperSampling; i++ {
-			subPixels[i] = ((0.5 + float64(i)) / float64(m.settings.SuperSampling)) - 0.5
+// ForTask
+// Returns a copy set up for the iteration limit and image size carried by the task
+func (m *Mandelbrot) ForTask(t *task.Task) Mandelbrot {
+	copied := m.WithMaxIterations(t.MaxIterations)
+	if t.Width > 0 && t.Height > 0 {
+		copied.settings.Width = t.Width
+		copied.settings.Height = t.Height
+		copied.settings.ShorterSide = t.Height
+		if t.Height > t.Width {
+			copied.settings.ShorterSide = t.Width
 		}
 	}
+	return copied
+}
 
-	points := make([]Point, m.settings.SuperSampling*m.settings.SuperSampling)
-	i := 0
-	for _, sx := range subPixels {
-		for _, sy := range subPixels {
-			x, y := m.ConvertPixelCoordinateToComplexCoordinate(coordinate, sx, sy)
-			points[i] = Point{X: x, Y: y}
-			i++
-		}
+// MaxIterations
+// Returns the iteration limit this Mandelbrot calculates to
+func (m *Mandelbrot) MaxIterations() uint {
+	return m.settings.MaxIterations
+}
+
+// GetPointsToCalculate
+// Returns the points to sample for the pixel. With adaptive super sampling only the pixel center is returned and the
+// rest of the samples are added later by RefineTask where they are needed.
+func (m *Mandelbrot) GetPointsToCalculate(coordinate task.Coordinate) []Point {
+	if m.settings.AdaptiveSampling {
+		x, y := m.ConvertPixelCoordinateToComplexCoordinate(coordinate, 0, 0)
+		return []Point{{X: x, Y: y}}
 	}
-	return points
+	return m.getSamplePoints(coordinate)
 }
 
 func (m *Mandelbrot) EscapeTimeMultiple(points []Point) []float64 {
@@ -53,28 +73,26 @@ func (m *Mandelbrot) EscapeTimeMultiple(points []Point) []float64 {
 	return iterations
 }
 
-func (m *Mandelbrot) GetColorMultiple(iterations []float64) color.RGBA {
-	colorSamples := make([]color.RGBA, m.settings.SuperSampling*m.settings.SuperSampling)
+// GetColorMultiple
+// Colors each sample and averages them in linear light into the final, alpha premultiplied, pixel color
+func (m *Mandelbrot) GetColorMultiple(iterations []float64, coloring task.Coloring) color.RGBA {
+	colorSamples := make([]color.RGBA, len(iterations))
 	for i, iteration := range iterations {
-		colorSamples[i] = m.GetColor(iteration)
-	}
-
-	// Generate the final super sampled color
-	var r, g, b int
-	for _, sample := range colorSamples {
-		r += int(sample.R)
-		g += int(sample.G)
-		b += int(sample.B)
+		colorSamples[i] = m.GetColor(iteration, coloring)
 	}
-	divisor := len(colorSamples)
-	return color.RGBA{R: uint8(r / divisor), G: uint8(g / divisor), B: uint8(b / divisor), A: 255}
+	return misc.AverageColors(colorSamples)
 }
 
-func (m *Mandelbrot) GetColor(iteration float64) color.RGBA {
+// GetColor
+// Returns the straight (non-premultiplied) alpha color for the iteration count
+func (m *Mandelbrot) GetColor(iteration float64, coloring task.Coloring) color.RGBA {
+	if iteration < float64(m.settings.MaxIterations) && m.settings.TransparentExterior {
+		return color.RGBA{}
+	}
 	if m.settings.SmoothColoring {
-		return m.getSmoothColor(iteration)
+		return m.getSmoothColor(iteration, coloring)
 	}
-	return m.getPaletteColor(iteration)
+	return m.getPaletteColor(iteration, coloring)
 }
 
 // https://en.wikipedia.org/wiki/Plotting_algorithms_for_the_Mandelbrot_set#Optimized_escape_time_algorithms
@@ -134,21 +152,29 @@ func (m *Mandelbrot) ConvertPixelCoordinateToComplexCoordinate(c task.Coordinate
 	return x, y
 }
 
-func (m *Mandelbrot) getPaletteColor(iterations float64) color.RGBA {
+func (m *Mandelbrot) getPaletteColor(iterations float64, coloring task.Coloring) color.RGBA {
 	uintIterations := uint(math.Floor(iterations))
-	if uintIterations == m.settings.MaxIterations {
+	if uintIterations >= m.settings.MaxIterations {
+		if m.settings.TransparentInterior {
+			return color.RGBA{}
+		}
 		return m.settings.EscapeColor
 	}
-	return m.settings.Palette[int(uintIterations)%len(m.settings.Palette)]
+	return m.settings.Palette[coloring.PaletteIndex(iterations, len(m.settings.Palette))]
 }
 
 // https://en.wikipedia.org/wiki/Plotting_algorithms_for_the_Mandelbrot_set#Continuous_(smooth)_coloring
-func (m *Mandelbrot) getSmoothColor(iterations float64) color.RGBA {
-	// The modf value is the floating point portion of the iteration value
-	_, fraction := math.Modf(iterations)
-
-	// Make the new mixed color
-	color1 := m.getPaletteColor(iterations)
-	color2 := m.getPaletteColor(iterations + 1)
-	return misc.LinearInterpolationRGB(color1, color2, fraction)
+func (m *Mandelbrot) getSmoothColor(iterations float64, coloring task.Coloring) color.RGBA {
+	// The fractional portion of the palette position is how far to blend towards the next color
+	position := coloring.PalettePosition(iterations)
+	fraction := position - math.Floor(position)
+
+	// Make the new mixed color. Stepping one density's worth of iterations lands on the next palette color
+	density := coloring.PaletteDensity
+	if density <= 0 {
+		density = 1
+	}
+	color1 := m.getPaletteColor(iterations, coloring)
+	color2 := m.getPaletteColor(iterations+density, coloring)
+	return misc.LinearInterpolationLinearRGB(color1, color2, fraction)
 }
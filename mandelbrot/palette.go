@@ -2,25 +2,126 @@ package mandelbrot
 
 import (
 	"DistributedMandelbrot/misc"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"image/color"
+	"math"
 )
 
+const (
+	RGB ColorSpace = iota
+	HSV
+	LinearRGB
+	OKLab
+)
+
+type ColorSpace int
+
+func (cs ColorSpace) String() string {
+	return []string{
+		"RGB", "HSV", "LinearRGB", "OKLab",
+	}[cs]
+}
+
+// Interpolate
+// Blends between the two colors in this color space
+func (cs ColorSpace) Interpolate(color1 color.RGBA, color2 color.RGBA, fraction float64) color.RGBA {
+	switch cs {
+	case HSV:
+		return misc.LinearInterpolationHSV(color1, color2, fraction)
+	case LinearRGB:
+		return misc.LinearInterpolationLinearRGB(color1, color2, fraction)
+	case OKLab:
+		return misc.LinearInterpolationOKLab(color1, color2, fraction)
+	default:
+		return misc.LinearInterpolationRGB(color1, color2, fraction)
+	}
+}
+
+// cosinePaletteSettings
+// Procedural palette of the form color(t) = A + B * cos(2π * (C * t + D)) evaluated per RGB channel
+// https://iquilezles.org/articles/palettes/
+type cosinePaletteSettings struct {
+	A [3]float64
+	B [3]float64
+	C [3]float64
+	D [3]float64
+}
+
+func (cps *cosinePaletteSettings) Color(t float64) color.RGBA {
+	var channels [3]uint8
+	for i := 0; i < 3; i++ {
+		v := cps.A[i] + cps.B[i]*math.Cos(2*math.Pi*(cps.C[i]*t+cps.D[i]))
+		channels[i] = uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+	}
+	return color.RGBA{R: channels[0], G: channels[1], B: channels[2], A: 255}
+}
+
+// generatePaletteSettings
+// Describes one segment of the palette. The segment is loaded from File when it is set, evaluated from Cosine when it
+// is set, and otherwise is a gradient from StartColor to EndColor interpolated in ColorSpace.
 type generatePaletteSettings struct {
-	StartColor   color.RGBA
+	ColorSpace   ColorSpace
+	Cosine       *cosinePaletteSettings
 	EndColor     color.RGBA
+	File         string
 	NumberColors int
+	StartColor   color.RGBA
 }
 
-func (gps *generatePaletteSettings) GeneratePalette() []color.RGBA {
-	palette := make([]color.RGBA, 0)
+// UnmarshalJSON
+// Decodes the segment with StartColor and EndColor opaque when they leave out "A"
+func (gps *generatePaletteSettings) UnmarshalJSON(data []byte) error {
+	type plainSettings generatePaletteSettings
+	if err := json.Unmarshal(data, (*plainSettings)(gps)); err != nil {
+		return err
+	}
+	var colors struct {
+		EndColor   json.RawMessage
+		StartColor json.RawMessage
+	}
+	if err := json.Unmarshal(data, &colors); err != nil {
+		return err
+	}
+	if colors.EndColor != nil {
+		if err := misc.UnmarshalColor(colors.EndColor, &gps.EndColor); err != nil {
+			return err
+		}
+	}
+	if colors.StartColor != nil {
+		return misc.UnmarshalColor(colors.StartColor, &gps.StartColor)
+	}
+	return nil
+}
+
+func (gps *generatePaletteSettings) Verify() error {
+	if gps.ColorSpace < RGB || gps.ColorSpace > OKLab {
+		return fmt.Errorf("unknown ColorSpace %d", gps.ColorSpace)
+	}
+	return nil
+}
+
+func (gps *generatePaletteSettings) GeneratePalette() ([]color.RGBA, error) {
+	if gps.File != "" {
+		return LoadPaletteFile(gps.File, gps.NumberColors)
+	}
+	if gps.NumberColors <= 0 {
+		return nil, errors.New("palette segment needs a positive NumberColors")
+	}
+
+	palette := make([]color.RGBA, 0, gps.NumberColors)
 	for j := 0; j < gps.NumberColors; j++ {
-		fraction := float64(j) / float64(gps.NumberColors)
-		colorStep := color.RGBA{
-			R: misc.LerpUint8(gps.StartColor.R, gps.EndColor.R, fraction),
-			G: misc.LerpUint8(gps.StartColor.G, gps.EndColor.G, fraction),
-			B: misc.LerpUint8(gps.StartColor.B, gps.EndColor.B, fraction),
-			A: 255}
-		palette = append(palette, colorStep)
-	}
-	return palette
+		// Divide by one less than the number of colors so the last color of the segment is exactly EndColor
+		fraction := 0.0
+		if gps.NumberColors > 1 {
+			fraction = float64(j) / float64(gps.NumberColors-1)
+		}
+		if gps.Cosine != nil {
+			palette = append(palette, gps.Cosine.Color(fraction))
+			continue
+		}
+		palette = append(palette, gps.ColorSpace.Interpolate(gps.StartColor, gps.EndColor, fraction))
+	}
+	return palette, nil
 }
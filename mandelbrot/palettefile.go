@@ -0,0 +1,306 @@
+package mandelbrot
+
+import (
+	"DistributedMandelbrot/misc"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultGradientColors = 256
+	ultraFractalIndexes   = 400
+)
+
+// LoadPaletteFile
+// Reads a palette from a Fractint (.map), Ultra Fractal (.ugr) or GIMP (.ggr) gradient file. When numberColors is
+// greater than zero the gradient is resampled to that many colors, otherwise the native size of the format is used.
+func LoadPaletteFile(path string, numberColors int) ([]color.RGBA, error) {
+	err, fileBytes := misc.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var sample func(t float64) color.RGBA
+	nativeColors := defaultGradientColors
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".map":
+		palette, err := parseFractintMap(fileBytes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s - %s", path, err)
+		}
+		if numberColors <= 0 || numberColors == len(palette) {
+			return palette, nil
+		}
+		sample = func(t float64) color.RGBA {
+			position := t * float64(len(palette)-1)
+			index := int(math.Floor(position))
+			if index >= len(palette)-1 {
+				return palette[len(palette)-1]
+			}
+			return misc.LinearInterpolationRGB(palette[index], palette[index+1], position-float64(index))
+		}
+	case ".ugr":
+		sample, err = parseUltraFractalGradient(fileBytes)
+		nativeColors = ultraFractalIndexes
+	case ".ggr":
+		sample, err = parseGimpGradient(fileBytes)
+	default:
+		return nil, fmt.Errorf("unknown palette file type: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s - %s", path, err)
+	}
+
+	if numberColors <= 0 {
+		numberColors = nativeColors
+	}
+	palette := make([]color.RGBA, numberColors)
+	for i := range palette {
+		palette[i] = sample(float64(i) / float64(numberColors))
+	}
+	return palette, nil
+}
+
+// parseFractintMap
+// Each line of a .map file holds one "R G B" triple, optionally followed by a comment
+func parseFractintMap(fileBytes []byte) ([]color.RGBA, error) {
+	palette := make([]color.RGBA, 0, 256)
+	scanner := bufio.NewScanner(bytes.NewReader(fileBytes))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		var channels [3]uint8
+		for i := 0; i < 3; i++ {
+			v, err := strconv.ParseUint(fields[i], 10, 8)
+			if err != nil {
+				return nil, err
+			}
+			channels[i] = uint8(v)
+		}
+		palette = append(palette, color.RGBA{R: channels[0], G: channels[1], B: channels[2], A: 255})
+	}
+	if len(palette) == 0 {
+		return nil, errors.New("no colors found")
+	}
+	return palette, scanner.Err()
+}
+
+type gradientStop struct {
+	Color    color.RGBA
+	Position float64
+}
+
+// parseUltraFractalGradient
+// Reads the first gradient of a .ugr file. Stops are given as "index=N color=BGR" pairs where the index ranges over
+// [0, 400) and the color is a decimal integer in blue-green-red byte order. The gradient wraps around.
+func parseUltraFractalGradient(fileBytes []byte) (func(t float64) color.RGBA, error) {
+	stops := make([]gradientStop, 0)
+	index := -1
+	scanner := bufio.NewScanner(bytes.NewReader(fileBytes))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "}" || strings.HasPrefix(line, "opacity:") {
+			break
+		}
+		for _, field := range strings.Fields(line) {
+			switch {
+			case strings.HasPrefix(field, "index="):
+				v, err := strconv.Atoi(strings.TrimPrefix(field, "index="))
+				if err != nil {
+					return nil, err
+				}
+				index = v
+			case strings.HasPrefix(field, "color=") && index >= 0:
+				v, err := strconv.ParseUint(strings.TrimPrefix(field, "color="), 10, 32)
+				if err != nil {
+					return nil, err
+				}
+				stops = append(stops, gradientStop{
+					Color:    color.RGBA{R: uint8(v), G: uint8(v >> 8), B: uint8(v >> 16), A: 255},
+					Position: float64(index%ultraFractalIndexes) / ultraFractalIndexes,
+				})
+				index = -1
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(stops) == 0 {
+		return nil, errors.New("no gradient stops found")
+	}
+	sort.Slice(stops, func(i, j int) bool { return stops[i].Position < stops[j].Position })
+
+	return func(t float64) color.RGBA {
+		// Find the stops on either side of t, wrapping from the last stop back to the first
+		next := sort.Search(len(stops), func(i int) bool { return stops[i].Position > t })
+		previous := next - 1
+		previousPosition := 0.0
+		nextPosition := 0.0
+		if previous < 0 {
+			previous = len(stops) - 1
+			previousPosition = stops[previous].Position - 1
+		} else {
+			previousPosition = stops[previous].Position
+		}
+		if next == len(stops) {
+			next = 0
+			nextPosition = stops[next].Position + 1
+		} else {
+			nextPosition = stops[next].Position
+		}
+		if nextPosition == previousPosition {
+			return stops[previous].Color
+		}
+		return misc.LinearInterpolationRGB(stops[previous].Color, stops[next].Color, (t-previousPosition)/(nextPosition-previousPosition))
+	}, nil
+}
+
+type gimpSegment struct {
+	Blending   int
+	Coloring   int
+	Left       float64
+	LeftColor  color.RGBA
+	Middle     float64
+	Right      float64
+	RightColor color.RGBA
+}
+
+// parseGimpGradient
+// https://gitlab.gnome.org/GNOME/gimp/-/blob/master/app/core/gimpgradient.c
+func parseGimpGradient(fileBytes []byte) (func(t float64) color.RGBA, error) {
+	lines := strings.Split(strings.ReplaceAll(string(fileBytes), "\r\n", "\n"), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "GIMP Gradient" {
+		return nil, errors.New("missing GIMP Gradient header")
+	}
+	lines = lines[1:]
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "Name:") {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return nil, errors.New("missing segment count")
+	}
+	segmentCount, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+	if err != nil {
+		return nil, err
+	}
+	lines = lines[1:]
+	if segmentCount <= 0 || len(lines) < segmentCount {
+		return nil, fmt.Errorf("expected %d segments", segmentCount)
+	}
+
+	segments := make([]gimpSegment, segmentCount)
+	for i := 0; i < segmentCount; i++ {
+		fields := strings.Fields(lines[i])
+		if len(fields) < 11 {
+			return nil, fmt.Errorf("segment %d is malformed", i)
+		}
+		values := make([]float64, len(fields))
+		for j, field := range fields {
+			values[j], err = strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+		segments[i] = gimpSegment{
+			Left:       values[0],
+			Middle:     values[1],
+			Right:      values[2],
+			LeftColor:  unitRGBA(values[3], values[4], values[5], values[6]),
+			RightColor: unitRGBA(values[7], values[8], values[9], values[10]),
+		}
+		if len(values) > 11 {
+			segments[i].Blending = int(values[11])
+		}
+		if len(values) > 12 {
+			segments[i].Coloring = int(values[12])
+		}
+	}
+
+	return func(t float64) color.RGBA {
+		segment := segments[len(segments)-1]
+		for _, s := range segments {
+			if t <= s.Right {
+				segment = s
+				break
+			}
+		}
+		return segment.Color(t)
+	}, nil
+}
+
+func (gs *gimpSegment) Color(t float64) color.RGBA {
+	length := gs.Right - gs.Left
+	position, middle := 0.5, 0.5
+	if length > 1e-10 {
+		position = (t - gs.Left) / length
+		middle = (gs.Middle - gs.Left) / length
+	}
+
+	linear := func() float64 {
+		if position <= middle {
+			if middle < 1e-10 {
+				return 0
+			}
+			return 0.5 * position / middle
+		}
+		if 1-middle < 1e-10 {
+			return 1
+		}
+		return 0.5 + 0.5*(position-middle)/(1-middle)
+	}
+
+	var factor float64
+	switch gs.Blending {
+	case 1: // curved
+		if middle < 1e-10 {
+			middle = 1e-10
+		}
+		factor = math.Pow(position, math.Log(0.5)/math.Log(middle))
+	case 2: // sine
+		factor = (math.Sin(-math.Pi/2+math.Pi*linear()) + 1) / 2
+	case 3: // sphere increasing
+		f := linear() - 1
+		factor = math.Sqrt(1 - f*f)
+	case 4: // sphere decreasing
+		f := linear()
+		factor = 1 - math.Sqrt(1-f*f)
+	case 5: // step
+		if position >= middle {
+			factor = 1
+		}
+	default:
+		factor = linear()
+	}
+
+	switch gs.Coloring {
+	case 1, 2: // hsv counter-clockwise, hsv clockwise
+		h1, s1, v1 := misc.RGBToHSV(gs.LeftColor)
+		h2, s2, v2 := misc.RGBToHSV(gs.RightColor)
+		if gs.Coloring == 1 && h2 < h1 {
+			h2 += 360
+		} else if gs.Coloring == 2 && h2 > h1 {
+			h2 -= 360
+		}
+		return misc.HSVToRGB(misc.LerpFloat64(h1, h2, factor), misc.LerpFloat64(s1, s2, factor), misc.LerpFloat64(v1, v2, factor))
+	default:
+		return misc.LinearInterpolationRGB(gs.LeftColor, gs.RightColor, factor)
+	}
+}
+
+func unitRGBA(r float64, g float64, b float64, a float64) color.RGBA {
+	toUint8 := func(v float64) uint8 {
+		return uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+	}
+	return color.RGBA{R: toUint8(r), G: toUint8(g), B: toUint8(b), A: toUint8(a)}
+}
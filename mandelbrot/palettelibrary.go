@@ -0,0 +1,42 @@
+package mandelbrot
+
+import (
+	"DistributedMandelbrot/misc"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+)
+
+// SavePalette
+// Stores the palette as <directory>/<name>.json so other settings files can reuse it by name
+func SavePalette(directory string, name string, palette []color.RGBA) error {
+	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create palette directory %s - %s", directory, err)
+	}
+	marshaledPalette, err := json.MarshalIndent(palette, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = misc.WriteFile(palettePath(directory, name), marshaledPalette)
+	return err
+}
+
+// LoadPalette
+// Reads a palette previously stored with SavePalette
+func LoadPalette(directory string, name string) ([]color.RGBA, error) {
+	err, fileBytes := misc.ReadFile(palettePath(directory, name))
+	if err != nil {
+		return nil, err
+	}
+	palette := make([]color.RGBA, 0)
+	if err = misc.UnmarshalColors(fileBytes, &palette); err != nil {
+		return nil, fmt.Errorf("unable to parse palette %s - %s", name, err)
+	}
+	return palette, nil
+}
+
+func palettePath(directory string, name string) string {
+	return filepath.Join(directory, name+".json")
+}
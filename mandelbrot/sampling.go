@@ -0,0 +1,216 @@
+package mandelbrot
+
+import (
+	"DistributedMandelbrot/task"
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+const (
+	GridSampling SamplePattern = iota
+	JitteredSampling
+	RotatedGridSampling
+	PoissonDiscSampling
+)
+
+type SamplePattern int
+
+func (sp SamplePattern) String() string {
+	return []string{
+		"Grid", "Jittered", "RotatedGrid", "PoissonDisc",
+	}[sp]
+}
+
+// newSampleOffsets
+// Returns the offsets (in pixels, relative to the pixel center) for patterns that are the same for every pixel. The
+// jittered pattern changes per pixel so it is generated in jitteredOffsets instead.
+func newSampleOffsets(pattern SamplePattern, samples int) []Point {
+	if samples <= 1 {
+		return []Point{{X: 0, Y: 0}}
+	}
+
+	offsets := make([]Point, 0, samples*samples)
+	switch pattern {
+	case RotatedGridSampling:
+		// Rotating the grid by atan(1/2) keeps every sample on its own row and column
+		// https://en.wikipedia.org/wiki/Supersampling#Rotated_grid
+		angle := math.Atan(0.5)
+		sin, cos := math.Sin(angle), math.Cos(angle)
+		for _, grid := range newSampleOffsets(GridSampling, samples) {
+			offsets = append(offsets, Point{
+				X: wrapOffset(grid.X*cos - grid.Y*sin),
+				Y: wrapOffset(grid.X*sin + grid.Y*cos),
+			})
+		}
+	case PoissonDiscSampling:
+		// Dart throwing with a fixed seed so every worker uses the same pattern
+		// https://en.wikipedia.org/wiki/Supersampling#Poisson_disk
+		random := rand.New(rand.NewSource(int64(samples)))
+		minDistance := 0.75 / float64(samples)
+		for len(offsets) < samples*samples {
+			var best Point
+			bestDistance := -1.0
+			for attempt := 0; attempt < 100; attempt++ {
+				candidate := Point{X: random.Float64() - 0.5, Y: random.Float64() - 0.5}
+				distance := math.Inf(1)
+				for _, o := range offsets {
+					distance = math.Min(distance, math.Hypot(candidate.X-o.X, candidate.Y-o.Y))
+				}
+				if distance > bestDistance {
+					best, bestDistance = candidate, distance
+				}
+				if distance >= minDistance {
+					break
+				}
+			}
+			offsets = append(offsets, best)
+		}
+	default:
+		for x := 0; x < samples; x++ {
+			for y := 0; y < samples; y++ {
+				offsets = append(offsets, Point{
+					X: ((0.5 + float64(x)) / float64(samples)) - 0.5,
+					Y: ((0.5 + float64(y)) / float64(samples)) - 0.5,
+				})
+			}
+		}
+	}
+	return offsets
+}
+
+// jitteredOffsets
+// Places one sample at a random position inside each cell of the grid. The randomness is derived from the pixel so
+// recalculating a pixel always gives the same result.
+func jitteredOffsets(coordinate task.Coordinate, samples int) []Point {
+	offsets := make([]Point, 0, samples*samples)
+	cell := 1 / float64(samples)
+	for x := 0; x < samples; x++ {
+		for y := 0; y < samples; y++ {
+			seed := uint64(coordinate.Row)<<40 ^ uint64(coordinate.Column)<<16 ^ uint64(x*samples+y)
+			offsets = append(offsets, Point{
+				X: (float64(x)+unitHash(seed, 0))*cell - 0.5,
+				Y: (float64(y)+unitHash(seed, 1))*cell - 0.5,
+			})
+		}
+	}
+	return offsets
+}
+
+// getSamplePoints
+// Returns every sample of the configured pattern for the pixel
+func (m *Mandelbrot) getSamplePoints(coordinate task.Coordinate) []Point {
+	offsets := m.sampleOffsets
+	if m.settings.SamplePattern == JitteredSampling && m.settings.SuperSampling > 1 {
+		offsets = jitteredOffsets(coordinate, m.settings.SuperSampling)
+	}
+
+	points := make([]Point, len(offsets))
+	for i, offset := range offsets {
+		x, y := m.ConvertPixelCoordinateToComplexCoordinate(coordinate, offset.X, offset.Y)
+		points[i] = Point{X: x, Y: y}
+	}
+	return points
+}
+
+// RefineTask
+// Second pass of adaptive super sampling. Every pixel of the task was calculated with one sample; the pixels whose
+// color differs from a neighboring pixel by more than AdaptiveThreshold are recalculated with all the samples of the
+// pattern. Neighbors outside the task are calculated with the one sample the task holding them starts with, so the
+// pixels on the edges between tasks are refined whichever way the image is cut into tasks. Returns the number of
+// pixels that were refined.
+func (m *Mandelbrot) RefineTask(t *task.Task) int {
+	if !m.settings.AdaptiveSampling || len(t.Results) != len(t.Tasks) {
+		return 0
+	}
+
+	type pixelKey struct {
+		Column int
+		Row    int
+	}
+	indexes := make(map[pixelKey]int, len(t.Results))
+	for i, result := range t.Results {
+		indexes[pixelKey{Column: int(result.Column), Row: int(result.Row)}] = i
+	}
+	halo := make(map[pixelKey]color.RGBA)
+
+	refine := make([]bool, len(t.Results))
+	for i, result := range t.Results {
+		neighbors := []pixelKey{
+			{Column: int(result.Column) + 1, Row: int(result.Row)},
+			{Column: int(result.Column), Row: int(result.Row) + 1},
+			{Column: int(result.Column) - 1, Row: int(result.Row)},
+			{Column: int(result.Column), Row: int(result.Row) - 1},
+		}
+		for _, neighbor := range neighbors {
+			if neighbor.Column < 0 || neighbor.Row < 0 || neighbor.Column >= int(m.settings.Width) || neighbor.Row >= int(m.settings.Height) {
+				continue
+			}
+			var neighborColor color.RGBA
+			if j, ok := indexes[neighbor]; ok {
+				neighborColor = t.Results[j].Color
+			} else if c, ok := halo[neighbor]; ok {
+				neighborColor = c
+			} else {
+				coordinate := t.Tasks[i]
+				coordinate.Column = uint(neighbor.Column)
+				coordinate.Row = uint(neighbor.Row)
+				neighborColor = m.GetColorMultiple(m.EscapeTimeMultiple(m.GetPointsToCalculate(coordinate)), t.Coloring)
+				halo[neighbor] = neighborColor
+			}
+			if colorDifference(result.Color, neighborColor) > m.settings.AdaptiveThreshold {
+				refine[i] = true
+				break
+			}
+		}
+	}
+
+	refined := 0
+	for i := range refine {
+		if !refine[i] {
+			continue
+		}
+		iterations := m.EscapeTimeMultiple(m.getSamplePoints(t.Tasks[i]))
+		t.Results[i].Color = m.GetColorMultiple(iterations, t.Coloring)
+		if t.KeepIterations {
+			t.Results[i].Iterations = iterations
+		}
+		refined++
+	}
+	return refined
+}
+
+func colorDifference(color1 color.RGBA, color2 color.RGBA) int {
+	difference := 0
+	for _, d := range []int{
+		int(color1.R) - int(color2.R),
+		int(color1.G) - int(color2.G),
+		int(color1.B) - int(color2.B),
+		int(color1.A) - int(color2.A),
+	} {
+		if d < 0 {
+			d = -d
+		}
+		if d > difference {
+			difference = d
+		}
+	}
+	return difference
+}
+
+// unitHash
+// Maps the seed to a float in [0, 1) using splitmix64
+// https://prng.di.unimi.it/splitmix64.c
+func unitHash(seed uint64, stream uint64) float64 {
+	z := seed + (stream+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z = z ^ (z >> 31)
+	return float64(z>>11) / (1 << 53)
+}
+
+// wrapOffset
+// Keeps an offset inside the pixel, i.e. the range [-0.5, 0.5)
+func wrapOffset(v float64) float64 {
+	return v - math.Floor(v+0.5)
+}
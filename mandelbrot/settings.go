@@ -1,6 +1,9 @@
 package mandelbrot
 
 import (
+	"DistributedMandelbrot/misc"
+	"encoding/json"
+	"fmt"
 	"github.com/BrugadaSyndrome/bslogger"
 	"image/color"
 )
@@ -8,6 +11,8 @@ import (
 type Settings struct {
 	logger bslogger.Logger
 
+	AdaptiveSampling        bool
+	AdaptiveThreshold       int // Largest channel difference between neighboring pixels before they are refined
 	Boundary                float64
 	CenterX                 float64
 	CenterY                 float64
@@ -17,15 +22,51 @@ type Settings struct {
 	Magnification           float64
 	MaxIterations           uint
 	Palette                 []color.RGBA
+	PaletteDirectory        string
+	PaletteName             string
+	SamplePattern           SamplePattern
 	ShorterSide             uint
 	SmoothColoring          bool
+	Subdivision             bool // Skip uniform rectangles of tile shaped tasks with Mariani–Silver subdivision
+	SubdivisionProbes       int  // Points inside a rectangle to check before filling it
 	SuperSampling           int
+	TransparentExterior     bool // Make points that escape transparent
+	TransparentInterior     bool // Make points in the set transparent instead of EscapeColor
 	Width                   uint
 }
 
+// UnmarshalJSON
+// Decodes the settings with EscapeColor and the Palette colors opaque when they leave out "A"
+func (s *Settings) UnmarshalJSON(data []byte) error {
+	type plainSettings Settings
+	if err := json.Unmarshal(data, (*plainSettings)(s)); err != nil {
+		return err
+	}
+	var colors struct {
+		EscapeColor json.RawMessage
+		Palette     json.RawMessage
+	}
+	if err := json.Unmarshal(data, &colors); err != nil {
+		return err
+	}
+	if colors.EscapeColor != nil {
+		if err := misc.UnmarshalColor(colors.EscapeColor, &s.EscapeColor); err != nil {
+			return err
+		}
+	}
+	if colors.Palette != nil {
+		return misc.UnmarshalColors(colors.Palette, &s.Palette)
+	}
+	return nil
+}
+
 func (s *Settings) Verify() error {
 	s.logger = bslogger.NewLogger("MandelbrotSettings", bslogger.Normal, nil)
 
+	// s.AdaptiveSampling defaults to false already
+	if s.AdaptiveThreshold <= 0 {
+		s.AdaptiveThreshold = 16
+	}
 	if s.Boundary <= 0 {
 		s.Boundary = 100
 	}
@@ -38,11 +79,37 @@ func (s *Settings) Verify() error {
 	if s.EscapeColor == (color.RGBA{}) {
 		s.EscapeColor = color.RGBA{R: 0, G: 0, B: 0, A: 255}
 	}
+	if s.PaletteDirectory == "" {
+		s.PaletteDirectory = "palettes"
+	}
 	if len(s.GeneratePaletteSettings) > 0 {
+		// A segment that cannot be made would leave a different palette than the one asked for, and saving it under
+		// its name would replace a good saved palette
 		s.Palette = make([]color.RGBA, 0)
 		for i := 0; i < len(s.GeneratePaletteSettings); i++ {
-			s.Palette = append(s.Palette, s.GeneratePaletteSettings[i].GeneratePalette()...)
+			if err := s.GeneratePaletteSettings[i].Verify(); err != nil {
+				return fmt.Errorf("palette segment %d - %s", i+1, err)
+			}
+			palette, err := s.GeneratePaletteSettings[i].GeneratePalette()
+			if err != nil {
+				return fmt.Errorf("palette segment %d - %s", i+1, err)
+			}
+			s.Palette = append(s.Palette, palette...)
+		}
+		// Save the generated palette under its name so other runs can reuse it
+		if s.PaletteName != "" && len(s.Palette) > 0 {
+			misc.CheckError(SavePalette(s.PaletteDirectory, s.PaletteName, s.Palette), s.logger, misc.Warning)
 		}
+	} else if s.PaletteName != "" {
+		// A run asking for a saved palette it cannot have would otherwise be rendered in white
+		palette, err := LoadPalette(s.PaletteDirectory, s.PaletteName)
+		if err != nil {
+			return fmt.Errorf("unable to load palette %s - %s", s.PaletteName, err)
+		}
+		if len(palette) == 0 {
+			return fmt.Errorf("palette %s in %s has no colors", s.PaletteName, s.PaletteDirectory)
+		}
+		s.Palette = palette
 	}
 	if s.Height <= 0 {
 		s.Height = 1080
@@ -56,7 +123,14 @@ func (s *Settings) Verify() error {
 	if len(s.Palette) == 0 {
 		s.Palette = []color.RGBA{{R: 255, G: 255, B: 255, A: 255}}
 	}
+	if s.SamplePattern < GridSampling || s.SamplePattern > PoissonDiscSampling {
+		s.SamplePattern = GridSampling
+	}
 	// s.SmoothColoring defaults to false already
+	// s.Subdivision defaults to false already
+	if s.SubdivisionProbes < 1 {
+		s.SubdivisionProbes = 1
+	}
 	if s.SuperSampling < 1 {
 		s.SuperSampling = 1
 	}
@@ -70,6 +144,12 @@ func (s *Settings) Verify() error {
 		s.ShorterSide = s.Width
 	}
 
+	// Adaptive super sampling needs more than one sample per pixel to refine with
+	if s.AdaptiveSampling && s.SuperSampling == 1 {
+		s.AdaptiveSampling = false
+		s.logger.Infof("Disabling AdaptiveSampling since SuperSampling is 1.")
+	}
+
 	// Smooth coloring won't work with one color
 	if len(s.Palette) == 1 && s.SmoothColoring == true {
 		s.SmoothColoring = false
@@ -78,3 +158,17 @@ func (s *Settings) Verify() error {
 
 	return nil
 }
+
+// HasTransparency
+// Reports if any pixel of the image could come out less than fully opaque
+func (s *Settings) HasTransparency() bool {
+	if s.TransparentExterior || s.TransparentInterior || s.EscapeColor.A < 255 {
+		return true
+	}
+	for _, c := range s.Palette {
+		if c.A < 255 {
+			return true
+		}
+	}
+	return false
+}
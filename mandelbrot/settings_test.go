@@ -0,0 +1,139 @@
+package mandelbrot
+
+import (
+	"encoding/json"
+	"image/color"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerifyPaletteName(t *testing.T) {
+	directory := t.TempDir()
+	if err := SavePalette(directory, "saved", []color.RGBA{{R: 255, A: 255}, {B: 255, A: 255}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(directory, "empty.json"), []byte("[]"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(directory, "broken.json"), []byte("[{"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		paletteName string
+		colors      int
+		valid       bool
+	}{
+		{name: "no palette", colors: 1, valid: true},
+		{name: "saved palette", paletteName: "saved", colors: 2, valid: true},
+		{name: "missing palette", paletteName: "missing"},
+		{name: "palette without colors", paletteName: "empty"},
+		{name: "palette that does not parse", paletteName: "broken"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := Settings{PaletteDirectory: directory, PaletteName: test.paletteName}
+			err := s.Verify()
+			if test.valid && err != nil {
+				t.Fatalf("Verify: %s", err)
+			}
+			if !test.valid {
+				if err == nil {
+					t.Error("a palette that cannot be loaded was accepted")
+				}
+				return
+			}
+			if len(s.Palette) != test.colors {
+				t.Errorf("the palette has %d colors, want %d", len(s.Palette), test.colors)
+			}
+		})
+	}
+}
+
+func TestVerifyPaletteSegments(t *testing.T) {
+	directory := t.TempDir()
+	saved := []color.RGBA{{R: 255, A: 255}, {B: 255, A: 255}}
+	gradient := generatePaletteSettings{StartColor: color.RGBA{A: 255}, EndColor: color.RGBA{G: 255, A: 255}, NumberColors: 4}
+
+	tests := []struct {
+		name     string
+		segments []generatePaletteSettings
+		valid    bool
+	}{
+		{name: "gradient", segments: []generatePaletteSettings{gradient}, valid: true},
+		{name: "missing file", segments: []generatePaletteSettings{gradient, {File: filepath.Join(directory, "missing.map")}}},
+		{name: "no colors", segments: []generatePaletteSettings{{StartColor: color.RGBA{A: 255}}}},
+		{name: "unknown color space", segments: []generatePaletteSettings{{ColorSpace: ColorSpace(9), NumberColors: 2}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := SavePalette(directory, "saved", saved); err != nil {
+				t.Fatal(err)
+			}
+			s := Settings{GeneratePaletteSettings: test.segments, PaletteDirectory: directory, PaletteName: "saved"}
+			err := s.Verify()
+			if test.valid && err != nil {
+				t.Fatalf("Verify: %s", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("a palette segment that cannot be made was accepted")
+			}
+
+			// The saved palette is only replaced by a palette that was made in full
+			palette, err := LoadPalette(directory, "saved")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := len(saved)
+			if test.valid {
+				want = gradient.NumberColors
+			}
+			if len(palette) != want {
+				t.Errorf("the saved palette has %d colors, want %d", len(palette), want)
+			}
+		})
+	}
+}
+
+func TestLegacyPaletteColors(t *testing.T) {
+	// Settings and palettes written before colors had an alpha channel leave out "A"
+	legacy := []byte(`{
+		"EscapeColor": {"R": 10, "G": 20, "B": 30},
+		"GeneratePaletteSettings": [{"StartColor": {"R": 255}, "EndColor": {"B": 255, "A": 0}, "NumberColors": 2}],
+		"Palette": [{"R": 1, "G": 2, "B": 3}, {"R": 4, "G": 5, "B": 6, "A": 128}]
+	}`)
+	var s Settings
+	if err := json.Unmarshal(legacy, &s); err != nil {
+		t.Fatal(err)
+	}
+	if want := (color.RGBA{R: 10, G: 20, B: 30, A: 255}); s.EscapeColor != want {
+		t.Errorf("EscapeColor is %v, want %v", s.EscapeColor, want)
+	}
+	wantPalette := []color.RGBA{{R: 1, G: 2, B: 3, A: 255}, {R: 4, G: 5, B: 6, A: 128}}
+	if !reflect.DeepEqual(s.Palette, wantPalette) {
+		t.Errorf("Palette is %v, want %v", s.Palette, wantPalette)
+	}
+	segment := s.GeneratePaletteSettings[0]
+	if want := (color.RGBA{R: 255, A: 255}); segment.StartColor != want {
+		t.Errorf("StartColor is %v, want %v", segment.StartColor, want)
+	}
+	if want := (color.RGBA{B: 255}); segment.EndColor != want {
+		t.Errorf("EndColor is %v, want %v", segment.EndColor, want)
+	}
+
+	directory := t.TempDir()
+	if err := os.WriteFile(filepath.Join(directory, "legacy.json"), []byte(`[{"R": 255}, {"G": 255, "A": 64}]`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	palette, err := LoadPalette(directory, "legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPalette = []color.RGBA{{R: 255, A: 255}, {G: 255, A: 64}}
+	if !reflect.DeepEqual(palette, wantPalette) {
+		t.Errorf("saved palette is %v, want %v", palette, wantPalette)
+	}
+}
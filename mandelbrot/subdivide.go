@@ -0,0 +1,141 @@
+package mandelbrot
+
+import (
+	"DistributedMandelbrot/task"
+	"image/color"
+	"math"
+)
+
+type subdivisionPixel struct {
+	Calculated bool
+	Color      color.RGBA
+	Iterations []float64
+	Skipped    bool // Filled from the border of its rectangle instead of being calculated
+}
+
+// SubdivideTask
+// Calculates a tile shaped task with the Mariani–Silver algorithm. The border of a rectangle is calculated first and
+// when every border pixel has the same iteration value the inside of the rectangle is filled without iterating,
+// otherwise the rectangle is split into four and each part is checked the same way. Returns false, leaving the task
+// untouched, when subdivision is disabled or the task is not a tile.
+// https://mrob.com/pub/muency/marianisilveralgorithm.html
+func (m *Mandelbrot) SubdivideTask(t *task.Task) bool {
+	if !m.settings.Subdivision || len(t.Results) > 0 {
+		return false
+	}
+	minRow, minColumn, rows, columns, ok := t.TileBounds()
+	if !ok || rows < 3 || columns < 3 {
+		return false
+	}
+
+	// Map each position in the tile back to its coordinate in the task
+	indexes := make([]int, rows*columns)
+	for i, coordinate := range t.Tasks {
+		indexes[int(coordinate.Row-minRow)*columns+int(coordinate.Column-minColumn)] = i
+	}
+	pixels := make([]subdivisionPixel, rows*columns)
+
+	calculate := func(row int, column int) *subdivisionPixel {
+		pixel := &pixels[row*columns+column]
+		if !pixel.Calculated {
+			coordinate := t.Tasks[indexes[row*columns+column]]
+			pixel.Iterations = m.EscapeTimeMultiple(m.GetPointsToCalculate(coordinate))
+			pixel.Color = m.GetColorMultiple(pixel.Iterations, t.Coloring)
+			pixel.Calculated = true
+		}
+		return pixel
+	}
+
+	var fill func(top int, left int, bottom int, right int)
+	fill = func(top int, left int, bottom int, right int) {
+		value := m.uniformValue(calculate(top, left).Iterations)
+		uniform := value >= 0
+		for column := left; column <= right; column++ {
+			uniform = m.uniformValue(calculate(top, column).Iterations) == value && uniform
+			uniform = m.uniformValue(calculate(bottom, column).Iterations) == value && uniform
+		}
+		for row := top; row <= bottom; row++ {
+			uniform = m.uniformValue(calculate(row, left).Iterations) == value && uniform
+			uniform = m.uniformValue(calculate(row, right).Iterations) == value && uniform
+		}
+
+		// The whole rectangle is border so there is nothing left to fill
+		if bottom-top < 2 || right-left < 2 {
+			return
+		}
+
+		// Safety guard: a thin filament can cross a rectangle without touching its border so probe points along the
+		// diagonals before trusting the border
+		if uniform {
+			for probe := 1; probe <= m.settings.SubdivisionProbes && uniform; probe++ {
+				fraction := float64(probe) / float64(m.settings.SubdivisionProbes+1)
+				row := top + 1 + int(fraction*float64(bottom-top-2))
+				column := left + 1 + int(fraction*float64(right-left-2))
+				if probe%2 == 0 {
+					// Alternate between the two diagonals
+					column = right - 1 - int(fraction*float64(right-left-2))
+				}
+				uniform = m.uniformValue(calculate(row, column).Iterations) == value
+			}
+		}
+
+		if uniform {
+			source := pixels[top*columns+left]
+			for row := top + 1; row < bottom; row++ {
+				for column := left + 1; column < right; column++ {
+					pixel := &pixels[row*columns+column]
+					if !pixel.Calculated {
+						*pixel = subdivisionPixel{Calculated: true, Color: source.Color, Iterations: source.Iterations, Skipped: true}
+					}
+				}
+			}
+			return
+		}
+
+		middleRow := (top + bottom) / 2
+		middleColumn := (left + right) / 2
+		fill(top, left, middleRow, middleColumn)
+		fill(top, middleColumn, middleRow, right)
+		fill(middleRow, left, bottom, middleColumn)
+		fill(middleRow, middleColumn, bottom, right)
+	}
+	fill(0, 0, rows-1, columns-1)
+
+	// Return the results in the same order as the coordinates of the task
+	for _, coordinate := range t.Tasks {
+		pixel := pixels[int(coordinate.Row-minRow)*columns+int(coordinate.Column-minColumn)]
+		result := task.Pixel{
+			Color:  pixel.Color,
+			Column: coordinate.Column,
+			Row:    coordinate.Row,
+		}
+		if t.KeepIterations {
+			result.Iterations = pixel.Iterations
+		}
+		t.AddResult(result)
+		t.Statistics.AddSamples(pixel.Iterations, m.settings.MaxIterations)
+		if pixel.Skipped {
+			t.Statistics.SkippedPixels++
+		}
+	}
+	return true
+}
+
+// uniformValue
+// Returns the iteration value shared by every sample of a pixel, or -1 when the samples differ. Smooth coloring gives
+// every escaped point its own color so only points in the set count as uniform then.
+func (m *Mandelbrot) uniformValue(iterations []float64) float64 {
+	value := math.Floor(iterations[0])
+	for _, iteration := range iterations[1:] {
+		if math.Floor(iteration) != value {
+			return -1
+		}
+	}
+	if value >= float64(m.settings.MaxIterations) {
+		return float64(m.settings.MaxIterations)
+	}
+	if m.settings.SmoothColoring {
+		return -1
+	}
+	return value
+}
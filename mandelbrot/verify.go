@@ -0,0 +1,21 @@
+package mandelbrot
+
+import (
+	"DistributedMandelbrot/task"
+	"image/color"
+)
+
+// CheckPixel
+// Recalculates the pixel and returns true when the color a worker gave it is within tolerance of the result. With
+// adaptive super sampling the worker may or may not have refined the pixel so either color is accepted
+func (m *Mandelbrot) CheckPixel(coordinate task.Coordinate, coloring task.Coloring, given color.RGBA, tolerance int) bool {
+	expected := m.GetColorMultiple(m.EscapeTimeMultiple(m.GetPointsToCalculate(coordinate)), coloring)
+	if colorDifference(expected, given) <= tolerance {
+		return true
+	}
+	if !m.settings.AdaptiveSampling {
+		return false
+	}
+	refined := m.GetColorMultiple(m.EscapeTimeMultiple(m.getSamplePoints(coordinate)), coloring)
+	return colorDifference(refined, given) <= tolerance
+}
@@ -0,0 +1,266 @@
+package misc
+
+import (
+	"encoding/json"
+	"image/color"
+	"math"
+)
+
+// There are only 256 possible sRGB channel values so their linear values are worked out once
+var srgbToLinear [256]float64
+
+func init() {
+	for i := range srgbToLinear {
+		c := float64(i) / 255
+		if c <= 0.04045 {
+			srgbToLinear[i] = c / 12.92
+		} else {
+			srgbToLinear[i] = math.Pow((c+0.055)/1.055, 2.4)
+		}
+	}
+}
+
+// SRGBToLinear
+// Converts an 8-bit sRGB channel value to a linear light value in the range [0, 1]
+// https://en.wikipedia.org/wiki/SRGB#From_sRGB_to_CIE_XYZ
+func SRGBToLinear(v uint8) float64 {
+	return srgbToLinear[v]
+}
+
+// LinearToSRGB
+// Converts a linear light value in the range [0, 1] back to an 8-bit sRGB channel value
+func LinearToSRGB(v float64) uint8 {
+	v = clamp(v, 0, 1)
+	if v <= 0.0031308 {
+		v *= 12.92
+	} else {
+		v = 1.055*math.Pow(v, 1/2.4) - 0.055
+	}
+	return uint8(math.Round(v * 255))
+}
+
+// RGBToHSV
+// Returns the hue in degrees [0, 360) along with the saturation and value in the range [0, 1]
+func RGBToHSV(c color.RGBA) (float64, float64, float64) {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	delta := max - min
+
+	var h float64
+	switch {
+	case delta == 0:
+		h = 0
+	case max == r:
+		h = 60 * math.Mod((g-b)/delta, 6)
+	case max == g:
+		h = 60 * ((b-r)/delta + 2)
+	default:
+		h = 60 * ((r-g)/delta + 4)
+	}
+	if h < 0 {
+		h += 360
+	}
+
+	var s float64
+	if max > 0 {
+		s = delta / max
+	}
+	return h, s, max
+}
+
+// HSVToRGB
+// Inverse of RGBToHSV. The returned color is fully opaque
+func HSVToRGB(h float64, s float64, v float64) color.RGBA {
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := v - c
+
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	return color.RGBA{R: unitToUint8(r + m), G: unitToUint8(g + m), B: unitToUint8(b + m), A: 255}
+}
+
+// RGBToOKLab
+// https://bottosson.github.io/posts/oklab/
+func RGBToOKLab(c color.RGBA) (float64, float64, float64) {
+	r, g, b := SRGBToLinear(c.R), SRGBToLinear(c.G), SRGBToLinear(c.B)
+
+	l := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b)
+	m := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b)
+	s := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b)
+
+	return 0.2104542553*l + 0.7936177850*m - 0.0040720468*s,
+		1.9779984951*l - 2.4285922050*m + 0.4505937099*s,
+		0.0259040371*l + 0.7827717662*m - 0.8086757660*s
+}
+
+// OKLabToRGB
+// Inverse of RGBToOKLab. The returned color is fully opaque
+func OKLabToRGB(l float64, a float64, b float64) color.RGBA {
+	l1 := l + 0.3963377774*a + 0.2158037573*b
+	m1 := l - 0.1055613458*a - 0.0638541728*b
+	s1 := l - 0.0894841775*a - 1.2914855480*b
+	l1, m1, s1 = l1*l1*l1, m1*m1*m1, s1*s1*s1
+
+	return color.RGBA{
+		R: LinearToSRGB(+4.0767416621*l1 - 3.3077115913*m1 + 0.2309699292*s1),
+		G: LinearToSRGB(-1.2684380046*l1 + 2.6097574011*m1 - 0.3413193965*s1),
+		B: LinearToSRGB(-0.0041960863*l1 - 0.7034186147*m1 + 1.7076147010*s1),
+		A: 255,
+	}
+}
+
+func LinearInterpolationHSV(color1 color.RGBA, color2 color.RGBA, fraction float64) color.RGBA {
+	h1, s1, v1 := RGBToHSV(color1)
+	h2, s2, v2 := RGBToHSV(color2)
+
+	// Travel around the hue wheel the short way
+	if h2-h1 > 180 {
+		h1 += 360
+	} else if h1-h2 > 180 {
+		h2 += 360
+	}
+	finalColor := HSVToRGB(LerpFloat64(h1, h2, fraction), LerpFloat64(s1, s2, fraction), LerpFloat64(v1, v2, fraction))
+	finalColor.A = LerpUint8(color1.A, color2.A, fraction)
+	return finalColor
+}
+
+func LinearInterpolationLinearRGB(color1 color.RGBA, color2 color.RGBA, fraction float64) color.RGBA {
+	var finalColor color.RGBA
+	finalColor.R = LinearToSRGB(LerpFloat64(SRGBToLinear(color1.R), SRGBToLinear(color2.R), fraction))
+	finalColor.G = LinearToSRGB(LerpFloat64(SRGBToLinear(color1.G), SRGBToLinear(color2.G), fraction))
+	finalColor.B = LinearToSRGB(LerpFloat64(SRGBToLinear(color1.B), SRGBToLinear(color2.B), fraction))
+	finalColor.A = LerpUint8(color1.A, color2.A, fraction)
+	return finalColor
+}
+
+func LinearInterpolationOKLab(color1 color.RGBA, color2 color.RGBA, fraction float64) color.RGBA {
+	l1, a1, b1 := RGBToOKLab(color1)
+	l2, a2, b2 := RGBToOKLab(color2)
+	finalColor := OKLabToRGB(LerpFloat64(l1, l2, fraction), LerpFloat64(a1, a2, fraction), LerpFloat64(b1, b2, fraction))
+	finalColor.A = LerpUint8(color1.A, color2.A, fraction)
+	return finalColor
+}
+
+// AverageColors
+// Averages straight (non-premultiplied) alpha colors in linear light. Each color is weighted by its alpha so fully
+// transparent samples do not darken the result. The returned color is alpha premultiplied, as image.RGBA expects.
+func AverageColors(colors []color.RGBA) color.RGBA {
+	return WeightedAverageColors(colors, nil)
+}
+
+// WeightedAverageColors
+// Same as AverageColors but each color also counts for its weight. A nil weights slice weighs every color equally
+func WeightedAverageColors(colors []color.RGBA, weights []float64) color.RGBA {
+	var r, g, b, alpha, total float64
+	for i, c := range colors {
+		weight := 1.0
+		if weights != nil {
+			weight = weights[i]
+		}
+		a := weight * float64(c.A) / 255
+		r += SRGBToLinear(c.R) * a
+		g += SRGBToLinear(c.G) * a
+		b += SRGBToLinear(c.B) * a
+		alpha += a
+		total += weight
+	}
+	if alpha == 0 || total == 0 {
+		return color.RGBA{}
+	}
+
+	coverage := alpha / total
+	premultiply := func(v float64) uint8 {
+		return uint8(math.Round(float64(LinearToSRGB(v/alpha)) * coverage))
+	}
+	return color.RGBA{R: premultiply(r), G: premultiply(g), B: premultiply(b), A: unitToUint8(coverage)}
+}
+
+// Unpremultiply
+// Converts an alpha premultiplied color, like those stored in image.RGBA, to straight alpha
+func Unpremultiply(c color.RGBA) color.RGBA {
+	if c.A == 0 {
+		return color.RGBA{}
+	}
+	if c.A == 255 {
+		return c
+	}
+	a := float64(c.A)
+	return color.RGBA{
+		R: uint8(math.Min(255, math.Round(float64(c.R)*255/a))),
+		G: uint8(math.Min(255, math.Round(float64(c.G)*255/a))),
+		B: uint8(math.Min(255, math.Round(float64(c.B)*255/a))),
+		A: c.A,
+	}
+}
+
+// UnmarshalColor
+// Decodes a JSON color. A color that leaves out "A" is opaque, as colors were before they had an alpha channel
+func UnmarshalColor(data []byte, c *color.RGBA) error {
+	var decoded *jsonColor
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if decoded != nil {
+		*c = decoded.RGBA()
+	}
+	return nil
+}
+
+// UnmarshalColors
+// Decodes a JSON array of colors the way UnmarshalColor does
+func UnmarshalColors(data []byte, colors *[]color.RGBA) error {
+	var decoded []jsonColor
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if decoded == nil {
+		return nil
+	}
+	*colors = make([]color.RGBA, len(decoded))
+	for i, c := range decoded {
+		(*colors)[i] = c.RGBA()
+	}
+	return nil
+}
+
+type jsonColor struct {
+	A *uint8
+	B uint8
+	G uint8
+	R uint8
+}
+
+func (c jsonColor) RGBA() color.RGBA {
+	rgba := color.RGBA{R: c.R, G: c.G, B: c.B, A: 255}
+	if c.A != nil {
+		rgba.A = *c.A
+	}
+	return rgba
+}
+
+func clamp(v float64, min float64, max float64) float64 {
+	return math.Max(min, math.Min(max, v))
+}
+
+func unitToUint8(v float64) uint8 {
+	return uint8(math.Round(clamp(v, 0, 1) * 255))
+}
@@ -0,0 +1,60 @@
+package misc
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	StatsAction ControlAction = iota
+	PauseAction
+	ResumeAction
+	DrainAction
+	ConcurrencyAction
+)
+
+// ControlAction
+// What an operator asks of workers through the coordinator. Every action replies with the stats of the workers
+type ControlAction int
+
+func (a ControlAction) String() string {
+	return []string{
+		"stats", "pause", "resume", "drain", "concurrency",
+	}[a]
+}
+
+// ParseControlAction
+// Returns the action with the name String gives it
+func ParseControlAction(name string) (ControlAction, error) {
+	for a := StatsAction; a <= ConcurrencyAction; a++ {
+		if a.String() == name {
+			return a, nil
+		}
+	}
+	return StatsAction, fmt.Errorf("unknown action '%s'", name)
+}
+
+// ControlRequest
+// Asks the coordinator to apply Action to Workers, or every worker when it is empty. Concurrency is the number of tasks
+// each worker calculates at once after a ConcurrencyAction
+type ControlRequest struct {
+	Action      ControlAction
+	Concurrency uint
+	Workers     []string
+}
+
+// WorkerStats
+// What a worker is up to. CPUSeconds is the CPU time used by the process the worker runs in, zero where it cannot be
+// measured
+type WorkerStats struct {
+	Address        string
+	Concurrency    uint
+	CPUs           int
+	CPUSeconds     float64
+	CurrentTasks   []uint
+	Draining       bool
+	Error          string // Why the coordinator could not reach the worker
+	Paused         bool
+	TasksCompleted int
+	Uptime         time.Duration
+}
@@ -0,0 +1,116 @@
+package misc
+
+import (
+	"encoding/json"
+	"github.com/BrugadaSyndrome/bslogger"
+	"net"
+	"time"
+)
+
+// DefaultDiscoveryGroup
+// The multicast group and port coordinators announce themselves on when the settings do not name one
+const DefaultDiscoveryGroup = "239.255.77.77:51077"
+
+const beaconService = "DistributedMandelbrot"
+
+// Beacon
+// What a coordinator announces about itself on the local network
+type Beacon struct {
+	Address         string // Where workers reach the coordinator
+	ProtocolVersion uint
+	RunName         string
+	Service         string // Tells beacons apart from anything else sent to the group
+}
+
+// Advertiser
+// Sends a beacon to a multicast group every interval until it is closed
+type Advertiser struct {
+	conn *net.UDPConn
+	done chan struct{}
+}
+
+func NewAdvertiser(beacon Beacon, group string, interval time.Duration, logger bslogger.Logger) (*Advertiser, error) {
+	groupAddress, err := net.ResolveUDPAddr("udp4", group)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp4", nil, groupAddress)
+	if err != nil {
+		return nil, err
+	}
+	beacon.ProtocolVersion = ProtocolVersion
+	beacon.Service = beaconService
+	message, err := json.Marshal(beacon)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	a := &Advertiser{
+		conn: conn,
+		done: make(chan struct{}),
+	}
+	go a.advertise(message, interval, logger)
+	return a, nil
+}
+
+func (a *Advertiser) advertise(message []byte, interval time.Duration, logger bslogger.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := a.conn.Write(message); err != nil {
+			logger.Debugf("Unable to send beacon: %s", err)
+		}
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Advertiser) Close() error {
+	close(a.done)
+	return a.conn.Close()
+}
+
+// Discover
+// Listens on the multicast group for a coordinator that speaks this protocol version and runs runName, or any run when
+// runName is empty. Gives up after timeout
+func Discover(group string, runName string, timeout time.Duration) (Beacon, error) {
+	groupAddress, err := net.ResolveUDPAddr("udp4", group)
+	if err != nil {
+		return Beacon{}, err
+	}
+	conn, err := net.ListenMulticastUDP("udp4", nil, groupAddress)
+	if err != nil {
+		return Beacon{}, err
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+
+	buffer := make([]byte, 2048)
+	for {
+		n, source, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			return Beacon{}, err
+		}
+		var beacon Beacon
+		if json.Unmarshal(buffer[:n], &beacon) != nil || beacon.Service != beaconService {
+			continue
+		}
+		if beacon.ProtocolVersion != ProtocolVersion || (runName != "" && beacon.RunName != runName) {
+			continue
+		}
+
+		// A coordinator listening on every interface is reached at the address the beacon came from
+		host, port, err := net.SplitHostPort(beacon.Address)
+		if err != nil {
+			continue
+		}
+		if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+			beacon.Address = net.JoinHostPort(source.IP.String(), port)
+		}
+		return beacon, nil
+	}
+}
@@ -12,15 +12,17 @@ func LerpFloat64(v1 float64, v2 float64, fraction float64) float64 {
 func LerpUint8(v1 uint8, v2 uint8, fraction float64) uint8 {
 	v1f := float64(v1)
 	v2f := float64(v2)
-	return uint8(LerpFloat64(v1f, v2f, fraction))
+	return uint8(math.Round(LerpFloat64(v1f, v2f, fraction)))
 }
 
+// LinearInterpolationRGB
+// Blends the sRGB bytes of the two colors directly. Use LinearInterpolationLinearRGB to blend in linear light
 func LinearInterpolationRGB(color1 color.RGBA, color2 color.RGBA, fraction float64) color.RGBA {
 	var finalColor color.RGBA
-	finalColor.R = uint8(LerpFloat64(float64(color1.R), float64(color2.R), fraction))
-	finalColor.G = uint8(LerpFloat64(float64(color1.G), float64(color2.G), fraction))
-	finalColor.B = uint8(LerpFloat64(float64(color1.B), float64(color2.B), fraction))
-	finalColor.A = 255
+	finalColor.R = LerpUint8(color1.R, color2.R, fraction)
+	finalColor.G = LerpUint8(color1.G, color2.G, fraction)
+	finalColor.B = LerpUint8(color1.B, color2.B, fraction)
+	finalColor.A = LerpUint8(color1.A, color2.A, fraction)
 	return finalColor
 }
 
@@ -0,0 +1,166 @@
+package misc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/BrugadaSyndrome/bslogger"
+	"os"
+	"sync"
+	"time"
+)
+
+// CoordinatorSource
+// The Source of the events the coordinator records, workers record their address
+const CoordinatorSource = "coordinator"
+
+const (
+	RunStarted EventKind = iota
+	RunStopped
+	WorkerJoined
+	WorkerLeft
+	TaskIssued
+	TaskReturned
+	TaskRequeued
+	TaskCalculated
+	FrameSaved
+	MovieEncoded
+	WorkerPaused
+	WorkerResumed
+)
+
+// EventKind
+// What happened. It is written to the journal by name so the journal reads the same whatever the version
+type EventKind int
+
+func (k EventKind) String() string {
+	return []string{
+		"run started", "run stopped", "worker joined", "worker left", "task issued", "task returned", "task requeued",
+		"task calculated", "frame saved", "movie encoded", "worker paused", "worker resumed",
+	}[k]
+}
+
+func (k EventKind) MarshalText() ([]byte, error) {
+	if k < RunStarted || k > WorkerResumed {
+		return nil, fmt.Errorf("unknown event kind %d", k)
+	}
+	return []byte(k.String()), nil
+}
+
+func (k *EventKind) UnmarshalText(text []byte) error {
+	for kind := RunStarted; kind <= WorkerResumed; kind++ {
+		if kind.String() == string(text) {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown event kind '%s'", text)
+}
+
+// Event
+// One line of a journal. Duration is the time the worker spent calculating a task, Elapsed the time from handing a
+// task out until it came back or was requeued, or how long a movie took to encode. Fields that are zero are left out,
+// which takes care of those that do not apply to the kind of event
+type Event struct {
+	Coordinator string        `json:",omitempty"` // Address of the coordinator a worker joined
+	Duration    time.Duration `json:",omitempty"`
+	Elapsed     time.Duration `json:",omitempty"`
+	Image       uint          `json:",omitempty"`
+	Kind        EventKind
+	Reason      string `json:",omitempty"` // Why a run stopped, a worker left or a movie failed
+	Source      string // Who recorded the event, CoordinatorSource or the address of a worker
+	Task        uint   `json:",omitempty"`
+	Time        time.Time
+	Worker      string `json:",omitempty"`
+}
+
+// Journal
+// Appends events to a file as JSON lines. A nil journal records nothing so callers need not check whether one is kept
+type Journal struct {
+	encoder *json.Encoder
+	file    *os.File
+	logger  bslogger.Logger
+	mutex   sync.Mutex
+	source  string
+}
+
+// NewJournal
+// Opens the journal at path, truncating it unless keep is set. Events recorded without a Source get source
+func NewJournal(path string, source string, keep bool, logger bslogger.Logger) (*Journal, error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if !keep {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{
+		encoder: json.NewEncoder(file),
+		file:    file,
+		logger:  logger,
+		source:  source,
+	}, nil
+}
+
+// Record
+// Writes the event, stamped with the current time when it has none. Failures are logged, the run carries on without
+// the event
+func (j *Journal) Record(event Event) {
+	if j == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.Source == "" {
+		event.Source = j.source
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.file == nil {
+		return
+	}
+	CheckError(j.encoder.Encode(event), j.logger, Warning)
+}
+
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// ReadJournal
+// Returns the events of the journal at path in the order they were written. A line cut short by a crash ends the
+// journal instead of failing it
+func ReadJournal(path string) ([]Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var event Event
+		if err = json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			if !scanner.Scan() {
+				break
+			}
+			return nil, fmt.Errorf("%s line %d: %s", path, line, err)
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
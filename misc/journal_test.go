@@ -0,0 +1,126 @@
+package misc
+
+import (
+	"github.com/BrugadaSyndrome/bslogger"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventKindText(t *testing.T) {
+	for kind := RunStarted; kind <= WorkerResumed; kind++ {
+		text, err := kind.MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText %d: %s", kind, err)
+		}
+		var read EventKind
+		if err = read.UnmarshalText(text); err != nil || read != kind {
+			t.Errorf("%s read back as %s (%v)", kind, read, err)
+		}
+	}
+	if _, err := EventKind(-1).MarshalText(); err == nil {
+		t.Error("an unknown kind was written")
+	}
+	var read EventKind
+	if err := read.UnmarshalText([]byte("run exploded")); err == nil {
+		t.Error("an unknown kind was read")
+	}
+}
+
+func TestReadJournal(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Kind: RunStarted, Time: start},
+		{Kind: WorkerJoined, Time: start.Add(time.Second), Worker: "10.0.0.2:4000"},
+		{Duration: 2 * time.Second, Elapsed: 3 * time.Second, Image: 4, Kind: TaskReturned, Task: 17, Time: start.Add(5 * time.Second), Worker: "10.0.0.2:4000"},
+		{Kind: RunStopped, Reason: "finished", Time: start.Add(6 * time.Second)},
+	}
+
+	tests := []struct {
+		name   string
+		append string // Written after the events
+		want   int    // Events read back, -1 when reading fails
+	}{
+		{name: "complete", want: len(events)},
+		{name: "last line cut short", append: `{"Kind":"task iss`, want: len(events)},
+		{name: "broken line in the middle", append: "{\"Kind\":\n" + `{"Kind":"run started","Source":"coordinator","Time":"2024-05-01T12:00:07Z"}` + "\n", want: -1},
+		{name: "unknown kind", append: `{"Kind":"run exploded","Source":"coordinator","Time":"2024-05-01T12:00:07Z"}` + "\n" + `{"Kind":"run stopped","Source":"coordinator","Time":"2024-05-01T12:00:08Z"}` + "\n", want: -1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "journal.jsonl")
+			journal, err := NewJournal(path, CoordinatorSource, false, bslogger.NewLogger("Journal", bslogger.Normal, nil))
+			if err != nil {
+				t.Fatalf("NewJournal: %s", err)
+			}
+			for _, event := range events {
+				journal.Record(event)
+			}
+			if err = journal.Close(); err != nil {
+				t.Fatalf("Close: %s", err)
+			}
+			file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = file.WriteString(test.append); err != nil {
+				t.Fatal(err)
+			}
+			if err = file.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			read, err := ReadJournal(path)
+			if test.want < 0 {
+				if err == nil {
+					t.Errorf("a broken journal was read")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadJournal: %s", err)
+			}
+			if len(read) != test.want {
+				t.Fatalf("read %d events, want %d", len(read), test.want)
+			}
+			for i, event := range events {
+				event.Source = CoordinatorSource
+				if !reflect.DeepEqual(read[i], event) {
+					t.Errorf("event %d read back as %+v, want %+v", i, read[i], event)
+				}
+			}
+		})
+	}
+}
+
+func TestJournalKeep(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	for i, keep := range []bool{false, true, true, false} {
+		journal, err := NewJournal(path, "10.0.0.2:4000", keep, bslogger.NewLogger("Journal", bslogger.Normal, nil))
+		if err != nil {
+			t.Fatalf("NewJournal: %s", err)
+		}
+		journal.Record(Event{Kind: WorkerJoined, Task: uint(i + 1)})
+		if err = journal.Close(); err != nil {
+			t.Fatalf("Close: %s", err)
+		}
+		// Recording on a closed journal does nothing
+		journal.Record(Event{Kind: WorkerLeft})
+	}
+	read, err := ReadJournal(path)
+	if err != nil {
+		t.Fatalf("ReadJournal: %s", err)
+	}
+	if len(read) != 1 || read[0].Task != 4 || read[0].Source != "10.0.0.2:4000" || read[0].Time.IsZero() {
+		t.Errorf("read %+v, want the one event of the last journal", read)
+	}
+
+	// A nil journal is what callers have when no journal is kept
+	var journal *Journal
+	journal.Record(Event{Kind: RunStarted})
+	if err = journal.Close(); err != nil {
+		t.Errorf("closing a nil journal: %s", err)
+	}
+}
@@ -0,0 +1,204 @@
+package misc
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image/color"
+	"io"
+)
+
+// PNGWriter
+// Encodes a PNG one row at a time so images too large to hold in memory can still be saved. Only 8-bit RGB and RGBA
+// images are written.
+// https://www.w3.org/TR/png/
+type PNGWriter struct {
+	alpha    bool
+	chunks   *pngChunkWriter
+	current  []byte
+	filtered []byte
+	height   int
+	previous []byte
+	rowsLeft int
+	width    int
+	zlib     *zlib.Writer
+}
+
+func NewPNGWriter(w io.Writer, width int, height int, alpha bool) (*PNGWriter, error) {
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("png images need a positive width and height")
+	}
+	bytesPerPixel := 3
+	colorType := byte(2)
+	if alpha {
+		bytesPerPixel = 4
+		colorType = 6
+	}
+
+	buffered := bufio.NewWriter(w)
+	if _, err := buffered.Write([]byte("\x89PNG\r\n\x1a\n")); err != nil {
+		return nil, err
+	}
+	header := make([]byte, 13)
+	binary.BigEndian.PutUint32(header[0:4], uint32(width))
+	binary.BigEndian.PutUint32(header[4:8], uint32(height))
+	header[8] = 8 // bit depth
+	header[9] = colorType
+	if err := writePNGChunk(buffered, "IHDR", header); err != nil {
+		return nil, err
+	}
+
+	chunks := &pngChunkWriter{writer: buffered}
+	return &PNGWriter{
+		alpha:    alpha,
+		chunks:   chunks,
+		current:  make([]byte, width*bytesPerPixel),
+		filtered: make([]byte, 1+width*bytesPerPixel),
+		height:   height,
+		previous: make([]byte, width*bytesPerPixel),
+		rowsLeft: height,
+		width:    width,
+		zlib:     zlib.NewWriter(chunks),
+	}, nil
+}
+
+// WriteRow
+// Adds the next row of the image from the top. The colors are straight (not premultiplied) alpha
+func (p *PNGWriter) WriteRow(row []color.RGBA) error {
+	if len(row) != p.width {
+		return errors.New("png row does not match the image width")
+	}
+	if p.rowsLeft == 0 {
+		return errors.New("png image already has all of its rows")
+	}
+	p.rowsLeft--
+
+	i := 0
+	for _, c := range row {
+		p.current[i], p.current[i+1], p.current[i+2] = c.R, c.G, c.B
+		i += 3
+		if p.alpha {
+			p.current[i] = c.A
+			i++
+		}
+	}
+
+	p.filterRow()
+	if _, err := p.zlib.Write(p.filtered); err != nil {
+		return err
+	}
+	p.previous, p.current = p.current, p.previous
+	return nil
+}
+
+// filterRow
+// Picks the None, Sub or Up filter for the row, whichever has the smallest sum of absolute differences. This is the
+// heuristic the PNG specification suggests
+func (p *PNGWriter) filterRow() {
+	bytesPerPixel := 3
+	if p.alpha {
+		bytesPerPixel = 4
+	}
+	abs := func(b byte) int {
+		if b < 128 {
+			return int(b)
+		}
+		return 256 - int(b)
+	}
+
+	var none, sub, up int
+	for i, b := range p.current {
+		none += abs(b)
+		if i >= bytesPerPixel {
+			sub += abs(b - p.current[i-bytesPerPixel])
+		} else {
+			sub += abs(b)
+		}
+		up += abs(b - p.previous[i])
+	}
+	if p.rowsLeft == p.height-1 {
+		// The first row has no row above it
+		up = none + 1
+	}
+
+	switch {
+	case none <= sub && none <= up:
+		p.filtered[0] = 0
+		copy(p.filtered[1:], p.current)
+	case sub <= up:
+		p.filtered[0] = 1
+		for i, b := range p.current {
+			if i >= bytesPerPixel {
+				b -= p.current[i-bytesPerPixel]
+			}
+			p.filtered[i+1] = b
+		}
+	default:
+		p.filtered[0] = 2
+		for i, b := range p.current {
+			p.filtered[i+1] = b - p.previous[i]
+		}
+	}
+}
+
+// Close
+// Finishes the image. Every row has to have been written
+func (p *PNGWriter) Close() error {
+	if p.rowsLeft > 0 {
+		return errors.New("png image is missing rows")
+	}
+	if err := p.zlib.Close(); err != nil {
+		return err
+	}
+	if err := p.chunks.Flush(); err != nil {
+		return err
+	}
+	if err := writePNGChunk(p.chunks.writer, "IEND", nil); err != nil {
+		return err
+	}
+	return p.chunks.writer.Flush()
+}
+
+// pngChunkWriter
+// Splits the compressed image data into IDAT chunks
+type pngChunkWriter struct {
+	buffer []byte
+	writer *bufio.Writer
+}
+
+func (cw *pngChunkWriter) Write(b []byte) (int, error) {
+	cw.buffer = append(cw.buffer, b...)
+	if len(cw.buffer) >= 1<<16 {
+		return len(b), cw.Flush()
+	}
+	return len(b), nil
+}
+
+func (cw *pngChunkWriter) Flush() error {
+	if len(cw.buffer) == 0 {
+		return nil
+	}
+	err := writePNGChunk(cw.writer, "IDAT", cw.buffer)
+	cw.buffer = cw.buffer[:0]
+	return err
+}
+
+func writePNGChunk(w io.Writer, name string, data []byte) error {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[0:4], uint32(len(data)))
+	copy(header[4:8], name)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:8])
+	crc.Write(data)
+	footer := make([]byte, 4)
+	binary.BigEndian.PutUint32(footer, crc.Sum32())
+
+	for _, b := range [][]byte{header, data, footer} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
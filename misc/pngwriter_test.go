@@ -0,0 +1,96 @@
+package misc
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestPNGWriterDecodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		width  int
+		height int
+		alpha  bool
+		color  func(x int, y int) color.RGBA
+	}{
+		{name: "one pixel", width: 1, height: 1, color: func(x, y int) color.RGBA { return color.RGBA{R: 9, G: 8, B: 7, A: 255} }},
+		{name: "flat", width: 30, height: 20, color: func(x, y int) color.RGBA { return color.RGBA{R: 200, G: 100, B: 50, A: 255} }},
+		{name: "gradient", width: 64, height: 48, color: func(x, y int) color.RGBA {
+			return color.RGBA{R: uint8(x * 4), G: uint8(y * 5), B: uint8(x ^ y), A: 255}
+		}},
+		{name: "transparent", width: 33, height: 17, alpha: true, color: func(x, y int) color.RGBA {
+			return color.RGBA{R: uint8(x), G: uint8(y), B: 3, A: uint8(x * y)}
+		}},
+		// More than one IDAT chunk
+		{name: "noise", width: 300, height: 300, color: func(x, y int) color.RGBA {
+			return color.RGBA{R: uint8(x * 7919 >> 3), G: uint8(y * 104729 >> 5), B: uint8((x + y) * 31), A: 255}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var encoded bytes.Buffer
+			writer, err := NewPNGWriter(&encoded, test.width, test.height, test.alpha)
+			if err != nil {
+				t.Fatalf("NewPNGWriter: %s", err)
+			}
+			row := make([]color.RGBA, test.width)
+			for y := 0; y < test.height; y++ {
+				for x := range row {
+					row[x] = test.color(x, y)
+				}
+				if err = writer.WriteRow(row); err != nil {
+					t.Fatalf("WriteRow %d: %s", y, err)
+				}
+			}
+			if err = writer.Close(); err != nil {
+				t.Fatalf("Close: %s", err)
+			}
+
+			decoded, err := png.Decode(&encoded)
+			if err != nil {
+				t.Fatalf("the image does not decode: %s", err)
+			}
+			if decoded.Bounds() != image.Rect(0, 0, test.width, test.height) {
+				t.Fatalf("decoded bounds %s, want %dx%d", decoded.Bounds(), test.width, test.height)
+			}
+			for y := 0; y < test.height; y++ {
+				for x := 0; x < test.width; x++ {
+					want := test.color(x, y)
+					if !test.alpha {
+						want.A = 255
+					}
+					got := color.NRGBAModel.Convert(decoded.At(x, y)).(color.NRGBA)
+					if got != color.NRGBA(want) {
+						t.Fatalf("pixel (%d, %d) is %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPNGWriterRowCount(t *testing.T) {
+	var encoded bytes.Buffer
+	if _, err := NewPNGWriter(&encoded, 0, 1, false); err == nil {
+		t.Error("an image without a width was accepted")
+	}
+	writer, err := NewPNGWriter(&encoded, 2, 1, false)
+	if err != nil {
+		t.Fatalf("NewPNGWriter: %s", err)
+	}
+	if err = writer.WriteRow(make([]color.RGBA, 3)); err == nil {
+		t.Error("a row wider than the image was accepted")
+	}
+	if err = writer.Close(); err == nil {
+		t.Error("an image missing a row was closed")
+	}
+	if err = writer.WriteRow(make([]color.RGBA, 2)); err != nil {
+		t.Fatalf("WriteRow: %s", err)
+	}
+	if err = writer.WriteRow(make([]color.RGBA, 2)); err == nil {
+		t.Error("a row past the bottom of the image was accepted")
+	}
+}
@@ -0,0 +1,29 @@
+package misc
+
+const (
+	AdaptiveSamplingFeature Feature = iota
+	KeepIterationsFeature
+	MergedTasksFeature
+	SubdivisionFeature
+)
+
+// ProtocolVersion
+// The version of the types sent between the coordinator and its workers. Bump it whenever one of them changes in a way
+// gob would quietly decode into the wrong values, workers only join a coordinator that speaks the same version.
+const ProtocolVersion uint = 1
+
+// Feature
+// Something a worker can do that not every run needs. New features are added to the end so their numbers do not change
+type Feature int
+
+func (f Feature) String() string {
+	return []string{
+		"AdaptiveSampling", "KeepIterations", "MergedTasks", "Subdivision",
+	}[f]
+}
+
+// AllFeatures
+// Returns every feature this build of the program supports
+func AllFeatures() []Feature {
+	return []Feature{AdaptiveSamplingFeature, KeepIterationsFeature, MergedTasksFeature, SubdivisionFeature}
+}
@@ -0,0 +1,54 @@
+package misc
+
+import "DistributedMandelbrot/task"
+
+// Registration
+// Sent by a worker when it joins the coordinator
+type Registration struct {
+	Address         string
+	Encodings       []task.Encoding // Result encodings the worker can produce
+	Features        []Feature
+	ProtocolVersion uint
+}
+
+// RegistrationReply
+// The coordinator's answer to a Registration
+type RegistrationReply struct {
+	Encoding        task.Encoding // Encoding the worker should use for its results
+	ProtocolVersion uint
+}
+
+// BenchmarkReport
+// Sent by a worker once it has the mandelbrot settings and has timed how fast it calculates them
+type BenchmarkReport struct {
+	Address   string
+	Benchmark float64 // Iterations per second the worker calculated in its benchmark
+}
+
+// TaskRequest
+// Asks the coordinator for up to Count tasks in one call
+type TaskRequest struct {
+	Address string
+	Count   uint
+}
+
+// HTTPRegistrationReply
+// The coordinator's answer to a worker joining over HTTP. Such a worker has no address of its own so the coordinator
+// names it, the WorkerID is sent as the Address of every later request
+type HTTPRegistrationReply struct {
+	RegistrationReply
+	WorkerID string
+}
+
+// HTTPWorker
+// Names the worker making an HTTP request that needs nothing else
+type HTTPWorker struct {
+	Address string
+}
+
+// HTTPResults
+// Finished tasks returned over HTTP
+type HTTPResults struct {
+	Address string
+	Tasks   []task.Task
+}
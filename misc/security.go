@@ -0,0 +1,411 @@
+package misc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/BrugadaSyndrome/bslogger"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// Time a peer has to finish the handshake before its connection is dropped
+const handshakeTimeout = 10 * time.Second
+
+const nonceSize = 32
+
+// Largest payload of a frame on a connection protected by the secret alone
+const maxFrameSize = 64 * 1024
+
+var errTampered = errors.New("a frame failed its HMAC, the connection was tampered with")
+
+// SecuritySettings
+// Protects the rpc connections between the coordinator and its workers. With CertFile, KeyFile and CAFile set every
+// connection uses mutual TLS and both sides must present a certificate signed by the CA. With Secret set both sides
+// prove they know it with an HMAC challenge before any rpc is carried, after which every frame of the traffic carries
+// an HMAC over its sequence number and payload so it cannot be altered, replayed or injected. Either can be used alone,
+// use both on networks you do not trust since the secret alone does not hide the traffic.
+type SecuritySettings struct {
+	CAFile   string
+	CertFile string
+	KeyFile  string
+	Secret   string
+}
+
+func (s *SecuritySettings) Verify() error {
+	set := 0
+	for _, path := range []string{s.CAFile, s.CertFile, s.KeyFile} {
+		if path != "" {
+			set++
+		}
+	}
+	if set != 0 && set != 3 {
+		return errors.New("mutual TLS needs a CAFile, CertFile and KeyFile")
+	}
+	if set == 3 {
+		if _, err := s.TLSConfig(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Enabled
+// Returns true when connections have to go through a Guard and a Connector
+func (s *SecuritySettings) Enabled() bool {
+	return s.CertFile != "" || s.Secret != ""
+}
+
+// TLSConfig
+// Returns the mutual TLS configuration, or nil when no certificate is set
+func (s *SecuritySettings) TLSConfig() (*tls.Config, error) {
+	if s.CertFile == "" {
+		return nil, nil
+	}
+	certificate, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load certificate %s - %s", s.CertFile, err)
+	}
+	ca, err := os.ReadFile(s.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CA %s - %s", s.CAFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in CA %s", s.CAFile)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+		RootCAs:      pool,
+	}, nil
+}
+
+// Guard
+// Listens on a public address and passes connections that authenticate on to an rpc server that only listens on
+// the loopback address
+type Guard struct {
+	listener net.Listener
+	logger   bslogger.Logger
+
+	Address         string // Public address connections come in on
+	InternalAddress string // Address the guarded rpc server should listen on
+}
+
+func NewGuard(s SecuritySettings, address string, logger bslogger.Logger) (*Guard, error) {
+	port, err := GetFreePort()
+	if err != nil {
+		return nil, err
+	}
+	config, err := s.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	var listener net.Listener
+	if config != nil {
+		listener, err = tls.Listen("tcp", address, config)
+	} else {
+		listener, err = net.Listen("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Guard{
+		listener:        listener,
+		logger:          logger,
+		Address:         address,
+		InternalAddress: fmt.Sprintf("127.0.0.1:%d", port),
+	}
+	go g.accept(s.Secret)
+	return g, nil
+}
+
+func (g *Guard) accept(secret string) {
+	for {
+		conn, err := g.listener.Accept()
+		if err != nil {
+			// The guard was closed
+			return
+		}
+		go func() {
+			key, err := serverHandshake(conn, secret)
+			if err != nil {
+				g.logger.Warningf("Refused connection from %s: %s", conn.RemoteAddr(), err)
+				_ = conn.Close()
+				return
+			}
+			internal, err := net.Dial("tcp", g.InternalAddress)
+			if err != nil {
+				g.logger.Errorf("Unable to reach %s: %s", g.InternalAddress, err)
+				_ = conn.Close()
+				return
+			}
+			if key == nil {
+				pipe(conn, internal)
+				return
+			}
+			if err = pipeSealed(internal, conn, key, "server", "client"); err != nil {
+				g.logger.Warningf("Dropped connection from %s: %s", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func (g *Guard) Close() error {
+	return g.listener.Close()
+}
+
+// Connector
+// Listens on the loopback address for an rpc client and carries its connections to a remote Guard
+type Connector struct {
+	listener net.Listener
+	logger   bslogger.Logger
+
+	Address       string // Address the rpc client should connect to
+	RemoteAddress string
+}
+
+func NewConnector(s SecuritySettings, remoteAddress string, logger bslogger.Logger) (*Connector, error) {
+	config, err := s.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Connector{
+		listener:      listener,
+		logger:        logger,
+		Address:       listener.Addr().String(),
+		RemoteAddress: remoteAddress,
+	}
+	go c.accept(config, s.Secret)
+	return c, nil
+}
+
+func (c *Connector) accept(config *tls.Config, secret string) {
+	for {
+		local, err := c.listener.Accept()
+		if err != nil {
+			// The connector was closed
+			return
+		}
+		go func() {
+			var remote net.Conn
+			var err error
+			dialer := &net.Dialer{Timeout: handshakeTimeout}
+			if config != nil {
+				// Certificates name the host the peer listens on
+				config := config.Clone()
+				config.ServerName, _, _ = net.SplitHostPort(c.RemoteAddress)
+				remote, err = tls.DialWithDialer(dialer, "tcp", c.RemoteAddress, config)
+			} else {
+				remote, err = dialer.Dial("tcp", c.RemoteAddress)
+			}
+			var key []byte
+			if err == nil {
+				key, err = clientHandshake(remote, secret)
+				if err != nil {
+					_ = remote.Close()
+				}
+			}
+			if err != nil {
+				c.logger.Errorf("Unable to connect to %s: %s", c.RemoteAddress, err)
+				_ = local.Close()
+				return
+			}
+			if key == nil {
+				pipe(local, remote)
+				return
+			}
+			if err = pipeSealed(local, remote, key, "client", "server"); err != nil {
+				c.logger.Warningf("Dropped connection to %s: %s", c.RemoteAddress, err)
+			}
+		}()
+	}
+}
+
+func (c *Connector) Close() error {
+	return c.listener.Close()
+}
+
+// serverHandshake
+// Finishes the TLS handshake, then sends a nonce that the client has to answer with its HMAC and answers the client's
+// own nonce so it knows it reached a peer with the same secret. Returns the key that signs the frames of the
+// connection, nil when there is no secret
+func serverHandshake(conn net.Conn, secret string) ([]byte, error) {
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer func() { _ = conn.SetDeadline(time.Time{}) }()
+
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, err
+		}
+	}
+	if secret == "" {
+		return nil, nil
+	}
+
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(nonce); err != nil {
+		return nil, err
+	}
+	answer := make([]byte, sha256.Size+nonceSize)
+	if _, err := io.ReadFull(conn, answer); err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(answer[:sha256.Size], sign(secret, "client", nonce)) {
+		return nil, errors.New("wrong secret")
+	}
+	if _, err := conn.Write(sign(secret, "server", answer[sha256.Size:])); err != nil {
+		return nil, err
+	}
+	return sessionKey(secret, nonce, answer[sha256.Size:]), nil
+}
+
+func clientHandshake(conn net.Conn, secret string) ([]byte, error) {
+	if secret == "" {
+		return nil, nil
+	}
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer func() { _ = conn.SetDeadline(time.Time{}) }()
+
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(conn, nonce); err != nil {
+		return nil, err
+	}
+	ours := make([]byte, nonceSize)
+	if _, err := rand.Read(ours); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(append(sign(secret, "client", nonce), ours...)); err != nil {
+		return nil, err
+	}
+	answer := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(conn, answer); err != nil {
+		return nil, fmt.Errorf("the peer refused our secret - %s", err)
+	}
+	if !hmac.Equal(answer, sign(secret, "server", ours)) {
+		return nil, errors.New("the peer does not know the secret")
+	}
+	return sessionKey(secret, nonce, ours), nil
+}
+
+// sessionKey
+// Both nonces go into the key so the frames of one connection cannot be replayed on another
+func sessionKey(secret string, serverNonce []byte, clientNonce []byte) []byte {
+	return sign(secret, "session", append(append([]byte{}, serverNonce...), clientNonce...))
+}
+
+// sign
+// The role is part of the message so an answer cannot be reflected back at the side that asked
+func sign(secret string, role string, nonce []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(role))
+	mac.Write(nonce)
+	return mac.Sum(nil)
+}
+
+// pipeSealed
+// Copies between the plain connection to the local rpc server or client and the sealed connection to the peer until
+// either side closes. What is sent to the peer goes in frames signed as role sending, what comes from the peer must
+// be signed as role receiving. Returns errTampered when a frame from the peer fails its HMAC
+func pipeSealed(plain net.Conn, sealed net.Conn, key []byte, sending string, receiving string) error {
+	done := make(chan error, 2)
+	go func() { done <- sealFrames(sealed, plain, key, sending) }()
+	go func() { done <- openFrames(plain, sealed, key, receiving) }()
+	err := <-done
+	_ = plain.Close()
+	_ = sealed.Close()
+	if errors.Is(err, errTampered) {
+		return err
+	}
+	return nil
+}
+
+// sealFrames
+// Frames are the payload length, the payload and the HMAC of the role, the sequence number, the length and the payload
+func sealFrames(to io.Writer, from io.Reader, key []byte, role string) error {
+	payload := make([]byte, maxFrameSize)
+	var sequence uint64
+	for {
+		n, err := from.Read(payload)
+		if n > 0 {
+			frame := make([]byte, 4, 4+n+sha256.Size)
+			binary.BigEndian.PutUint32(frame, uint32(n))
+			frame = append(frame, payload[:n]...)
+			frame = append(frame, signFrame(key, role, sequence, frame)...)
+			sequence++
+			if _, err := to.Write(frame); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func openFrames(to io.Writer, from io.Reader, key []byte, role string) error {
+	header := make([]byte, 4)
+	frame := make([]byte, 4+maxFrameSize+sha256.Size)
+	var sequence uint64
+	for {
+		if _, err := io.ReadFull(from, header); err != nil {
+			return err
+		}
+		n := int(binary.BigEndian.Uint32(header))
+		if n == 0 || n > maxFrameSize {
+			return errTampered
+		}
+		copy(frame, header)
+		if _, err := io.ReadFull(from, frame[4:4+n+sha256.Size]); err != nil {
+			return err
+		}
+		if !hmac.Equal(frame[4+n:4+n+sha256.Size], signFrame(key, role, sequence, frame[:4+n])) {
+			return errTampered
+		}
+		sequence++
+		if _, err := to.Write(frame[4 : 4+n]); err != nil {
+			return err
+		}
+	}
+}
+
+func signFrame(key []byte, role string, sequence uint64, frame []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(role))
+	_ = binary.Write(mac, binary.BigEndian, sequence)
+	mac.Write(frame)
+	return mac.Sum(nil)
+}
+
+// pipe
+// Copies between two connections until either side closes
+func pipe(a net.Conn, b net.Conn) {
+	done := make(chan struct{}, 2)
+	copyConn := func(to net.Conn, from net.Conn) {
+		_, _ = io.Copy(to, from)
+		done <- struct{}{}
+	}
+	go copyConn(a, b)
+	go copyConn(b, a)
+	<-done
+	_ = a.Close()
+	_ = b.Close()
+}
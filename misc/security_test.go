@@ -0,0 +1,159 @@
+package misc
+
+import (
+	"bytes"
+	"errors"
+	"github.com/BrugadaSyndrome/bslogger"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHandshake(t *testing.T) {
+	tests := []struct {
+		name         string
+		serverSecret string
+		clientSecret string
+		valid        bool
+	}{
+		{name: "same secret", serverSecret: "secret", clientSecret: "secret", valid: true},
+		{name: "wrong secret", serverSecret: "secret", clientSecret: "guess"},
+		{name: "no secret", serverSecret: "secret", clientSecret: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			type result struct {
+				key []byte
+				err error
+			}
+			serverDone := make(chan result, 1)
+			go func() {
+				key, err := serverHandshake(server, test.serverSecret)
+				// Closing the connection is how a refused client hears about it
+				if err != nil {
+					_ = server.Close()
+				}
+				serverDone <- result{key: key, err: err}
+			}()
+			clientKey, clientErr := clientHandshake(client, test.clientSecret)
+			if clientErr != nil || clientKey == nil {
+				_ = client.Close()
+			}
+			serverResult := <-serverDone
+			_ = server.Close()
+			_ = client.Close()
+
+			if !test.valid {
+				if serverResult.err == nil {
+					t.Error("the server accepted a client without the secret")
+				}
+				return
+			}
+			if serverResult.err != nil || clientErr != nil {
+				t.Fatalf("handshake failed: server %v, client %v", serverResult.err, clientErr)
+			}
+			if serverResult.key == nil || !bytes.Equal(serverResult.key, clientKey) {
+				t.Error("both sides did not agree on a session key")
+			}
+		})
+	}
+}
+
+func TestOpenFramesTampered(t *testing.T) {
+	key := []byte("session key")
+	var sealed bytes.Buffer
+	if err := sealFrames(&sealed, bytes.NewReader([]byte("first")), key, "client"); err != io.EOF {
+		t.Fatalf("sealFrames: %v", err)
+	}
+	first := append([]byte{}, sealed.Bytes()...)
+	sealed.Reset()
+	_ = sealFrames(&sealed, bytes.NewReader([]byte("later")), key, "client")
+	// A second stream starts its sequence over, so its first frame stands in for one that was replayed or injected
+	replayed := append(append([]byte{}, first...), sealed.Bytes()...)
+
+	flipped := append([]byte{}, first...)
+	flipped[5] ^= 1
+
+	tests := []struct {
+		name   string
+		frames []byte
+		role   string
+		want   error
+	}{
+		{name: "intact", frames: first, role: "client", want: io.EOF},
+		{name: "altered payload", frames: flipped, role: "client", want: errTampered},
+		{name: "replayed frame", frames: replayed, role: "client", want: errTampered},
+		{name: "reflected frame", frames: first, role: "server", want: errTampered},
+		{name: "oversized frame", frames: []byte{0xff, 0xff, 0xff, 0xff}, role: "client", want: errTampered},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var opened bytes.Buffer
+			err := openFrames(&opened, bytes.NewReader(test.frames), key, test.role)
+			if !errors.Is(err, test.want) {
+				t.Fatalf("openFrames returned %v, want %v", err, test.want)
+			}
+			if test.want == io.EOF && opened.String() != "first" {
+				t.Errorf("opened %q, want %q", opened.String(), "first")
+			}
+		})
+	}
+}
+
+func TestGuardSecret(t *testing.T) {
+	logger := bslogger.NewLogger("TestGuard", bslogger.Normal, nil)
+	guard, err := NewGuard(SecuritySettings{Secret: "secret"}, "127.0.0.1:0", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer guard.Close()
+	guard.Address = guard.listener.Addr().String()
+
+	// The guarded server echoes what it is sent
+	internal, err := net.Listen("tcp", guard.InternalAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer internal.Close()
+	go func() {
+		for {
+			conn, err := internal.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(conn, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+
+	echo := func(secret string) (string, error) {
+		connector, err := NewConnector(SecuritySettings{Secret: secret}, guard.Address, logger)
+		if err != nil {
+			return "", err
+		}
+		defer connector.Close()
+		conn, err := net.Dial("tcp", connector.Address)
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err = conn.Write([]byte("ping")); err != nil {
+			return "", err
+		}
+		answer := make([]byte, 4)
+		_, err = io.ReadFull(conn, answer)
+		return string(answer), err
+	}
+
+	if answer, err := echo("secret"); err != nil || answer != "ping" {
+		t.Errorf("got %q (%v) through the guard, want %q", answer, err, "ping")
+	}
+	if answer, err := echo("guess"); err == nil {
+		t.Errorf("got %q through the guard with the wrong secret", answer)
+	}
+}
@@ -0,0 +1,42 @@
+package task
+
+import (
+	"fmt"
+	"math"
+)
+
+// Coloring
+// Describes how iteration counts map onto the palette for one image. PaletteDensity is the number of iterations per
+// palette color and PaletteOffset shifts the palette by a number of colors.
+type Coloring struct {
+	PaletteDensity float64
+	PaletteOffset  float64
+}
+
+func (c *Coloring) String() string {
+	output := "{Coloring "
+	output += fmt.Sprintf("PaletteDensity: %f ", c.PaletteDensity)
+	output += fmt.Sprintf("PaletteOffset: %f}", c.PaletteOffset)
+	return output
+}
+
+// PalettePosition
+// Returns the position in the palette for the iteration count. The integer part is the palette index (before wrapping)
+// and the fractional part is used to blend with the next color when smooth coloring.
+func (c *Coloring) PalettePosition(iterations float64) float64 {
+	density := c.PaletteDensity
+	if density <= 0 {
+		density = 1
+	}
+	return iterations/density + c.PaletteOffset
+}
+
+// PaletteIndex
+// Wraps the palette position into the range [0, paletteLength)
+func (c *Coloring) PaletteIndex(iterations float64, paletteLength int) int {
+	index := int(math.Floor(c.PalettePosition(iterations))) % paletteLength
+	if index < 0 {
+		index += paletteLength
+	}
+	return index
+}
@@ -0,0 +1,232 @@
+package task
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+)
+
+const (
+	RawEncoding Encoding = iota
+	RunLengthEncoding
+)
+
+// Encoding
+// How the results of a task travel back to the coordinator. RawEncoding sends the Results as they are.
+// RunLengthEncoding stores the position of each pixel as the change from the previous pixel and the colors as runs of
+// the same color, then compresses it all with flate.
+type Encoding int
+
+func (e Encoding) String() string {
+	return []string{
+		"Raw", "RunLength",
+	}[e]
+}
+
+// EncodeResults
+// Replaces the Results of the task with their encoded form. The Results are left alone when encoding fails
+func (t *Task) EncodeResults(encoding Encoding) error {
+	if encoding == RawEncoding || t.Encoding != RawEncoding {
+		return nil
+	}
+	if encoding != RunLengthEncoding {
+		return fmt.Errorf("unknown result encoding %d", encoding)
+	}
+
+	// Pixels almost always follow on from the one before, so the positions are mostly a one followed by a zero
+	var positions []byte
+	var column, row int64
+	for _, result := range t.Results {
+		positions = binary.AppendVarint(positions, int64(result.Column)-column)
+		positions = binary.AppendVarint(positions, int64(result.Row)-row)
+		column, row = int64(result.Column), int64(result.Row)
+	}
+
+	var colors []byte
+	for i := 0; i < len(t.Results); {
+		j := i + 1
+		for j < len(t.Results) && t.Results[j].Color == t.Results[i].Color {
+			j++
+		}
+		c := t.Results[i].Color
+		colors = binary.AppendUvarint(colors, uint64(j-i))
+		colors = append(colors, c.R, c.G, c.B, c.A)
+		i = j
+	}
+
+	var iterations []byte
+	if t.KeepIterations {
+		for _, result := range t.Results {
+			iterations = binary.AppendUvarint(iterations, uint64(len(result.Iterations)))
+			for _, escape := range result.Iterations {
+				iterations = binary.LittleEndian.AppendUint64(iterations, math.Float64bits(escape))
+			}
+		}
+	}
+
+	var header []byte
+	header = binary.AppendUvarint(header, uint64(len(t.Results)))
+	header = binary.AppendUvarint(header, uint64(len(positions)))
+	header = binary.AppendUvarint(header, uint64(len(colors)))
+
+	var compressed bytes.Buffer
+	writer, err := flate.NewWriter(&compressed, flate.BestSpeed)
+	if err != nil {
+		return err
+	}
+	for _, section := range [][]byte{header, positions, colors, iterations} {
+		if _, err = writer.Write(section); err != nil {
+			return err
+		}
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	t.Encoded = compressed.Bytes()
+	t.Encoding = encoding
+	t.Results = nil
+	return nil
+}
+
+// EachResult
+// Calls f with every result of the task, decoding them one at a time when the results are encoded so they can go
+// straight into an image without building the Results. Encoded results must hold one pixel for each pixel of the task,
+// CheckResults makes sure they are the pixels of the task
+func (t *Task) EachResult(f func(Pixel)) error {
+	if t.Encoding == RawEncoding {
+		for _, result := range t.Results {
+			f(result)
+		}
+		return nil
+	}
+	if t.Encoding != RunLengthEncoding {
+		return fmt.Errorf("unknown result encoding %d", t.Encoding)
+	}
+
+	// A few bytes of flate can grow into gigabytes, so stop reading past the most the results of the task can take up
+	limit := t.maxDecodedSize()
+	data, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(t.Encoded)), limit+1))
+	if err != nil {
+		return fmt.Errorf("unable to decompress results - %s", err)
+	}
+	if int64(len(data)) > limit {
+		return errMalformedResults
+	}
+	header := bytes.NewReader(data)
+	count, err := binary.ReadUvarint(header)
+	if err != nil {
+		return errMalformedResults
+	}
+	positionsLength, err := binary.ReadUvarint(header)
+	if err != nil {
+		return errMalformedResults
+	}
+	colorsLength, err := binary.ReadUvarint(header)
+	if err != nil {
+		return errMalformedResults
+	}
+	start := uint64(len(data) - header.Len())
+	if count != uint64(len(t.Tasks)) || positionsLength+colorsLength > uint64(header.Len()) {
+		return errMalformedResults
+	}
+	positions := bytes.NewReader(data[start : start+positionsLength])
+	colors := bytes.NewReader(data[start+positionsLength : start+positionsLength+colorsLength])
+	iterations := bytes.NewReader(data[start+positionsLength+colorsLength:])
+
+	var column, row int64
+	var run uint64
+	var c color.RGBA
+	var i uint64
+	for i = 0; i < count; i++ {
+		columnChange, err := binary.ReadVarint(positions)
+		if err != nil {
+			return errMalformedResults
+		}
+		rowChange, err := binary.ReadVarint(positions)
+		if err != nil {
+			return errMalformedResults
+		}
+		column += columnChange
+		row += rowChange
+		if column < 0 || row < 0 {
+			return errMalformedResults
+		}
+
+		if run == 0 {
+			if run, err = binary.ReadUvarint(colors); err != nil || run == 0 {
+				return errMalformedResults
+			}
+			var rgba [4]byte
+			if _, err = io.ReadFull(colors, rgba[:]); err != nil {
+				return errMalformedResults
+			}
+			c = color.RGBA{R: rgba[0], G: rgba[1], B: rgba[2], A: rgba[3]}
+		}
+		run--
+
+		pixel := Pixel{
+			Color:  c,
+			Column: uint(column),
+			Row:    uint(row),
+		}
+		if t.KeepIterations {
+			samples, err := binary.ReadUvarint(iterations)
+			if err != nil || samples > uint64(iterations.Len())/8 {
+				return errMalformedResults
+			}
+			pixel.Iterations = make([]float64, samples)
+			for s := range pixel.Iterations {
+				var bits [8]byte
+				if _, err = io.ReadFull(iterations, bits[:]); err != nil {
+					return errMalformedResults
+				}
+				pixel.Iterations[s] = math.Float64frombits(binary.LittleEndian.Uint64(bits[:]))
+			}
+		}
+		f(pixel)
+	}
+	return nil
+}
+
+// maxDecodedSize
+// Returns the most bytes EncodeResults can write for the pixels of the task before compressing them: the header, two
+// position changes and a run of its own color for every pixel, and the escape times of every sample when they are kept
+func (t *Task) maxDecodedSize() int64 {
+	pixels := int64(len(t.Tasks))
+	size := 3*binary.MaxVarintLen64 + pixels*(3*binary.MaxVarintLen64+4)
+	if t.KeepIterations {
+		samples := int64(t.MaxSamples)
+		if samples < 1 {
+			samples = 1
+		}
+		size += pixels * (binary.MaxVarintLen64 + 8*samples)
+	}
+	return size
+}
+
+// DecodeResults
+// Turns encoded results back into Results
+func (t *Task) DecodeResults() error {
+	if t.Encoding == RawEncoding {
+		return nil
+	}
+	results := make([]Pixel, 0, len(t.Tasks))
+	err := t.EachResult(func(result Pixel) {
+		results = append(results, result)
+	})
+	if err != nil {
+		return err
+	}
+	t.Encoded = nil
+	t.Encoding = RawEncoding
+	t.Results = results
+	return nil
+}
+
+var errMalformedResults = errors.New("malformed encoded results")
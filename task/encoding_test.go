@@ -0,0 +1,150 @@
+package task
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+// rowTask
+// Returns a task with one pixel for each column of the row and its results, colored in runs of run pixels
+func rowTask(row uint, width uint, run uint, keepIterations bool) Task {
+	t := NewTask(1, 1)
+	t.KeepIterations = keepIterations
+	t.MaxSamples = 2
+	t.AddTasksForRow(-0.5, 0, 1, row, width)
+	for _, coordinate := range t.Tasks {
+		pixel := Pixel{
+			Color:  color.RGBA{R: uint8(coordinate.Column / run), G: 10, B: 20, A: 255},
+			Column: coordinate.Column,
+			Row:    coordinate.Row,
+		}
+		if keepIterations {
+			pixel.Iterations = []float64{float64(coordinate.Column), 0.5}
+		}
+		t.AddResult(pixel)
+	}
+	return t
+}
+
+// encodeSections
+// Compresses hand made sections the way EncodeResults does, to build results that are malformed
+func encodeSections(t *testing.T, count uint64, positions []byte, colors []byte) []byte {
+	var header []byte
+	header = binary.AppendUvarint(header, count)
+	header = binary.AppendUvarint(header, uint64(len(positions)))
+	header = binary.AppendUvarint(header, uint64(len(colors)))
+	var compressed bytes.Buffer
+	writer, err := flate.NewWriter(&compressed, flate.BestSpeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, section := range [][]byte{header, positions, colors} {
+		if _, err = writer.Write(section); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return compressed.Bytes()
+}
+
+func TestEncodeResultsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name           string
+		width          uint
+		run            uint
+		keepIterations bool
+	}{
+		{name: "one pixel", width: 1, run: 1},
+		{name: "every pixel a different color", width: 64, run: 1},
+		{name: "runs of colors", width: 100, run: 7},
+		{name: "a single run", width: 50, run: 1000},
+		{name: "iterations kept", width: 30, run: 4, keepIterations: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := rowTask(3, test.width, test.run, test.keepIterations)
+			encoded := original
+			encoded.Results = append([]Pixel{}, original.Results...)
+			if err := encoded.EncodeResults(RunLengthEncoding); err != nil {
+				t.Fatalf("EncodeResults: %s", err)
+			}
+			if encoded.Encoding != RunLengthEncoding || encoded.Results != nil || len(encoded.Encoded) == 0 {
+				t.Fatalf("results were not encoded: encoding %s, %d results, %d bytes", encoded.Encoding, len(encoded.Results), len(encoded.Encoded))
+			}
+			if err := encoded.DecodeResults(); err != nil {
+				t.Fatalf("DecodeResults: %s", err)
+			}
+			if !reflect.DeepEqual(encoded.Results, original.Results) {
+				t.Errorf("decoded results differ from the original results")
+			}
+			if err := encoded.CheckResults(); err != nil {
+				t.Errorf("CheckResults: %s", err)
+			}
+		})
+	}
+}
+
+func TestEncodeResultsRaw(t *testing.T) {
+	original := rowTask(0, 10, 2, false)
+	raw := original
+	if err := raw.EncodeResults(RawEncoding); err != nil {
+		t.Fatalf("EncodeResults: %s", err)
+	}
+	if raw.Encoding != RawEncoding || raw.Encoded != nil || !reflect.DeepEqual(raw.Results, original.Results) {
+		t.Errorf("raw encoding changed the results")
+	}
+	if err := raw.EncodeResults(Encoding(7)); err == nil {
+		t.Errorf("an unknown encoding was accepted")
+	}
+}
+
+func TestEachResultMalformed(t *testing.T) {
+	// Two pixels, (0, 0) and (1, 0), in one run of a color
+	positions := []byte{0, 0, 2, 0}
+	colors := append(binary.AppendUvarint(nil, 2), 1, 2, 3, 255)
+	run := func(length uint64) []byte { return append(binary.AppendUvarint(nil, length), 1, 2, 3, 255) }
+
+	tests := []struct {
+		name     string
+		encoding Encoding
+		encoded  []byte
+		valid    bool
+	}{
+		{name: "well formed", encoded: encodeSections(t, 2, positions, colors), valid: true},
+		{name: "not compressed", encoded: []byte{1, 2, 3}},
+		{name: "fewer results than pixels", encoded: encodeSections(t, 1, positions[:2], run(1))},
+		{name: "more results than pixels", encoded: encodeSections(t, 3, append(positions, 2, 0), run(3))},
+		{name: "positions cut short", encoded: encodeSections(t, 2, positions[:3], colors)},
+		{name: "negative position", encoded: encodeSections(t, 2, []byte{1, 0, 2, 0}, colors)},
+		{name: "empty run", encoded: encodeSections(t, 2, positions, run(0))},
+		{name: "colors cut short", encoded: encodeSections(t, 2, positions, colors[:3])},
+		{name: "runs do not cover every pixel", encoded: encodeSections(t, 2, positions, run(1))},
+		{name: "longer than the pixels can take up", encoded: encodeSections(t, 2, positions, append(colors, make([]byte, 1<<20)...))},
+		{name: "unknown encoding", encoding: Encoding(7), encoded: encodeSections(t, 2, positions, colors)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			task := rowTask(0, 2, 1, false)
+			task.Results = nil
+			task.Encoding = RunLengthEncoding
+			if test.encoding != RawEncoding {
+				task.Encoding = test.encoding
+			}
+			task.Encoded = test.encoded
+			count := 0
+			err := task.EachResult(func(Pixel) { count++ })
+			if test.valid && (err != nil || count != 2) {
+				t.Errorf("got %d results and error %v, want 2 results", count, err)
+			}
+			if !test.valid && err == nil {
+				t.Errorf("malformed results were accepted")
+			}
+		})
+	}
+}
@@ -6,9 +6,10 @@ import (
 )
 
 type Pixel struct {
-	Color  color.RGBA
-	Column uint
-	Row    uint
+	Color      color.RGBA
+	Column     uint
+	Iterations []float64 // Only set when the task asks to keep iterations
+	Row        uint
 }
 
 func (p *Pixel) String() string {
@@ -0,0 +1,63 @@
+package task
+
+import "fmt"
+
+// Statistics
+// Escape time statistics gathered by the worker while calculating a task
+type Statistics struct {
+	EscapedMax      float64 // Highest iteration count of a sample that escaped
+	EscapedSamples  uint
+	InteriorSamples uint // Samples that reached the iteration limit
+	SkippedPixels   uint // Pixels filled by subdivision without iterating
+}
+
+func (s *Statistics) String() string {
+	output := "{Statistics "
+	output += fmt.Sprintf("EscapedMax: %f ", s.EscapedMax)
+	output += fmt.Sprintf("EscapedSamples: %d ", s.EscapedSamples)
+	output += fmt.Sprintf("InteriorSamples: %d ", s.InteriorSamples)
+	output += fmt.Sprintf("SkippedPixels: %d}", s.SkippedPixels)
+	return output
+}
+
+// AddSamples
+// Records the iteration count of each sample of a pixel
+func (s *Statistics) AddSamples(iterations []float64, maxIterations uint) {
+	for _, iteration := range iterations {
+		if iteration >= float64(maxIterations) {
+			s.InteriorSamples++
+			continue
+		}
+		s.EscapedSamples++
+		if iteration > s.EscapedMax {
+			s.EscapedMax = iteration
+		}
+	}
+}
+
+// Merge
+// Combines the statistics of another task into these
+func (s *Statistics) Merge(other Statistics) {
+	if other.EscapedMax > s.EscapedMax {
+		s.EscapedMax = other.EscapedMax
+	}
+	s.EscapedSamples += other.EscapedSamples
+	s.InteriorSamples += other.InteriorSamples
+	s.SkippedPixels += other.SkippedPixels
+}
+
+// Remove
+// Takes the counts of another task back out, e.g. when its pixels are calculated again. EscapedMax cannot be taken back
+// and is left as it is
+func (s *Statistics) Remove(other Statistics) {
+	s.EscapedSamples -= minUint(s.EscapedSamples, other.EscapedSamples)
+	s.InteriorSamples -= minUint(s.InteriorSamples, other.InteriorSamples)
+	s.SkippedPixels -= minUint(s.SkippedPixels, other.SkippedPixels)
+}
+
+func minUint(a uint, b uint) uint {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -3,6 +3,7 @@ package task
 import (
 	"errors"
 	"fmt"
+	"time"
 )
 
 const (
@@ -12,21 +13,35 @@ const (
 	Grid
 )
 
+// GridSize is the number of tiles along each side of the image when generating Grid tasks
+const GridSize uint = 10
+
 type Generation int
 
 func (g Generation) String() string {
 	return []string{
-		"Row", "Column", "Image",
+		"Row", "Column", "Image", "Grid",
 	}[g]
 }
 
 type Task struct {
-	CurrentTask   uint
-	ID            uint
-	ImageNumber   uint
-	Results       []Pixel
-	Tasks         []Coordinate
-	WorkerAddress string
+	Coloring       Coloring
+	CurrentTask    uint
+	Duration       time.Duration // Time the worker spent calculating the task
+	Encoded        []byte        // Results packed with Encoding, empty when the results are sent raw
+	Encoding       Encoding
+	Height         uint // Size of the image, zero uses the size in the mandelbrot settings
+	ID             uint
+	ImageNumber    uint
+	KeepIterations bool   // Return the escape time of each sample so the image can be recolored later
+	MaxIterations  uint   // Iteration limit for this image, zero uses the limit in the mandelbrot settings
+	MaxSamples     uint   // Most samples taken of a pixel, bounds the escape times returned with KeepIterations
+	Merged         []uint // Ids of the tasks combined into this one to give a fast worker more work per call
+	Results        []Pixel
+	Statistics     Statistics
+	Tasks          []Coordinate
+	Width          uint
+	WorkerAddress  string
 }
 
 func NewTask(id uint, imageNumber uint) Task {
@@ -41,6 +56,7 @@ func (t *Task) String() string {
 	output += fmt.Sprintf("ID: %d ", t.ID)
 	output += fmt.Sprintf("Image Number: %d ", t.ImageNumber)
 	output += fmt.Sprintf("Result Count: %d ", len(t.Results))
+	output += fmt.Sprintf("Encoded Size: %d ", len(t.Encoded))
 	output += fmt.Sprintf("Task Count: %d}", len(t.Tasks))
 	return output
 }
@@ -93,10 +109,13 @@ func (t *Task) AddTasksForImage(centerX float64, centerY float64, magnification
 	}
 }
 
+// AddTasksForImageByGrid
+// Adds the pixels of one tile when the image is split into percentage x percentage tiles. gridRow and gridColumn are
+// zero based and the last tile of each row and column takes up any pixels left over by the division.
 func (t *Task) AddTasksForImageByGrid(centerX float64, centerY float64, magnification float64, imageHeight uint, imageWidth uint, percentage uint, gridRow uint, gridColumn uint) {
 	var r, c uint
-	for r = (imageHeight / percentage) * gridRow; r < imageHeight/percentage; r++ {
-		for c = (imageWidth / percentage) * gridColumn; c < imageWidth/percentage; c++ {
+	for r = imageHeight * gridRow / percentage; r < imageHeight*(gridRow+1)/percentage; r++ {
+		for c = imageWidth * gridColumn / percentage; c < imageWidth*(gridColumn+1)/percentage; c++ {
 			coordinate := Coordinate{
 				CenterX:       centerX,
 				CenterY:       centerY,
@@ -109,6 +128,138 @@ func (t *Task) AddTasksForImageByGrid(centerX float64, centerY float64, magnific
 	}
 }
 
+// AddTasksForTile
+// Adds the pixels of the rectangle with its top left corner at (tileRow, tileColumn). Used to split images that are too
+// large for a fixed number of grid tiles.
+func (t *Task) AddTasksForTile(centerX float64, centerY float64, magnification float64, tileRow uint, tileColumn uint, tileHeight uint, tileWidth uint) {
+	var r, c uint
+	for r = tileRow; r < tileRow+tileHeight; r++ {
+		for c = tileColumn; c < tileColumn+tileWidth; c++ {
+			coordinate := Coordinate{
+				CenterX:       centerX,
+				CenterY:       centerY,
+				Column:        c,
+				Magnification: magnification,
+				Row:           r,
+			}
+			t.AddTaskForPixel(coordinate)
+		}
+	}
+}
+
+// TileBounds
+// Returns the top left pixel and the size of the rectangle of pixels in this task. ok is false when the pixels do not
+// form a complete rectangle, e.g. when a task was assembled pixel by pixel.
+func (t *Task) TileBounds() (uint, uint, int, int, bool) {
+	if len(t.Tasks) == 0 {
+		return 0, 0, 0, 0, false
+	}
+	minRow, maxRow := t.Tasks[0].Row, t.Tasks[0].Row
+	minColumn, maxColumn := t.Tasks[0].Column, t.Tasks[0].Column
+	for _, coordinate := range t.Tasks {
+		if coordinate.Row < minRow {
+			minRow = coordinate.Row
+		}
+		if coordinate.Row > maxRow {
+			maxRow = coordinate.Row
+		}
+		if coordinate.Column < minColumn {
+			minColumn = coordinate.Column
+		}
+		if coordinate.Column > maxColumn {
+			maxColumn = coordinate.Column
+		}
+	}
+
+	rows := int(maxRow-minRow) + 1
+	columns := int(maxColumn-minColumn) + 1
+	if rows*columns != len(t.Tasks) {
+		return 0, 0, 0, 0, false
+	}
+	seen := make([]bool, rows*columns)
+	for _, coordinate := range t.Tasks {
+		i := int(coordinate.Row-minRow)*columns + int(coordinate.Column-minColumn)
+		if seen[i] {
+			return 0, 0, 0, 0, false
+		}
+		seen[i] = true
+	}
+	return minRow, minColumn, rows, columns, true
+}
+
+// CheckResults
+// Returns an error unless the results hold exactly one pixel for each coordinate of the task, so they can go into an
+// image without being checked again
+func (t *Task) CheckResults() error {
+	position := t.positions()
+	seen := make([]bool, len(t.Tasks))
+	count := 0
+	var problem error
+	err := t.EachResult(func(result Pixel) {
+		if problem != nil {
+			return
+		}
+		i, ok := position(result.Row, result.Column)
+		if !ok {
+			problem = fmt.Errorf("pixel (%d, %d) is not part of the task", result.Column, result.Row)
+			return
+		}
+		if seen[i] {
+			problem = fmt.Errorf("pixel (%d, %d) is in the results more than once", result.Column, result.Row)
+			return
+		}
+		seen[i] = true
+		count++
+	})
+	if err != nil {
+		return err
+	}
+	if problem != nil {
+		return problem
+	}
+	if count != len(t.Tasks) {
+		return fmt.Errorf("%d results for %d pixels", count, len(t.Tasks))
+	}
+	return nil
+}
+
+// positions
+// Returns a function numbering the pixels of the task from zero, ok is false for a pixel that is not part of the task
+func (t *Task) positions() func(row uint, column uint) (int, bool) {
+	// Tasks are almost always rectangles so their pixels can be found without a lookup table
+	if minRow, minColumn, rows, columns, ok := t.TileBounds(); ok {
+		return func(row uint, column uint) (int, bool) {
+			if row < minRow || column < minColumn || int(row-minRow) >= rows || int(column-minColumn) >= columns {
+				return 0, false
+			}
+			return int(row-minRow)*columns + int(column-minColumn), true
+		}
+	}
+
+	index := make(map[[2]uint]int, len(t.Tasks))
+	for i, coordinate := range t.Tasks {
+		index[[2]uint{coordinate.Row, coordinate.Column}] = i
+	}
+	return func(row uint, column uint) (int, bool) {
+		i, ok := index[[2]uint{row, column}]
+		return i, ok
+	}
+}
+
+// Merge
+// Adds the pixels of another task of the same image to this one. Both tasks are done once this one comes back
+func (t *Task) Merge(other Task) {
+	tasks := make([]Coordinate, 0, len(t.Tasks)+len(other.Tasks))
+	t.Tasks = append(append(tasks, t.Tasks...), other.Tasks...)
+	t.Merged = append(append(t.Merged, other.ID), other.Merged...)
+}
+
+// IDs
+// Returns the id of this task followed by the ids of the tasks merged into it
+func (t *Task) IDs() []uint {
+	return append([]uint{t.ID}, t.Merged...)
+}
+
 // GetNextTask
 // Returns the current task to be processed. Make sure to return the result to the AddResult method before calling
 // this method again
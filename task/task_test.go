@@ -0,0 +1,117 @@
+package task
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestAddTasksForImageByGridCoversImage(t *testing.T) {
+	tests := []struct {
+		name       string
+		height     uint
+		width      uint
+		percentage uint
+	}{
+		{name: "divides evenly", height: 40, width: 60, percentage: 4},
+		{name: "pixels left over", height: 37, width: 61, percentage: 4},
+		{name: "more tiles than pixels", height: 3, width: 5, percentage: 8},
+		{name: "one tile", height: 7, width: 9, percentage: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			seen := make(map[[2]uint]int)
+			var gridRow, gridColumn uint
+			for gridRow = 0; gridRow < test.percentage; gridRow++ {
+				for gridColumn = 0; gridColumn < test.percentage; gridColumn++ {
+					tile := NewTask(0, 1)
+					tile.AddTasksForImageByGrid(0, 0, 1, test.height, test.width, test.percentage, gridRow, gridColumn)
+					for _, coordinate := range tile.Tasks {
+						seen[[2]uint{coordinate.Row, coordinate.Column}]++
+					}
+					if _, _, _, _, ok := tile.TileBounds(); len(tile.Tasks) > 0 && !ok {
+						t.Errorf("tile (%d, %d) is not a rectangle", gridColumn, gridRow)
+					}
+				}
+			}
+			if len(seen) != int(test.height*test.width) {
+				t.Errorf("the tiles cover %d pixels, want %d", len(seen), test.height*test.width)
+			}
+			for pixel, count := range seen {
+				if pixel[0] >= test.height || pixel[1] >= test.width {
+					t.Errorf("pixel (%d, %d) is outside the image", pixel[1], pixel[0])
+				}
+				if count != 1 {
+					t.Errorf("pixel (%d, %d) is in %d tiles", pixel[1], pixel[0], count)
+				}
+			}
+		})
+	}
+}
+
+func TestTileBounds(t *testing.T) {
+	tests := []struct {
+		name   string
+		pixels [][2]uint // column, row
+		ok     bool
+	}{
+		{name: "empty"},
+		{name: "one pixel", pixels: [][2]uint{{3, 4}}, ok: true},
+		{name: "rectangle", pixels: [][2]uint{{1, 1}, {2, 1}, {1, 2}, {2, 2}}, ok: true},
+		{name: "corner missing", pixels: [][2]uint{{1, 1}, {2, 1}, {1, 2}}},
+		{name: "pixel twice", pixels: [][2]uint{{1, 1}, {2, 1}, {1, 2}, {1, 2}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tile := NewTask(0, 1)
+			for _, pixel := range test.pixels {
+				tile.AddTaskForPixel(Coordinate{Column: pixel[0], Row: pixel[1]})
+			}
+			if _, _, _, _, ok := tile.TileBounds(); ok != test.ok {
+				t.Errorf("TileBounds ok = %t, want %t", ok, test.ok)
+			}
+		})
+	}
+}
+
+func TestCheckResults(t *testing.T) {
+	pixel := func(column uint, row uint) Pixel {
+		return Pixel{Color: color.RGBA{A: 255}, Column: column, Row: row}
+	}
+	tests := []struct {
+		name    string
+		tasks   [][2]uint // column, row
+		results []Pixel
+		valid   bool
+	}{
+		{name: "every pixel", tasks: [][2]uint{{0, 0}, {1, 0}}, results: []Pixel{pixel(0, 0), pixel(1, 0)}, valid: true},
+		{name: "any order", tasks: [][2]uint{{0, 0}, {1, 0}}, results: []Pixel{pixel(1, 0), pixel(0, 0)}, valid: true},
+		{name: "not a rectangle", tasks: [][2]uint{{0, 0}, {5, 3}}, results: []Pixel{pixel(5, 3), pixel(0, 0)}, valid: true},
+		{name: "pixel missing", tasks: [][2]uint{{0, 0}, {1, 0}}, results: []Pixel{pixel(0, 0)}},
+		{name: "pixel twice", tasks: [][2]uint{{0, 0}, {1, 0}}, results: []Pixel{pixel(0, 0), pixel(0, 0)}},
+		{name: "pixel outside the task", tasks: [][2]uint{{0, 0}, {1, 0}}, results: []Pixel{pixel(0, 0), pixel(2, 0)}},
+		{name: "pixel outside a task that is not a rectangle", tasks: [][2]uint{{0, 0}, {5, 3}}, results: []Pixel{pixel(0, 0), pixel(5, 4)}},
+		{name: "extra pixel", tasks: [][2]uint{{0, 0}}, results: []Pixel{pixel(0, 0), pixel(1, 0)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checked := NewTask(0, 1)
+			for _, coordinate := range test.tasks {
+				checked.AddTaskForPixel(Coordinate{Column: coordinate[0], Row: coordinate[1]})
+			}
+			checked.Results = test.results
+			for _, encoding := range []Encoding{RawEncoding, RunLengthEncoding} {
+				encoded := checked
+				if err := encoded.EncodeResults(encoding); err != nil {
+					t.Fatalf("EncodeResults: %s", err)
+				}
+				err := encoded.CheckResults()
+				if test.valid && err != nil {
+					t.Errorf("%s results were refused: %s", encoding, err)
+				}
+				if !test.valid && err == nil {
+					t.Errorf("%s results were accepted", encoding)
+				}
+			}
+		})
+	}
+}
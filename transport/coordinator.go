@@ -0,0 +1,87 @@
+package transport
+
+import (
+	"DistributedMandelbrot/mandelbrot"
+	"DistributedMandelbrot/misc"
+	"DistributedMandelbrot/task"
+)
+
+// Coordinator
+// The calls a worker makes to its coordinator over its life: register, fetch the settings, fetch and return tasks, the
+// roll call heartbeat and leaving again. Operators control the workers through ControlWorkers
+type Coordinator interface {
+	Connect() error
+	ControlWorkers(request misc.ControlRequest) ([]misc.WorkerStats, error)
+	DeRegisterWorker(workerAddress string) error
+	Disconnect() error
+	GetMandelbrotSettings() (mandelbrot.Settings, error)
+	GetTasks(request misc.TaskRequest) ([]task.Task, error)
+	RegisterWorker(registration misc.Registration) (misc.RegistrationReply, error)
+	ReportBenchmark(report misc.BenchmarkReport) error
+	ReturnTasks(tasks []task.Task) error
+	RollCall() error
+}
+
+// NewCoordinator
+// Returns a Coordinator that makes its calls with the caller
+func NewCoordinator(caller Caller) Coordinator {
+	return &rpcCoordinator{caller: caller}
+}
+
+type rpcCoordinator struct {
+	caller Caller
+}
+
+func (c *rpcCoordinator) Connect() error {
+	return c.caller.Connect()
+}
+
+func (c *rpcCoordinator) ControlWorkers(request misc.ControlRequest) ([]misc.WorkerStats, error) {
+	var stats []misc.WorkerStats
+	err := c.caller.Call("Coordinator.ControlWorkers", request, &stats)
+	return stats, err
+}
+
+func (c *rpcCoordinator) DeRegisterWorker(workerAddress string) error {
+	var nothing misc.Nothing
+	return c.caller.Call("Coordinator.DeRegisterWorker", workerAddress, &nothing)
+}
+
+func (c *rpcCoordinator) Disconnect() error {
+	return c.caller.Disconnect()
+}
+
+func (c *rpcCoordinator) GetMandelbrotSettings() (mandelbrot.Settings, error) {
+	var nothing misc.Nothing
+	var settings mandelbrot.Settings
+	err := c.caller.Call("Coordinator.GetMandelbrotSettings", nothing, &settings)
+	return settings, err
+}
+
+func (c *rpcCoordinator) GetTasks(request misc.TaskRequest) ([]task.Task, error) {
+	var tasks []task.Task
+	err := c.caller.Call("Coordinator.GetTasks", request, &tasks)
+	return tasks, err
+}
+
+func (c *rpcCoordinator) RegisterWorker(registration misc.Registration) (misc.RegistrationReply, error) {
+	var reply misc.RegistrationReply
+	err := c.caller.Call("Coordinator.RegisterWorker", registration, &reply)
+	return reply, err
+}
+
+func (c *rpcCoordinator) ReportBenchmark(report misc.BenchmarkReport) error {
+	var nothing misc.Nothing
+	return c.caller.Call("Coordinator.ReportBenchmark", report, &nothing)
+}
+
+func (c *rpcCoordinator) ReturnTasks(tasks []task.Task) error {
+	var nothing misc.Nothing
+	return c.caller.Call("Coordinator.ReturnTasks", tasks, &nothing)
+}
+
+func (c *rpcCoordinator) RollCall() error {
+	var nothing misc.Nothing
+	var present bool
+	return c.caller.Call("Coordinator.RollCall", nothing, &present)
+}
@@ -0,0 +1,135 @@
+package transport
+
+import (
+	"DistributedMandelbrot/mandelbrot"
+	"DistributedMandelbrot/misc"
+	"DistributedMandelbrot/task"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// NewHTTPCoordinator
+// Returns a Coordinator that makes its calls to the JSON over HTTP server of a coordinator at url, e.g.
+// "http://192.168.1.2:52000". The secret is sent as a bearer token when it is set. The coordinator names the worker
+// when it registers and that name is used in place of the address the worker gives in later calls
+func NewHTTPCoordinator(url string, secret string) Coordinator {
+	return &httpCoordinator{
+		client: &http.Client{},
+		secret: secret,
+		url:    strings.TrimSuffix(url, "/"),
+	}
+}
+
+type httpCoordinator struct {
+	client   *http.Client
+	secret   string
+	url      string
+	workerID string
+}
+
+// call
+// Sends body as JSON and decodes the answer into reply. The server answers errors with the same messages as the rpc
+// calls so the worker can tell them apart the same way
+func (c *httpCoordinator) call(method string, path string, body interface{}, reply interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		marshaled, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(marshaled)
+	}
+	request, err := http.NewRequest(method, c.url+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if c.secret != "" {
+		request.Header.Set("Authorization", "Bearer "+c.secret)
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode >= http.StatusBadRequest {
+		message, _ := io.ReadAll(response.Body)
+		return httpStatusError{
+			Message: strings.TrimSpace(string(message)),
+			Status:  response.StatusCode,
+		}
+	}
+	if reply == nil {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(reply)
+}
+
+// httpStatusError
+// An error the coordinator answered a request with
+type httpStatusError struct {
+	Message string
+	Status  int
+}
+
+func (e httpStatusError) Error() string {
+	return e.Message
+}
+
+func (c *httpCoordinator) Connect() error {
+	return nil
+}
+
+func (c *httpCoordinator) ControlWorkers(request misc.ControlRequest) ([]misc.WorkerStats, error) {
+	var stats []misc.WorkerStats
+	err := c.call(http.MethodPost, "/v1/control", request, &stats)
+	return stats, err
+}
+
+func (c *httpCoordinator) DeRegisterWorker(workerAddress string) error {
+	return c.call(http.MethodPost, "/v1/deregister", misc.HTTPWorker{Address: c.workerID}, nil)
+}
+
+func (c *httpCoordinator) Disconnect() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+func (c *httpCoordinator) GetMandelbrotSettings() (mandelbrot.Settings, error) {
+	var settings mandelbrot.Settings
+	err := c.call(http.MethodGet, "/v1/mandelbrot", nil, &settings)
+	return settings, err
+}
+
+func (c *httpCoordinator) GetTasks(request misc.TaskRequest) ([]task.Task, error) {
+	var tasks []task.Task
+	request.Address = c.workerID
+	err := c.call(http.MethodPost, "/v1/tasks", request, &tasks)
+	return tasks, err
+}
+
+func (c *httpCoordinator) RegisterWorker(registration misc.Registration) (misc.RegistrationReply, error) {
+	var reply misc.HTTPRegistrationReply
+	err := c.call(http.MethodPost, "/v1/register", registration, &reply)
+	c.workerID = reply.WorkerID
+	return reply.RegistrationReply, err
+}
+
+func (c *httpCoordinator) ReportBenchmark(report misc.BenchmarkReport) error {
+	report.Address = c.workerID
+	return c.call(http.MethodPost, "/v1/benchmark", report, nil)
+}
+
+func (c *httpCoordinator) ReturnTasks(tasks []task.Task) error {
+	return c.call(http.MethodPost, "/v1/results", misc.HTTPResults{Address: c.workerID, Tasks: tasks}, nil)
+}
+
+func (c *httpCoordinator) RollCall() error {
+	return c.call(http.MethodPost, "/v1/rollcall", misc.HTTPWorker{Address: c.workerID}, nil)
+}
@@ -0,0 +1,158 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"sync"
+)
+
+// Memory
+// Calls between a coordinator and workers in the same process. Each connection is an in-memory pipe carrying net/rpc,
+// so arguments and replies are encoded with gob just like over TCP and neither side can change what the other holds.
+// Addresses are names within one Memory, any string not used by another server will do.
+type Memory struct {
+	addressCount int
+	mutex        sync.Mutex
+	servers      map[string]*memoryServer
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		servers: make(map[string]*memoryServer),
+	}
+}
+
+func (m *Memory) NewAddress() (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.addressCount++
+	return fmt.Sprintf("memory-%d", m.addressCount), nil
+}
+
+func (m *Memory) NewCaller(address string, name string) Caller {
+	return &memoryCaller{
+		address: address,
+		name:    name,
+		network: m,
+	}
+}
+
+func (m *Memory) NewServer(object interface{}, address string, name string) Server {
+	return &memoryServer{
+		address: address,
+		name:    name,
+		network: m,
+		object:  object,
+		wait:    &sync.WaitGroup{},
+	}
+}
+
+type memoryServer struct {
+	address     string
+	connections []net.Conn
+	mutex       sync.Mutex
+	name        string
+	network     *Memory
+	object      interface{}
+	rpcServer   *rpc.Server
+	running     bool
+	wait        *sync.WaitGroup
+}
+
+func (s *memoryServer) Run() error {
+	s.rpcServer = rpc.NewServer()
+	if err := s.rpcServer.Register(s.object); err != nil {
+		return err
+	}
+
+	s.network.mutex.Lock()
+	defer s.network.mutex.Unlock()
+	if _, ok := s.network.servers[s.address]; ok {
+		return fmt.Errorf("memory address %s is already in use", s.address)
+	}
+	s.network.servers[s.address] = s
+	s.running = true
+	s.wait.Add(1)
+	return nil
+}
+
+func (s *memoryServer) Stop() error {
+	s.network.mutex.Lock()
+	delete(s.network.servers, s.address)
+	s.network.mutex.Unlock()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.running {
+		return errors.New("server is not running")
+	}
+	s.running = false
+	for _, connection := range s.connections {
+		_ = connection.Close()
+	}
+	s.connections = nil
+	s.wait.Done()
+	return nil
+}
+
+func (s *memoryServer) Wait() {
+	s.wait.Wait()
+}
+
+// connect
+// Returns the client end of a new pipe to the server
+func (s *memoryServer) connect() (net.Conn, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.running {
+		return nil, fmt.Errorf("no server is listening on memory address %s", s.address)
+	}
+	serverEnd, clientEnd := net.Pipe()
+	s.connections = append(s.connections, serverEnd)
+	go s.rpcServer.ServeConn(serverEnd)
+	return clientEnd, nil
+}
+
+type memoryCaller struct {
+	address string
+	client  *rpc.Client
+	name    string
+	network *Memory
+}
+
+func (c *memoryCaller) Call(serviceMethod string, args interface{}, reply interface{}) error {
+	if c.client == nil {
+		return fmt.Errorf("not connected to memory address %s", c.address)
+	}
+	return c.client.Call(serviceMethod, args, reply)
+}
+
+func (c *memoryCaller) Connect() error {
+	c.network.mutex.Lock()
+	server, ok := c.network.servers[c.address]
+	c.network.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("no server is listening on memory address %s", c.address)
+	}
+	connection, err := server.connect()
+	if err != nil {
+		return err
+	}
+	c.client = rpc.NewClient(connection)
+	return nil
+}
+
+func (c *memoryCaller) Disconnect() error {
+	if c.client == nil {
+		return nil
+	}
+	err := c.client.Close()
+	c.client = nil
+	return err
+}
+
+func (c *memoryCaller) Name() string {
+	return c.name
+}
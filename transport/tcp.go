@@ -0,0 +1,29 @@
+package transport
+
+import (
+	"DistributedMandelbrot/misc"
+	"fmt"
+	"github.com/BrugadaSyndrome/multirpc"
+)
+
+// TCP
+// Calls over TCP sockets using multirpc
+type TCP struct{}
+
+func (TCP) NewAddress() (string, error) {
+	port, err := misc.GetFreePort()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%d", misc.GetLocalAddress(), port), nil
+}
+
+func (TCP) NewCaller(address string, name string) Caller {
+	client := multirpc.NewTcpClient(address, name)
+	return &client
+}
+
+func (TCP) NewServer(object interface{}, address string, name string) Server {
+	server := multirpc.NewTcpServer(object, address, name)
+	return &server
+}
@@ -0,0 +1,40 @@
+package transport
+
+import (
+	"errors"
+	"net/rpc"
+)
+
+// Caller
+// Makes calls in the net/rpc style, i.e. "Type.Method" with an argument and a pointer to the reply
+type Caller interface {
+	Call(serviceMethod string, args interface{}, reply interface{}) error
+	Connect() error
+	Disconnect() error
+	Name() string
+}
+
+// Server
+// Serves the exported methods of an object to Callers
+type Server interface {
+	Run() error
+	Stop() error
+	Wait()
+}
+
+// Transport
+// Carries the calls between the coordinator and its workers. TCP is used between machines and Memory lets a
+// coordinator and its workers run in one process
+type Transport interface {
+	NewAddress() (string, error) // Returns an address a new worker can listen on
+	NewCaller(address string, name string) Caller
+	NewServer(object interface{}, address string, name string) Server
+}
+
+// IsRemote
+// Returns true when the other side of a call answered with err, as opposed to err coming from failing to reach it
+func IsRemote(err error) bool {
+	var serverError rpc.ServerError
+	var statusError httpStatusError
+	return errors.As(err, &serverError) || errors.As(err, &statusError)
+}
@@ -0,0 +1,72 @@
+package transport
+
+import "DistributedMandelbrot/misc"
+
+// Worker
+// The calls a coordinator makes to a worker. The name is the address the worker registered with. Besides roll call
+// they are made on behalf of an operator and reply with the stats of the worker
+type Worker interface {
+	Connect() error
+	Disconnect() error
+	Drain() (misc.WorkerStats, error)
+	Name() string
+	Pause() (misc.WorkerStats, error)
+	Resume() (misc.WorkerStats, error)
+	RollCall() error
+	SetConcurrency(concurrency uint) (misc.WorkerStats, error)
+	Stats() (misc.WorkerStats, error)
+}
+
+// NewWorker
+// Returns a Worker that makes its calls with the caller
+func NewWorker(caller Caller) Worker {
+	return &rpcWorker{caller: caller}
+}
+
+type rpcWorker struct {
+	caller Caller
+}
+
+func (w *rpcWorker) Connect() error {
+	return w.caller.Connect()
+}
+
+func (w *rpcWorker) Disconnect() error {
+	return w.caller.Disconnect()
+}
+
+func (w *rpcWorker) Drain() (misc.WorkerStats, error) {
+	return w.control("Worker.Drain", misc.Nothing{})
+}
+
+func (w *rpcWorker) Name() string {
+	return w.caller.Name()
+}
+
+func (w *rpcWorker) Pause() (misc.WorkerStats, error) {
+	return w.control("Worker.Pause", misc.Nothing{})
+}
+
+func (w *rpcWorker) Resume() (misc.WorkerStats, error) {
+	return w.control("Worker.Resume", misc.Nothing{})
+}
+
+func (w *rpcWorker) RollCall() error {
+	var nothing misc.Nothing
+	var present bool
+	return w.caller.Call("Worker.RollCall", nothing, &present)
+}
+
+func (w *rpcWorker) SetConcurrency(concurrency uint) (misc.WorkerStats, error) {
+	return w.control("Worker.SetConcurrency", concurrency)
+}
+
+func (w *rpcWorker) Stats() (misc.WorkerStats, error) {
+	return w.control("Worker.Stats", misc.Nothing{})
+}
+
+func (w *rpcWorker) control(serviceMethod string, args interface{}) (misc.WorkerStats, error) {
+	var stats misc.WorkerStats
+	err := w.caller.Call(serviceMethod, args, &stats)
+	return stats, err
+}
@@ -0,0 +1,42 @@
+//go:build js && wasm
+
+// The worker for browsers. worker.js runs it in a Web Worker where it reaches the coordinator over HTTP. It reads its
+// settings from the mandelbrotWorker object and hands its progress to mandelbrotWorker.report
+package main
+
+import (
+	"DistributedMandelbrot/transport"
+	"DistributedMandelbrot/worker"
+	"syscall/js"
+)
+
+func main() {
+	config := js.Global().Get("mandelbrotWorker")
+	name := "browser"
+	if config.Get("name").Truthy() {
+		name = config.Get("name").String()
+	}
+	secret := ""
+	if config.Get("secret").Truthy() {
+		secret = config.Get("secret").String()
+	}
+	report := func(status string, tasksCompleted int) {
+		if config.Get("report").Type() == js.TypeFunction {
+			config.Call("report", map[string]interface{}{
+				"status":         status,
+				"tasksCompleted": tasksCompleted,
+			})
+		}
+	}
+
+	coordinator := transport.NewHTTPCoordinator(config.Get("coordinatorURL").String(), secret)
+	completed := 0
+	report("joining", completed)
+	w := worker.NewWorkerWithCoordinator(name, coordinator, func(tasksCompleted int) {
+		completed = tasksCompleted
+		report("working", completed)
+	})
+	report("working", completed)
+	w.Wait()
+	report("done", completed)
+}
@@ -0,0 +1,23 @@
+// Runs the browser worker in a Web Worker so the calculations do not hold up the page. The page posts the settings
+// and gets a message with the status and the number of tasks completed whenever they change.
+importScripts("wasm_exec.js");
+
+self.onmessage = async (event) => {
+    self.mandelbrotWorker = {
+        coordinatorURL: event.data.coordinatorURL,
+        name: event.data.name,
+        secret: event.data.secret,
+        report: (progress) => self.postMessage(progress),
+    };
+
+    const go = new Go();
+    try {
+        const result = await WebAssembly.instantiateStreaming(fetch("worker.wasm"), go.importObject);
+        await go.run(result.instance);
+        self.postMessage({status: "stopped"});
+    } catch (err) {
+        self.postMessage({status: "failed: " + err});
+    }
+    // Timers the Go runtime left behind would fire into a program that has exited
+    self.close();
+};
@@ -0,0 +1,175 @@
+package worker
+
+import (
+	"DistributedMandelbrot/misc"
+	"DistributedMandelbrot/transport"
+	"fmt"
+	"github.com/BrugadaSyndrome/bslogger"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// control
+// Gates the tasks the worker calculates. A paused worker finishes the tasks it is calculating but starts no new ones,
+// and no more than concurrency tasks are calculated at once
+type control struct {
+	cond        *sync.Cond
+	concurrency uint
+	current     map[uint]bool // Ids of the tasks being calculated
+	paused      bool
+	stopped     bool // Set on shutdown, nothing is started from then on
+}
+
+func newControl(concurrency uint) *control {
+	return &control{
+		cond:        sync.NewCond(&sync.Mutex{}),
+		concurrency: concurrency,
+		current:     make(map[uint]bool),
+	}
+}
+
+// acquire
+// Waits until the task may be calculated. Returns false when the worker is shut down in the meantime
+func (c *control) acquire(id uint) bool {
+	c.cond.L.Lock()
+	defer c.cond.L.Unlock()
+	for !c.stopped && (c.paused || uint(len(c.current)) >= c.concurrency) {
+		c.cond.Wait()
+	}
+	if c.stopped {
+		return false
+	}
+	c.current[id] = true
+	return true
+}
+
+func (c *control) release(id uint) {
+	c.cond.L.Lock()
+	delete(c.current, id)
+	c.cond.Broadcast()
+	c.cond.L.Unlock()
+}
+
+func (c *control) stop() {
+	c.cond.L.Lock()
+	c.stopped = true
+	c.cond.Broadcast()
+	c.cond.L.Unlock()
+}
+
+func (c *control) setPaused(paused bool) {
+	c.cond.L.Lock()
+	c.paused = paused
+	c.cond.Broadcast()
+	c.cond.L.Unlock()
+}
+
+func (c *control) setConcurrency(concurrency uint) {
+	c.cond.L.Lock()
+	c.concurrency = concurrency
+	c.cond.Broadcast()
+	c.cond.L.Unlock()
+}
+
+// fill
+// Adds the state of the control to the stats
+func (c *control) fill(stats *misc.WorkerStats) {
+	c.cond.L.Lock()
+	defer c.cond.L.Unlock()
+	stats.Concurrency = c.concurrency
+	stats.Paused = c.paused
+	stats.CurrentTasks = make([]uint, 0, len(c.current))
+	for id := range c.current {
+		stats.CurrentTasks = append(stats.CurrentTasks, id)
+	}
+	sort.Slice(stats.CurrentTasks, func(i, j int) bool { return stats.CurrentTasks[i] < stats.CurrentTasks[j] })
+}
+
+func (w *Worker) stats() misc.WorkerStats {
+	stats := misc.WorkerStats{
+		Address:        w.myAddress,
+		CPUs:           runtime.NumCPU(),
+		CPUSeconds:     cpuSeconds(),
+		Draining:       w.shuttingDown(),
+		TasksCompleted: int(w.tasksCompleted.Load()),
+		Uptime:         time.Since(w.started),
+	}
+	w.control.fill(&stats)
+	return stats
+}
+
+// Pause
+// Lets the tasks being calculated finish but starts no new ones until the worker is resumed
+func (w *Worker) Pause(nothing misc.Nothing, stats *misc.WorkerStats) error {
+	w.logger.Info("Paused by the coordinator")
+	w.control.setPaused(true)
+	w.journal.Record(misc.Event{Kind: misc.WorkerPaused, Worker: w.myAddress})
+	*stats = w.stats()
+	return nil
+}
+
+func (w *Worker) Resume(nothing misc.Nothing, stats *misc.WorkerStats) error {
+	w.logger.Info("Resumed by the coordinator")
+	w.control.setPaused(false)
+	w.journal.Record(misc.Event{Kind: misc.WorkerResumed, Worker: w.myAddress})
+	*stats = w.stats()
+	return nil
+}
+
+// Drain
+// Shuts the worker down as if it was interrupted, the tasks it fetched ahead go to other workers
+func (w *Worker) Drain(nothing misc.Nothing, stats *misc.WorkerStats) error {
+	w.logger.Info("Drained by the coordinator")
+	w.Shutdown()
+	*stats = w.stats()
+	return nil
+}
+
+// SetConcurrency
+// Changes the number of tasks calculated at once
+func (w *Worker) SetConcurrency(concurrency uint, stats *misc.WorkerStats) error {
+	if concurrency == 0 {
+		return fmt.Errorf("a worker calculates at least one task at once, use pause to stop it")
+	}
+	w.logger.Infof("Calculating %d tasks at once", concurrency)
+	w.control.setConcurrency(concurrency)
+	*stats = w.stats()
+	return nil
+}
+
+func (w *Worker) Stats(nothing misc.Nothing, stats *misc.WorkerStats) error {
+	*stats = w.stats()
+	return nil
+}
+
+// ControlWorkers
+// Sends the request to the coordinator named in the worker settings file, or the one discovery finds, and returns the
+// stats of the workers the request was for
+func ControlWorkers(settingsFile string, request misc.ControlRequest) ([]misc.WorkerStats, error) {
+	s := NewSettings(settingsFile)
+	w := Worker{
+		logger:           bslogger.NewLogger("Control", bslogger.Normal, nil),
+		securitySettings: s.SecuritySettings,
+		transport:        transport.TCP{},
+	}
+
+	address := s.CoordinatorAddress
+	if address == "" {
+		beacon, err := misc.Discover(s.DiscoveryGroup, s.RunName, discoveryTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find the coordinator - %s", err)
+		}
+		address = beacon.Address
+	}
+	if err := w.useCoordinator(address); err != nil {
+		return nil, err
+	}
+	defer w.stop()
+	if err := w.coordinator.Connect(); err != nil {
+		return nil, err
+	}
+	defer func() { misc.CheckError(w.coordinator.Disconnect(), w.logger, misc.Debug) }()
+	return w.coordinator.ControlWorkers(request)
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package worker
+
+// cpuSeconds
+// The CPU time of the process is not measured on this platform
+func cpuSeconds() float64 {
+	return 0
+}
@@ -0,0 +1,57 @@
+package worker
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Longest wait in seconds between attempts to reach the coordinator when the settings do not say
+const defaultMaxBackoff = 30
+
+const (
+	ranOutOfTasks sessionEnd = iota
+	lostCoordinator
+	quarantined
+	coordinatorShutDown
+	shutDown
+)
+
+// sessionEnd
+// Why the worker stopped processing the tasks of the coordinator it joined
+type sessionEnd int
+
+func (e sessionEnd) String() string {
+	return []string{
+		"Ran out of tasks", "Lost coordinator", "Quarantined", "Coordinator shut down", "Shut down",
+	}[e]
+}
+
+// backoff
+// Doubles the wait between attempts from a second up to max. Each wait is cut by a random amount of up to half so
+// workers that lost the coordinator together do not all come back at the same moment
+type backoff struct {
+	delay time.Duration
+	max   time.Duration
+}
+
+func newBackoff(max time.Duration) backoff {
+	return backoff{
+		delay: time.Second,
+		max:   max,
+	}
+}
+
+// next
+// Returns the time to wait before the next attempt
+func (b *backoff) next() time.Duration {
+	wait := b.delay - time.Duration(rand.Int63n(int64(b.delay/2)+1))
+	b.delay *= 2
+	if b.delay > b.max {
+		b.delay = b.max
+	}
+	return wait.Round(time.Millisecond)
+}
+
+func (b *backoff) reset() {
+	b.delay = time.Second
+}
@@ -7,10 +7,33 @@ import (
 	"github.com/BrugadaSyndrome/bslogger"
 )
 
+// settings
+// Concurrency is the number of tasks calculated at once, the coordinator can change it while the worker runs.
+// FetchBatch is the number of tasks asked for in one call to the coordinator and ReturnBatch the number of finished
+// tasks sent back in one call. PrefetchTasks is the number of tasks kept waiting so the next task is already at hand
+// when one is finished, fetching and returning run alongside the calculations.
+//
+// A worker that cannot reach the coordinator keeps trying, doubling the wait between attempts up to MaxBackoff seconds.
+// With StayAlive it waits for the next job once the coordinator runs out of tasks instead of shutting down.
+//
+// Without a CoordinatorAddress the worker listens on the multicast DiscoveryGroup for a coordinator announcing RunName,
+// or any run when RunName is empty, and looks again each time it joins.
+//
+// With a JournalFile the worker appends what it does to it as JSON lines, the workers of a process share the file.
 type settings struct {
 	logger bslogger.Logger
 
+	Concurrency        uint
 	CoordinatorAddress string
+	DiscoveryGroup     string
+	FetchBatch         uint
+	JournalFile        string
+	MaxBackoff         uint
+	PrefetchTasks      uint
+	ReturnBatch        uint
+	RunName            string
+	SecuritySettings   misc.SecuritySettings
+	StayAlive          bool
 }
 
 func NewSettings(settingsFile string) settings {
@@ -27,13 +50,37 @@ func NewSettings(settingsFile string) settings {
 
 func (s *settings) String() string {
 	output := "\nWorker settings\n"
+	output += fmt.Sprintf("Concurrency: %d\n", s.Concurrency)
 	output += fmt.Sprintf("Coordinator Address: %s\n", s.CoordinatorAddress)
+	output += fmt.Sprintf("Discovery Group: %s\n", s.DiscoveryGroup)
+	output += fmt.Sprintf("Fetch Batch: %d\n", s.FetchBatch)
+	output += fmt.Sprintf("Journal File: %s\n", s.JournalFile)
+	output += fmt.Sprintf("Max Backoff: %d\n", s.MaxBackoff)
+	output += fmt.Sprintf("Prefetch Tasks: %d\n", s.PrefetchTasks)
+	output += fmt.Sprintf("Return Batch: %d\n", s.ReturnBatch)
+	output += fmt.Sprintf("Run Name: %s\n", s.RunName)
+	output += fmt.Sprintf("Stay Alive: %t\n", s.StayAlive)
 	return output
 }
 
 func (s *settings) Verify() error {
-	if s.CoordinatorAddress == "" {
-		s.CoordinatorAddress = fmt.Sprintf("%s:%s", misc.GetLocalAddress(), "51000")
+	if s.Concurrency == 0 {
+		s.Concurrency = 1
 	}
-	return nil
+	if s.DiscoveryGroup == "" {
+		s.DiscoveryGroup = misc.DefaultDiscoveryGroup
+	}
+	if s.FetchBatch == 0 {
+		s.FetchBatch = 1
+	}
+	if s.MaxBackoff == 0 {
+		s.MaxBackoff = defaultMaxBackoff
+	}
+	if s.PrefetchTasks == 0 {
+		s.PrefetchTasks = s.FetchBatch
+	}
+	if s.ReturnBatch == 0 {
+		s.ReturnBatch = 1
+	}
+	return s.SecuritySettings.Verify()
 }
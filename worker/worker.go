@@ -4,101 +4,590 @@ import (
 	"DistributedMandelbrot/mandelbrot"
 	"DistributedMandelbrot/misc"
 	"DistributedMandelbrot/task"
+	"DistributedMandelbrot/transport"
+	"errors"
 	"fmt"
 	"github.com/BrugadaSyndrome/bslogger"
-	"github.com/BrugadaSyndrome/multirpc"
+	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Time spent benchmarking when joining the coordinator
+const benchmarkDuration = 500 * time.Millisecond
+
+// Time spent listening for announcements before saying the worker is still looking
+const discoveryTimeout = 10 * time.Second
+
 type Worker struct {
+	connector          *misc.Connector // Carries calls to the coordinator when the connections are secured
+	control            *control        // Pauses the worker and limits the tasks calculated at once
+	coordinator        transport.Coordinator
 	coordinatorAddress string
+	discover           bool // Look for the coordinator on the local network before joining it
+	discoveryGroup     string
+	encoding           task.Encoding
+	fetchBatch         uint
+	guard              *misc.Guard   // Lets in a coordinator that authenticates when the connections are secured
+	journal            *misc.Journal // Records what the worker does when JournalFile is set, nil otherwise
 	logger             bslogger.Logger
 	mandelbrot         mandelbrot.Mandelbrot
+	maxBackoff         time.Duration // Longest wait between attempts to reach the coordinator
 	myAddress          string
-	tasksCompleted     int
+	prefetchTasks      uint
+	progress           func(tasksCompleted int) // Called after tasks are returned, may be nil
+	returnBatch        uint
+	routines           *sync.WaitGroup // The tickers and the task processing
+	runName            string          // Only join a discovered coordinator running this run, any when empty
+	securitySettings   misc.SecuritySettings
+	shutdown           chan struct{} // Closed when the worker is asked to shut down
+	shutdownOnce       *sync.Once
+	started            time.Time
+	stayAlive          bool          // Wait for the next job once the coordinator runs out of tasks
+	tasksCompleted     *atomic.Int64 // Read by the tickers and the control server while tasks are returned
+	transport          transport.Transport
+
+	Server transport.Server // Nil when the coordinator cannot call the worker back
+}
+
+func NewWorker(settingsFile string) *Worker {
+	return newWorker(NewSettings(settingsFile), transport.TCP{})
+}
+
+// NewWorkerWithTransport
+// Starts a worker with the default settings that reaches the coordinator at coordinatorAddress over the transport,
+// e.g. a coordinator in the same process
+func NewWorkerWithTransport(coordinatorAddress string, t transport.Transport) *Worker {
+	s := settings{
+		logger:             bslogger.NewLogger("WorkerSettings", bslogger.Normal, nil),
+		CoordinatorAddress: coordinatorAddress,
+	}
+	return newWorker(s, t)
+}
 
-	ServerClient multirpc.TcpServerClient
+// NewWorkerWithCoordinator
+// Starts a worker that makes its calls through the coordinator, e.g. one from transport.NewHTTPCoordinator in a
+// browser. It runs no rpc server so the coordinator cannot call it back. progress is called with the number of tasks
+// completed each time tasks are returned
+func NewWorkerWithCoordinator(name string, coordinator transport.Coordinator, progress func(tasksCompleted int)) *Worker {
+	worker := &Worker{
+		control:     newControl(1),
+		coordinator: coordinator,
+		fetchBatch:  1,
+		logger:      bslogger.NewLogger(fmt.Sprintf("Worker %s", name), bslogger.Normal, nil),
+		maxBackoff:  defaultMaxBackoff * time.Second,
+		myAddress:   name,
+		// Fetch the next task while calculating so a slow connection does not leave the worker waiting
+		prefetchTasks:  2,
+		progress:       progress,
+		returnBatch:    1,
+		routines:       &sync.WaitGroup{},
+		shutdown:       make(chan struct{}),
+		shutdownOnce:   &sync.Once{},
+		started:        time.Now(),
+		tasksCompleted: &atomic.Int64{},
+	}
+	worker.start()
+	return worker
 }
 
-func NewWorker(settingsFile string) Worker {
-	settings := NewSettings(settingsFile)
-	worker := Worker{
-		coordinatorAddress: settings.CoordinatorAddress,
-		logger:             bslogger.NewLogger("Worker", bslogger.Normal, nil),
+func newWorker(settings settings, t transport.Transport) *Worker {
+	logger := bslogger.NewLogger("Worker", bslogger.Normal, nil)
+	misc.CheckError(settings.Verify(), logger, misc.Fatal)
+	worker := &Worker{
+		control:          newControl(settings.Concurrency),
+		discover:         settings.CoordinatorAddress == "",
+		discoveryGroup:   settings.DiscoveryGroup,
+		fetchBatch:       settings.FetchBatch,
+		logger:           logger,
+		maxBackoff:       time.Duration(settings.MaxBackoff) * time.Second,
+		prefetchTasks:    settings.PrefetchTasks,
+		returnBatch:      settings.ReturnBatch,
+		routines:         &sync.WaitGroup{},
+		runName:          settings.RunName,
+		securitySettings: settings.SecuritySettings,
+		shutdown:         make(chan struct{}),
+		shutdownOnce:     &sync.Once{},
+		started:          time.Now(),
+		stayAlive:        settings.StayAlive,
+		tasksCompleted:   &atomic.Int64{},
+		transport:        t,
 	}
-	misc.CheckError(settings.Verify(), worker.logger, misc.Fatal)
 
-	// Find a free port to use for this worker
-	port, err := misc.GetFreePort()
+	// Find a free address to use for this worker
+	var err error
+	worker.myAddress, err = t.NewAddress()
 	misc.CheckError(err, worker.logger, misc.Fatal)
-	worker.logger.Debugf("Found free port: %d", port)
-	worker.myAddress = fmt.Sprintf("%s:%d", misc.GetLocalAddress(), port)
+	worker.logger.Debugf("Found free address: %s", worker.myAddress)
 	worker.logger = bslogger.NewLogger(fmt.Sprintf("Worker %s", worker.myAddress), bslogger.Normal, nil)
-	worker.ServerClient = multirpc.NewTcpServerClient(&worker, worker.myAddress, worker.myAddress, settings.CoordinatorAddress, settings.CoordinatorAddress)
-	misc.CheckError(worker.ServerClient.Server.Run(), worker.logger, misc.Fatal)
+	if settings.JournalFile != "" {
+		worker.journal, err = misc.NewJournal(settings.JournalFile, worker.myAddress, true, worker.logger)
+		misc.CheckError(err, worker.logger, misc.Warning)
+	}
 
-	// Register with the coordinator
-	misc.CheckError(worker.ServerClient.Client.Connect(), worker.logger, misc.Fatal)
-	var nothing misc.Nothing
-	misc.CheckError(worker.ServerClient.Client.Call("Coordinator.RegisterWorker", worker.myAddress, &nothing), worker.logger, misc.Fatal)
+	// Secured connections go through a guard for calls coming in and a connector for calls going out, the rpc server
+	// and client only see the loopback address. Connections within the process are not secured
+	serverAddress := worker.myAddress
+	if worker.secured() {
+		worker.guard, err = misc.NewGuard(settings.SecuritySettings, worker.myAddress, worker.logger)
+		misc.CheckError(err, worker.logger, misc.Fatal)
+		serverAddress = worker.guard.InternalAddress
+	}
+	worker.Server = t.NewServer(worker, serverAddress, worker.myAddress)
+	misc.CheckError(worker.Server.Run(), worker.logger, misc.Fatal)
+	if !worker.discover {
+		misc.CheckError(worker.useCoordinator(settings.CoordinatorAddress), worker.logger, misc.Fatal)
+	}
+	worker.start()
 
-	// Get Mandelbrot settings from the coordinator
-	var mandelbrotSettings mandelbrot.Settings
-	misc.CheckError(worker.ServerClient.Client.Call("Coordinator.GetMandelbrotSettings", nothing, &mandelbrotSettings), worker.logger, misc.Fatal)
-	worker.mandelbrot = mandelbrot.NewMandelbrot(mandelbrotSettings)
+	return worker
+}
 
-	go worker.tickers()
-	go worker.processTasks()
+// secured
+// Connections within the process are not secured
+func (w *Worker) secured() bool {
+	_, tcp := w.transport.(transport.TCP)
+	return tcp && w.securitySettings.Enabled()
+}
 
-	return worker
+// useCoordinator
+// Points the calls of the worker at the coordinator at address, through a connector when the connections are secured
+func (w *Worker) useCoordinator(address string) error {
+	if w.connector != nil {
+		misc.CheckError(w.connector.Close(), w.logger, misc.Warning)
+		w.connector = nil
+	}
+	clientAddress := address
+	if w.secured() {
+		connector, err := misc.NewConnector(w.securitySettings, address, w.logger)
+		if err != nil {
+			return err
+		}
+		w.connector = connector
+		clientAddress = connector.Address
+	}
+	w.coordinatorAddress = address
+	w.coordinator = transport.NewCoordinator(w.transport.NewCaller(clientAddress, address))
+	return nil
+}
+
+// discoverCoordinator
+// Listens for the announcements of coordinators on the local network until one running the right run turns up, then
+// points the worker at it. Returns false when the worker is shut down first
+func (w *Worker) discoverCoordinator() bool {
+	wait := newBackoff(w.maxBackoff)
+	for !w.shuttingDown() {
+		w.logger.Infof("Looking for the coordinator of %s on %s", w.describeRun(), w.discoveryGroup)
+		beacon, err := misc.Discover(w.discoveryGroup, w.runName, discoveryTimeout)
+		if err == nil {
+			if beacon.Address != w.coordinatorAddress {
+				w.logger.Infof("Found the coordinator of run %s at %s", beacon.RunName, beacon.Address)
+				err = w.useCoordinator(beacon.Address)
+			}
+			if err == nil {
+				return true
+			}
+		}
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			continue
+		}
+		delay := wait.next()
+		w.logger.Warningf("Unable to look for the coordinator, trying again in %s: %s", delay, err)
+		w.sleep(delay)
+	}
+	return false
+}
+
+func (w *Worker) describeRun() string {
+	if w.runName == "" {
+		return "any run"
+	}
+	return "run " + w.runName
+}
+
+// start
+// Joins the coordinator and processes its tasks in the background
+func (w *Worker) start() {
+	w.routines.Add(1)
+	go func() {
+		w.run()
+		w.routines.Done()
+	}()
 }
 
-func (w *Worker) tickers() {
+// run
+// Works for the coordinator until it runs out of tasks, joining it again whenever the connection is lost or the
+// coordinator shut down. With StayAlive the worker then waits for the coordinator of the next job instead of shutting
+// down
+func (w *Worker) run() {
+	idle := newBackoff(w.maxBackoff)
+	for {
+		if w.discover && !w.discoverCoordinator() {
+			break
+		}
+		err := w.join()
+		if w.shuttingDown() {
+			break
+		}
+		if err == nil {
+			w.journal.Record(misc.Event{Coordinator: w.coordinatorAddress, Kind: misc.WorkerJoined, Worker: w.myAddress})
+			completed := w.tasksCompleted.Load()
+			end := w.processTasks()
+			w.journal.Record(misc.Event{Coordinator: w.coordinatorAddress, Kind: misc.WorkerLeft, Reason: end.String(), Worker: w.myAddress})
+			if end != lostCoordinator {
+				misc.CheckError(w.coordinator.DeRegisterWorker(w.myAddress), w.logger, misc.Warning)
+			}
+			misc.CheckError(w.coordinator.Disconnect(), w.logger, misc.Debug)
+			if end == lostCoordinator {
+				w.logger.Warning("Lost the coordinator, joining it again")
+				continue
+			}
+			if end == coordinatorShutDown {
+				w.logger.Info("The coordinator is shutting down, joining it again once it is back")
+				continue
+			}
+			if end == quarantined || end == shutDown || !w.stayAlive {
+				break
+			}
+			if w.tasksCompleted.Load() > completed {
+				idle.reset()
+			}
+		} else if !w.stayAlive {
+			if err.Error() == "all tasks handed out" {
+				w.logger.Info("The coordinator has no tasks left")
+				break
+			}
+			w.logger.Fatalf("The coordinator turned this worker away: %s", err)
+		}
+
+		delay := idle.next()
+		w.logger.Infof("Waiting %s for the next job", delay)
+		if !w.sleep(delay) {
+			break
+		}
+	}
+
+	w.logger.Info("Shutting down")
+	w.stop()
+}
+
+// join
+// Registers with the coordinator, fetches its settings and reports the benchmark. Keeps trying with a growing wait
+// while the coordinator cannot be reached or is shutting down. Returns an error when the coordinator turned the worker
+// away or the worker was shut down
+func (w *Worker) join() error {
+	wait := newBackoff(w.maxBackoff)
+	for {
+		rejected, err := w.register()
+		if err == nil || (rejected && err.Error() != "coordinator shutting down") {
+			return err
+		}
+		delay := wait.next()
+		w.logger.Warningf("Unable to reach the coordinator, trying again in %s: %s", delay, err)
+		if !w.sleep(delay) {
+			return errors.New("worker shut down")
+		}
+	}
+}
+
+// Shutdown
+// Finishes the tasks being calculated, returns the finished tasks and leaves the coordinator, which hands the tasks the
+// worker fetched ahead to other workers. Returns straight away, Wait blocks until the worker is done
+func (w *Worker) Shutdown() {
+	w.shutdownOnce.Do(func() {
+		w.logger.Info("Shutting down after the current tasks")
+		close(w.shutdown)
+		w.control.stop()
+	})
+}
+
+func (w *Worker) shuttingDown() bool {
+	select {
+	case <-w.shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep
+// Waits for d. Returns false when the worker is shut down in the meantime
+func (w *Worker) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-w.shutdown:
+		return false
+	}
+}
+
+// register
+// Returns rejected when the coordinator answered but will not take the worker. The connection is only left open when
+// the worker joined
+func (w *Worker) register() (rejected bool, err error) {
+	if err = w.coordinator.Connect(); err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil {
+			misc.CheckError(w.coordinator.Disconnect(), w.logger, misc.Debug)
+		}
+	}()
+
+	// Register with the coordinator first so a coordinator running a different version turns us away before any of
+	// its settings are misread
+	registration := misc.Registration{
+		Address:         w.myAddress,
+		Encodings:       []task.Encoding{task.RawEncoding, task.RunLengthEncoding},
+		Features:        misc.AllFeatures(),
+		ProtocolVersion: misc.ProtocolVersion,
+	}
+	reply, err := w.coordinator.RegisterWorker(registration)
+	if err != nil {
+		return transport.IsRemote(err), err
+	}
+	if reply.ProtocolVersion != misc.ProtocolVersion {
+		return true, fmt.Errorf("coordinator speaks protocol version %d but this worker speaks version %d, run the same version of the program on both", reply.ProtocolVersion, misc.ProtocolVersion)
+	}
+	w.encoding = reply.Encoding
+
+	// Get Mandelbrot settings from the coordinator, they change from one job to the next
+	mandelbrotSettings, err := w.coordinator.GetMandelbrotSettings()
+	if err != nil {
+		return false, err
+	}
+	w.mandelbrot = mandelbrot.NewMandelbrot(mandelbrotSettings)
+
+	// Tell the coordinator how fast this worker is so it can be given a fair share of work
+	report := misc.BenchmarkReport{
+		Address:   w.myAddress,
+		Benchmark: w.mandelbrot.Benchmark(benchmarkDuration),
+	}
+	w.logger.Infof("Benchmark: %.0f iterations/s", report.Benchmark)
+	if err = w.coordinator.ReportBenchmark(report); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// tickers
+// Runs until the session is closed. A missed roll call breaks off the calls in progress so the worker joins again
+func (w *Worker) tickers(session <-chan struct{}) {
 	rollCall := time.NewTicker(time.Minute)
 	heartBeat := time.NewTicker(30 * time.Second)
+	defer rollCall.Stop()
+	defer heartBeat.Stop()
 
 	for {
 		select {
+		case <-session:
+			return
+
 		case _ = <-rollCall.C:
 			w.logger.Debug("Roll call ticker")
-			var junk misc.Nothing
-			var reply bool
-			err := w.ServerClient.Client.Call("Coordinator.RollCall", junk, &reply)
+			err := w.coordinator.RollCall()
 			if err != nil {
-				// Cannot communicate with the Coordinator so we should shut down
 				w.logger.Warningf("Coordinator missed roll call: %s", err)
-				misc.CheckError(w.ServerClient.Client.Disconnect(), w.logger, misc.Warning)
-				misc.CheckError(w.ServerClient.Server.Stop(), w.logger, misc.Warning)
+				misc.CheckError(w.coordinator.Disconnect(), w.logger, misc.Debug)
 				continue
 			}
 
 		case _ = <-heartBeat.C:
 			w.logger.Debug("Heart beat ticker")
-			w.logger.Infof("Tasks [Completed: %d]", w.tasksCompleted)
+			w.logger.Infof("Tasks [Completed: %d]", w.tasksCompleted.Load())
 		}
 	}
 }
 
-func (w *Worker) processTasks() {
+// processTasks
+// Processes the tasks of the coordinator the worker joined and returns why it stopped
+func (w *Worker) processTasks() sessionEnd {
 	w.logger.Info("Processing tasks")
 
-	var nothing misc.Nothing
 	var elapsedTime time.Duration
 	var startTime = time.Now()
+	session := make(chan struct{})
+	w.routines.Add(1)
+	go func() {
+		w.tickers(session)
+		w.routines.Done()
+	}()
+
+	// Tasks are fetched and returned in the background so the calculations do not wait on the network
+	var fetchEnd sessionEnd
+	todo := make(chan task.Task, w.prefetchTasks)
+	done := make(chan task.Task, w.returnBatch)
+	returned := make(chan struct{})
+	go w.fetchTasks(todo, &fetchEnd)
+	go func() {
+		w.returnTasks(done, todo)
+		close(returned)
+	}()
 
+	// Up to Concurrency tasks are calculated at once. On shutdown the tasks still queued are left for the coordinator
+	// to hand out again
+	var calculating sync.WaitGroup
+	stopped := false
+processing:
 	for {
-		var taskTodo task.Task
-		var err error
+		select {
+		case <-w.shutdown:
+			stopped = true
+			break processing
+		case taskTodo, more := <-todo:
+			if !more {
+				break processing
+			}
+			if !w.control.acquire(taskTodo.ID) {
+				stopped = true
+				break processing
+			}
+			calculating.Add(1)
+			// The slot is held until the result is queued so calculations cannot run ahead of the returns
+			go func(t task.Task) {
+				w.calculateTask(&t)
+				w.journal.Record(misc.Event{Duration: t.Duration, Image: t.ImageNumber, Kind: misc.TaskCalculated, Task: t.ID, Worker: w.myAddress})
+				done <- t
+				w.control.release(t.ID)
+				calculating.Done()
+			}(taskTodo)
+		}
+	}
+	calculating.Wait()
+	close(done)
+	<-returned
+	close(session)
+	end := shutDown
+	if !stopped {
+		end = fetchEnd
+	}
 
-		err = w.ServerClient.Client.Call("Coordinator.GetTask", w.myAddress, &taskTodo)
+	elapsedTime = time.Since(startTime)
+
+	w.logger.Infof("Done processing tasks [%s]", end)
+	w.logger.Debugf("Processed %d tasks in %s", w.tasksCompleted.Load(), elapsedTime)
+	return end
+}
+
+// Wait
+// Blocks until the worker has processed its tasks, left the coordinator and stopped its tickers
+func (w *Worker) Wait() {
+	w.routines.Wait()
+}
+
+// stop
+// Stops the rpc server along with the guard and connector in front of the connections
+func (w *Worker) stop() {
+	if w.Server != nil {
+		misc.CheckError(w.Server.Stop(), w.logger, misc.Warning)
+	}
+	if w.connector != nil {
+		misc.CheckError(w.connector.Close(), w.logger, misc.Warning)
+	}
+	if w.guard != nil {
+		misc.CheckError(w.guard.Close(), w.logger, misc.Warning)
+	}
+	misc.CheckError(w.journal.Close(), w.logger, misc.Warning)
+}
+
+// fetchTasks
+// Keeps the todo queue filled, asking for up to FetchBatch tasks per call. The queue is closed once the coordinator
+// has no more tasks or cannot be reached, end says which. Nothing more is fetched once the worker is shut down
+func (w *Worker) fetchTasks(todo chan<- task.Task, end *sessionEnd) {
+	defer close(todo)
+	request := misc.TaskRequest{
+		Address: w.myAddress,
+		Count:   w.fetchBatch,
+	}
+	for !w.shuttingDown() {
+		tasks, err := w.coordinator.GetTasks(request)
 		if err != nil {
-			// This is an expected error. No more work to do
-			if err.Error() == "all tasks handed out" {
-				break
+			switch err.Error() {
+			case "all tasks handed out":
+				// This is an expected error. No more work to do
+				*end = ranOutOfTasks
+			case "coordinator shutting down":
+				*end = coordinatorShutDown
+			case "worker quarantined":
+				w.logger.Error("The coordinator quarantined this worker after its results failed verification")
+				*end = quarantined
+			default:
+				w.logger.Warningf("Unable to get tasks: %s", err.Error())
+				*end = lostCoordinator
 			}
-			w.logger.Fatalf("Unable to get a task: %s", err.Error())
+			return
+		}
+		for _, t := range tasks {
+			select {
+			case todo <- t:
+			case <-w.shutdown:
+				*end = shutDown
+				return
+			}
+		}
+	}
+	*end = shutDown
+}
+
+// returnTasks
+// Sends finished tasks back up to ReturnBatch at a time. A smaller batch is sent when nothing is left to calculate
+// so results are never held back while the worker waits for more tasks
+func (w *Worker) returnTasks(done <-chan task.Task, todo chan task.Task) {
+	var batch []task.Task
+	failed := false
+
+	for t := range done {
+		batch = append(batch, t)
+		if uint(len(batch)) < w.returnBatch && (len(done) > 0 || len(todo) > 0) {
+			continue
+		}
+		if failed {
+			batch = batch[:0]
+			continue
+		}
+
+		err := w.coordinator.ReturnTasks(batch)
+		if err != nil {
+			// Keep draining so the calculations can finish, the coordinator takes the tasks back when we leave
+			w.logger.Errorf("Unable to return tasks: %s", err.Error())
+			failed = true
+		} else {
+			w.tasksCompleted.Add(int64(len(batch)))
+			w.reportProgress()
+		}
+		batch = batch[:0]
+	}
+	if len(batch) > 0 && !failed {
+		err := w.coordinator.ReturnTasks(batch)
+		if err != nil {
+			w.logger.Errorf("Unable to return tasks: %s", err.Error())
+			return
 		}
+		w.tasksCompleted.Add(int64(len(batch)))
+		w.reportProgress()
+	}
+}
 
+func (w *Worker) reportProgress() {
+	if w.progress != nil {
+		w.progress(int(w.tasksCompleted.Load()))
+	}
+}
+
+// calculateTask
+// Calculates every pixel of the task and records how long it took
+func (w *Worker) calculateTask(taskTodo *task.Task) {
+	// Each task carries the iteration limit and size of its image
+	taskStartTime := time.Now()
+	m := w.mandelbrot.ForTask(taskTodo)
+
+	// Tile shaped tasks can skip uniform areas
+	if m.SubdivideTask(taskTodo) {
+		w.logger.Debugf("Skipped %d of %d pixels in task %d", taskTodo.Statistics.SkippedPixels, len(taskTodo.Results), taskTodo.ID)
+	} else {
 		for {
 			// Process each coordinate given
 			coordinate, err := taskTodo.GetNextTask()
@@ -106,35 +595,32 @@ func (w *Worker) processTasks() {
 				break
 			}
 
-			points := w.mandelbrot.GetPointsToCalculate(coordinate)
-			iterations := w.mandelbrot.EscapeTimeMultiple(points)
-			color := w.mandelbrot.GetColorMultiple(iterations)
+			points := m.GetPointsToCalculate(coordinate)
+			iterations := m.EscapeTimeMultiple(points)
+			color := m.GetColorMultiple(iterations, taskTodo.Coloring)
+			taskTodo.Statistics.AddSamples(iterations, m.MaxIterations())
 
 			pixel := task.Pixel{
 				Color:  color,
 				Column: coordinate.Column,
 				Row:    coordinate.Row,
 			}
+			if taskTodo.KeepIterations {
+				pixel.Iterations = iterations
+			}
 			taskTodo.AddResult(pixel)
 		}
-
-		err = w.ServerClient.Client.Call("Coordinator.ReturnTask", taskTodo, &nothing)
-		if err != nil {
-			w.logger.Errorf("Unable to return a task: %s", err.Error())
-			break
-		}
-		w.tasksCompleted++
 	}
 
-	elapsedTime = time.Since(startTime)
-
-	w.logger.Info("Done processing tasks")
-	w.logger.Debugf("Processed %d tasks in %s", w.tasksCompleted, elapsedTime)
+	// Add more samples to the pixels on edges when using adaptive super sampling
+	refined := m.RefineTask(taskTodo)
+	if refined > 0 {
+		w.logger.Debugf("Refined %d of %d pixels in task %d", refined, len(taskTodo.Results), taskTodo.ID)
+	}
+	taskTodo.Duration = time.Since(taskStartTime)
 
-	w.logger.Info("Shutting down")
-	misc.CheckError(w.ServerClient.Client.Call("Coordinator.DeRegisterWorker", w.myAddress, &nothing), w.logger, misc.Warning)
-	misc.CheckError(w.ServerClient.Client.Disconnect(), w.logger, misc.Warning)
-	misc.CheckError(w.ServerClient.Server.Stop(), w.logger, misc.Warning)
+	// Results that cannot be encoded are sent raw
+	misc.CheckError(taskTodo.EncodeResults(w.encoding), w.logger, misc.Warning)
 }
 
 func (w *Worker) RollCall(request misc.Nothing, reply *bool) error {